@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 
 	"ip_country_project/internal/config"
@@ -10,6 +11,7 @@ import (
 	"ip_country_project/internal/errors"
 	"ip_country_project/internal/handlers"
 	"ip_country_project/internal/middleware"
+	"ip_country_project/internal/redis"
 	"ip_country_project/internal/services"
 )
 
@@ -19,20 +21,25 @@ type Application struct {
 	Config      *config.Config
 	DataStore   datastores.DataStore
 	Service     *services.LocationService
+	Reloads     *services.ReloadService
+	Fetches     *services.FetchService // nil unless the data file is fetched
 	HTTPHandler *handlers.LocationHandler
 }
 
 // New creates a new Application with all dependencies initialized
 func New(cfg *config.Config) (*Application, error) {
-	// Initialize datastore based on type
-	var datastore datastores.DataStore
-	switch cfg.DatastoreType {
-	case "csv":
-		datastore = datastores.NewCSVDataStore(cfg.DatastoreFile)
-	case "json":
-		datastore = datastores.NewJSONDataStore(cfg.DatastoreFile)
-	default:
-		return nil, fmt.Errorf("%w: %s", errors.ErrUnsupportedDatastoreType, cfg.DatastoreType)
+	datastore, err := NewDataStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var fetches *services.FetchService
+	if cfg.FetchURL != "" {
+		fetches = newFetchService(cfg)
+		// A failed fetch falls back on the last good copy on disk
+		if _, err := fetches.Fetch(context.Background()); err != nil {
+			log.Printf("Data file fetch failed, starting from %s: %v", cfg.DatastoreFile, err)
+		}
 	}
 
 	if err := datastore.Load(context.Background()); err != nil {
@@ -40,10 +47,29 @@ func New(cfg *config.Config) (*Application, error) {
 	}
 
 	// Initialize service layer
-	service := services.NewLocationService(datastore)
+	var serviceOpts []services.LocationOption
+	if cfg.SpecialAddresses != "" {
+		serviceOpts = append(serviceOpts, services.WithSpecialAddresses(services.SpecialAddressPolicy(cfg.SpecialAddresses)))
+	}
+	if cfg.CacheSize > 0 {
+		serviceOpts = append(serviceOpts, services.WithCache(services.CacheConfig{
+			Size:        cfg.CacheSize,
+			TTL:         cfg.CacheTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+		}))
+	}
+	service := services.NewLocationService(datastore, serviceOpts...)
+	reloads := services.NewReloadService(datastore, dataFiles(cfg)...)
+	reloads.OnReload(service.InvalidateCache)
+	if cfg.ReloadInterval > 0 {
+		reloads.Watch(cfg.ReloadInterval)
+	}
+	if fetches != nil {
+		fetches.Start(cfg.FetchInterval, reloads.Reload)
+	}
 
 	// Initialize HTTP handler
-	httpHandler := handlers.NewLocationHandler(service)
+	httpHandler := handlers.NewLocationHandler(service, handlers.WithClientIPResolver(middleware.NewClientIPResolver(cfg.TrustedProxies)))
 
 	// Initialize rate limiter
 	rateLimiter := middleware.NewRateLimiter(cfg.RateLimitRPS)
@@ -53,25 +79,178 @@ func New(cfg *config.Config) (*Application, error) {
 	
 	// API v1 endpoints
 	mux.Handle("/v1/find-country", rateLimiter.Middleware(http.HandlerFunc(httpHandler.FindCountry)))
-	
+	mux.Handle("/v1/me", rateLimiter.Middleware(http.HandlerFunc(httpHandler.FindCaller)))
+	networkHandler := handlers.NewNetworkHandler(service)
+	mux.Handle("/v1/network", rateLimiter.Middleware(http.HandlerFunc(networkHandler.FindNetwork)))
+	mux.Handle("/v1/networks", rateLimiter.Middleware(http.HandlerFunc(networkHandler.ListNetworks)))
+	mux.Handle("/v1/countries/{country}/networks", rateLimiter.Middleware(http.HandlerFunc(networkHandler.CountryNetworks)))
+	// The batch and stream handlers charge the limiter per address themselves
+	batchHandler := handlers.NewBatchHandler(service, rateLimiter, cfg.BatchMaxSize)
+	mux.HandleFunc("/v1/find-country/batch", batchHandler.FindCountries)
+	streamHandler := handlers.NewStreamHandler(service, rateLimiter, cfg.StreamMaxLines)
+	mux.HandleFunc("/v1/find-country/stream", streamHandler.FindCountries)
+
+	// Admin endpoints are only exposed when a token is configured
+	if cfg.AdminToken != "" {
+		adminHandler := handlers.NewAdminHandler(reloads, cfg.AdminToken)
+		mux.HandleFunc("/admin/reload", adminHandler.Reload)
+	}
+
 	// Health check endpoint
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status": "ok"}`))
-	})
+	healthHandler := handlers.NewHealthHandler(datastore, handlers.WithDetailToken(cfg.AdminToken))
+	mux.HandleFunc("/health", healthHandler.Health)
 
 	app := &Application{
 		Handler:     mux,
 		Config:      cfg,
 		DataStore:   datastore,
 		Service:     service,
+		Reloads:     reloads,
+		Fetches:     fetches,
 		HTTPHandler: httpHandler,
 	}
 
 	return app, nil
 }
 
+// NewDataStore creates the datastore selected by cfg without loading it
+func NewDataStore(cfg *config.Config) (datastores.DataStore, error) {
+	var opts []datastores.Option
+	if cfg.DatastoreLoadMode != "" {
+		opts = append(opts, datastores.WithLoadMode(datastores.LoadMode(cfg.DatastoreLoadMode)))
+	}
+	if cfg.DuplicatePolicy != "" {
+		opts = append(opts, datastores.WithDuplicatePolicy(datastores.DuplicatePolicy(cfg.DuplicatePolicy)))
+	}
+
+	csvFormat := datastores.CSVFormat{
+		Header:    cfg.CSVHeader,
+		Delimiter: cfg.CSVDelimiter,
+		Comment:   cfg.CSVComment,
+	}
+	if cfg.CSVColumns != "" {
+		columns, err := datastores.ParseCSVColumns(cfg.CSVColumns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV_COLUMNS: %w", err)
+		}
+		csvFormat.Columns = columns
+	}
+	opts = append(opts, datastores.WithCSVFormat(csvFormat))
+	if cfg.RangeFormat != "" {
+		opts = append(opts, datastores.WithRangeFormat(datastores.RangeFormat(cfg.RangeFormat)))
+	}
+
+	// Initialize datastore based on type
+	var datastore datastores.DataStore
+	switch cfg.DatastoreType {
+	case "csv":
+		datastore = datastores.NewCSVDataStore(cfg.DatastoreFile, opts...)
+	case "json":
+		datastore = datastores.NewJSONDataStore(cfg.DatastoreFile, opts...)
+	case "range":
+		datastore = datastores.NewRangeDataStore(cfg.DatastoreFile, opts...)
+	case "mmdb":
+		datastore = datastores.NewMMDBDataStore(cfg.DatastoreFile)
+	case "compiled":
+		datastore = datastores.NewCompiledDataStore(cfg.DatastoreFile)
+	case "http":
+		httpConfig := datastores.HTTPConfig{
+			URL:     cfg.DatastoreURL,
+			Timeout: cfg.HTTPTimeout,
+			Retries: cfg.HTTPRetries,
+		}
+		if cfg.HTTPFields != "" {
+			fields, err := datastores.ParseHTTPFields(cfg.HTTPFields)
+			if err != nil {
+				return nil, fmt.Errorf("invalid HTTP_FIELDS: %w", err)
+			}
+			httpConfig.Fields = fields
+		}
+		datastore = withBreaker(cfg, datastores.NewHTTPDataStore(httpConfig))
+	case "redis":
+		redisOpts, err := redis.ParseURL(cfg.DatastoreURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DATASTORE_URL: %w", err)
+		}
+		datastore = withBreaker(cfg, datastores.NewRedisDataStore(redis.NewClient(redisOpts), cfg.RedisPrefix))
+	case "composite":
+		layers := make([]datastores.Layer, 0, len(cfg.DatastoreLayers))
+		for _, layer := range cfg.DatastoreLayers {
+			layerCfg := *cfg
+			layerCfg.DatastoreType, layerCfg.DatastoreFile, layerCfg.DatastoreURL = layer.Type, layer.File, layer.File
+			store, err := NewDataStore(&layerCfg)
+			if err != nil {
+				return nil, fmt.Errorf("layer %s: %w", layer.Name, err)
+			}
+			layers = append(layers, datastores.Layer{Name: layer.Name, Store: store})
+		}
+		datastore = datastores.NewCompositeDataStore(layers...)
+	default:
+		return nil, fmt.Errorf("%w: %s", errors.ErrUnsupportedDatastoreType, cfg.DatastoreType)
+	}
+
+	return datastore, nil
+}
+
+// withBreaker guards a remote datastore with a circuit breaker unless
+// cfg disables it
+func withBreaker(cfg *config.Config, datastore datastores.DataStore) datastores.DataStore {
+	if cfg.BreakerThreshold <= 0 {
+		return datastore
+	}
+	return datastores.NewBreakerDataStore(datastore, datastores.BreakerConfig{
+		FailureThreshold: cfg.BreakerThreshold,
+		OpenTimeout:      cfg.BreakerOpenTimeout,
+		HalfOpenRequests: cfg.BreakerHalfOpenRequests,
+	})
+}
+
+// newFetchService downloads cfg's data file, checking that every new
+// version loads before it replaces the current one
+func newFetchService(cfg *config.Config) *services.FetchService {
+	return services.NewFetchService(services.FetchConfig{
+		URL:         cfg.FetchURL,
+		ChecksumURL: cfg.FetchChecksumURL,
+		FilePath:    cfg.DatastoreFile,
+		Validate: func(ctx context.Context, path string) error {
+			candidateCfg := *cfg
+			candidateCfg.DatastoreFile = path
+			candidate, err := NewDataStore(&candidateCfg)
+			if err != nil {
+				return err
+			}
+			defer candidate.Close()
+			return candidate.Load(ctx)
+		},
+	})
+}
+
+// dataFiles lists the files backing the datastore, for reload watching
+func dataFiles(cfg *config.Config) []string {
+	switch cfg.DatastoreType {
+	case "http", "redis":
+		return nil
+	case "composite":
+		var files []string
+		for _, layer := range cfg.DatastoreLayers {
+			if layer.Type != "http" && layer.Type != "redis" {
+				files = append(files, layer.File)
+			}
+		}
+		return files
+	}
+	return []string{cfg.DatastoreFile}
+}
+
+// Close stops background reloading and releases datastore resources
+func (a *Application) Close() error {
+	if a.Fetches != nil {
+		a.Fetches.Stop()
+	}
+	a.Reloads.Stop()
+	return a.DataStore.Close()
+}
+
 // NewWithTestConfig creates an application with test-specific configuration
 func NewWithTestConfig(datastoreFile string, rateLimitRPS float64) (*Application, error) {
 	cfg := &config.Config{
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ip_country_project/internal/config"
+	"ip_country_project/internal/datastores"
+	"ip_country_project/internal/redis"
+)
+
+// Compile loads the datastore described by cfg and writes it to outPath as
+// a compiled index, returning the number of dataset entries written. The
+// index is written to a temporary file and renamed into place, so servers
+// mapping the previous version keep working and file watchers see a
+// single change.
+func Compile(ctx context.Context, cfg *config.Config, outPath string) (int, error) {
+	datastore, err := loadSource(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer datastore.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), filepath.Base(outPath)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := datastores.Compile(datastore, tmp); err != nil {
+		_ = tmp.Close()
+		return 0, fmt.Errorf("failed to compile index: %w", err)
+	}
+	// CreateTemp is private to the owner; the index is meant to be shared
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return 0, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), outPath); err != nil {
+		return 0, fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	entries := 0
+	if reporter, ok := datastore.(datastores.StatusReporter); ok {
+		entries = reporter.LoadStatus().Entries
+	}
+	return entries, nil
+}
+
+// ImportRedis loads the datastore described by cfg and imports it into the
+// Redis server at redisURL under cfg.RedisPrefix, returning the number of
+// dataset entries imported. Servers using the redis datastore switch to
+// the new data with their next lookup.
+func ImportRedis(ctx context.Context, cfg *config.Config, redisURL string) (int, error) {
+	redisOpts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return 0, err
+	}
+
+	datastore, err := loadSource(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer datastore.Close()
+
+	client := redis.NewClient(redisOpts)
+	defer client.Close()
+
+	entries, err := datastores.ImportRedis(ctx, client, cfg.RedisPrefix, datastore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import into redis: %w", err)
+	}
+	return entries, nil
+}
+
+// loadSource creates and loads the datastore described by cfg
+func loadSource(ctx context.Context, cfg *config.Config) (datastores.DataStore, error) {
+	datastore, err := NewDataStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := datastore.Load(ctx); err != nil {
+		_ = datastore.Close()
+		return nil, err
+	}
+	return datastore, nil
+}
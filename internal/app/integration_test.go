@@ -1,17 +1,27 @@
 package app
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"ip_country_project/internal/config"
 	"ip_country_project/internal/datastores"
 	"ip_country_project/internal/handlers"
 	"ip_country_project/internal/middleware"
 	"ip_country_project/internal/models"
+	"ip_country_project/internal/redis/redistest"
 	"ip_country_project/internal/services"
 )
 
@@ -72,7 +82,8 @@ func TestIntegration_FindCountry_Success(t *testing.T) {
 func TestIntegration_FindCountry_MissingIP(t *testing.T) {
 	handler := setupTestHandler(t)
 
-	req := httptest.NewRequest("GET", "/v1/find-country", nil)
+	// Leaving out ip locates the caller; an empty one is a mistake
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=", nil)
 	rr := httptest.NewRecorder()
 
 	handler.ServeHTTP(rr, req)
@@ -138,6 +149,32 @@ func TestIntegration_FindCountry_IPNotFound(t *testing.T) {
 	}
 }
 
+func TestIntegration_FindCountry_NonPublicAddress(t *testing.T) {
+	handler := setupTestHandler(t)
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=192.168.1.10", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422, got %d", rr.Code)
+	}
+
+	var errorResp models.ErrorResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &errorResp)
+	if err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if errorResp.Error != "IP address is not publicly routable" {
+		t.Errorf("unexpected error message: %s", errorResp.Error)
+	}
+	if errorResp.AddressClass != "private" || errorResp.Network != "192.168.0.0/16" {
+		t.Errorf("expected private 192.168.0.0/16, got %s %s", errorResp.AddressClass, errorResp.Network)
+	}
+}
+
 func TestIntegration_FindCountry_MethodNotAllowed(t *testing.T) {
 	handler := setupTestHandler(t)
 
@@ -223,3 +260,1072 @@ func TestIntegration_ContentType(t *testing.T) {
 		t.Errorf("expected Content-Type 'application/json', got '%s'", contentType)
 	}
 }
+
+func TestIntegration_AdminReload(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_reload_*.csv")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	_, _ = tmpFile.WriteString("8.8.8.8,Mountain View,United States\n")
+	_ = tmpFile.Close()
+	t.Cleanup(func() {
+		_ = os.Remove(tmpFile.Name())
+	})
+
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: tmpFile.Name(),
+		AdminToken:    "secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	if err := os.WriteFile(tmpFile.Name(), []byte("1.1.1.1,San Francisco,United States\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite CSV: %v", err)
+	}
+
+	// Missing token is rejected
+	req := httptest.NewRequest("POST", "/admin/reload", nil)
+	rr := httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=1.1.1.1", nil)
+	rr = httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected reloaded entry to resolve, got status %d", rr.Code)
+	}
+
+	// A failed reload doesn't reveal its cause
+	if err := os.WriteFile(tmpFile.Name(), []byte("not-an-ip,Nowhere,Nowhere\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite CSV: %v", err)
+	}
+	req = httptest.NewRequest("POST", "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response models.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if response.Error != "datastore reload failed" {
+		t.Errorf("expected a generic error, got %q", response.Error)
+	}
+}
+
+func TestIntegration_AdminReload_DisabledWithoutToken(t *testing.T) {
+	handler := setupTestHandler(t)
+
+	req := httptest.NewRequest("POST", "/admin/reload", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 when admin token is unset, got %d", rr.Code)
+	}
+}
+
+func TestIntegration_Health(t *testing.T) {
+	handler := setupTestHandler(t)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rr.Code)
+	}
+
+	var health models.HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if health.Status != "ok" {
+		t.Errorf("expected status 'ok', got '%s'", health.Status)
+	}
+	if health.Datastore == nil || health.Datastore.Entries != 2 {
+		t.Errorf("expected datastore status with 2 entries, got %+v", health.Datastore)
+	}
+}
+
+func TestIntegration_Health_LoadDetails(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "health.csv")
+	if err := os.WriteFile(tmpFile, []byte("8.8.8.8,Mountain View,United States\n"), 0o644); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: tmpFile,
+		AdminToken:    "secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	if err := os.WriteFile(tmpFile, []byte("not-an-ip,Nowhere,Nowhere\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite CSV: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	application.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	health := func(token string) models.HealthResponse {
+		req := httptest.NewRequest("GET", "/health", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		var response models.HealthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		return response
+	}
+
+	// The public response shows the failed attempt but not its cause
+	public := health("")
+	if public.Datastore == nil || public.Datastore.LastError != "" || public.Datastore.Report != nil {
+		t.Fatalf("expected load details to be hidden, got %+v", public.Datastore)
+	}
+	if !public.Datastore.LastSuccess.Before(public.Datastore.LastAttempt) || public.Datastore.Entries != 1 {
+		t.Errorf("expected a failed attempt after the last success, got %+v", public.Datastore)
+	}
+	if wrong := health("wrong"); wrong.Datastore.LastError != "" {
+		t.Errorf("expected load details to be hidden from a wrong token, got %q", wrong.Datastore.LastError)
+	}
+
+	admin := health("secret")
+	if admin.Datastore == nil || admin.Datastore.LastError == "" || admin.Datastore.Report == nil {
+		t.Errorf("expected load details for the admin token, got %+v", admin.Datastore)
+	}
+}
+
+func TestIntegration_CompiledIndex(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "sample.idx")
+
+	entries, err := Compile(context.Background(), &config.Config{
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	}, output)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if entries != 5 {
+		t.Errorf("expected 5 compiled entries, got %d", entries)
+	}
+
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "compiled",
+		DatastoreFile: output,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=77.88.8.8", nil)
+	rr := httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var location models.Location
+	if err := json.Unmarshal(rr.Body.Bytes(), &location); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if location.Country != "Russia" || location.City != "Moscow" {
+		t.Errorf("expected Moscow, Russia, got %s, %s", location.City, location.Country)
+	}
+}
+
+func TestIntegration_CompositeDatastore(t *testing.T) {
+	overrides := filepath.Join(t.TempDir(), "overrides.csv")
+	if err := os.WriteFile(overrides, []byte("8.8.8.8,Office,Germany\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	layers, err := config.ParseLayers("overrides=csv:" + overrides + ",csv:../../testdata/sample_ips.csv")
+	if err != nil {
+		t.Fatalf("failed to parse layers: %v", err)
+	}
+	application, err := New(&config.Config{
+		RateLimitRPS:    100,
+		DatastoreType:   "composite",
+		DatastoreLayers: layers,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	testCases := map[string][2]string{
+		"8.8.8.8":   {"Germany", "overrides"},
+		"77.88.8.8": {"Russia", "sample_ips.csv"},
+	}
+	for ip, expected := range testCases {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip="+ip, nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for %s, got %d: %s", ip, rr.Code, rr.Body.String())
+		}
+
+		var location models.Location
+		if err := json.Unmarshal(rr.Body.Bytes(), &location); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if location.Country != expected[0] || location.Source != expected[1] {
+			t.Errorf("expected %s from %s for %s, got %s from %s", expected[0], expected[1], ip, location.Country, location.Source)
+		}
+	}
+}
+
+func TestIntegration_HTTPDatastore(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/geo/8.8.8.8":
+			_, _ = w.Write([]byte(`{"country": {"name": "United States"}, "city": {"name": "Mountain View"}}`))
+		case "/geo/1.1.1.1":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "http",
+		DatastoreURL:  upstream.URL + "/geo/{ip}",
+		HTTPFields:    "country=country.name,city=city.name",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	testCases := map[string]int{
+		"8.8.8.8": http.StatusOK,
+		"9.9.9.9": http.StatusNotFound,
+		"1.1.1.1": http.StatusBadGateway,
+	}
+	for ip, expected := range testCases {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip="+ip, nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("expected status %d for %s, got %d: %s", expected, ip, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestIntegration_RedisDatastore(t *testing.T) {
+	server := redistest.NewServer(t, "s3cret")
+
+	entries, err := ImportRedis(context.Background(), &config.Config{
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+		RedisPrefix:   "geo:",
+	}, server.URL())
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if entries != 5 {
+		t.Errorf("expected 5 imported entries, got %d", entries)
+	}
+
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "redis",
+		DatastoreURL:  server.URL(),
+		RedisPrefix:   "geo:",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+
+	testCases := map[string]int{
+		"77.88.8.8": http.StatusOK,
+		"9.9.9.9":   http.StatusNotFound,
+	}
+	for ip, expected := range testCases {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip="+ip, nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("expected status %d for %s, got %d: %s", expected, ip, rr.Code, rr.Body.String())
+		}
+	}
+
+	if err := application.Close(); err != nil {
+		t.Fatalf("failed to close application: %v", err)
+	}
+	for deadline := time.Now().Add(time.Second); server.OpenConnections() > 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if open := server.OpenConnections(); open != 0 {
+		t.Errorf("expected closing the application to release Redis connections, %d still open", open)
+	}
+}
+
+func TestIntegration_CircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(upstream.Close)
+
+	application, err := New(&config.Config{
+		RateLimitRPS:       100,
+		DatastoreType:      "http",
+		DatastoreURL:       upstream.URL + "/geo/{ip}",
+		BreakerThreshold:   2,
+		BreakerOpenTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	for i, expected := range []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusServiceUnavailable} {
+		req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("request %d: expected status %d, got %d: %s", i+1, expected, rr.Code, rr.Body.String())
+		}
+	}
+	// Without retries each lookup made one upstream request until the
+	// breaker opened
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", requests.Load())
+	}
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	rr := httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	var health models.HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if rr.Code != http.StatusOK || health.Status != "degraded" {
+		t.Errorf("expected a degraded 200 health response, got %d %s", rr.Code, health.Status)
+	}
+	if health.Datastore == nil || health.Datastore.Breaker == nil || health.Datastore.Breaker.State != "open" {
+		t.Errorf("expected the open breaker in health output, got %+v", health.Datastore)
+	}
+}
+
+func TestIntegration_FetchedDataFile(t *testing.T) {
+	var data atomic.Value
+	data.Store("8.8.8.8,Mountain View,United States\n")
+	var down atomic.Bool
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body := data.Load().(string)
+		sum := sha256.Sum256([]byte(body))
+		switch r.URL.Path {
+		case "/locations.csv":
+			_, _ = w.Write([]byte(body))
+		case "/locations.csv.sha256":
+			_, _ = w.Write([]byte(hex.EncodeToString(sum[:]) + "  locations.csv\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(origin.Close)
+
+	cfg := &config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: filepath.Join(t.TempDir(), "locations.csv"),
+		FetchURL:      origin.URL + "/locations.csv",
+		FetchInterval: time.Hour,
+	}
+	expectCountry := func(application *Application, expected int) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("expected status %d, got %d: %s", expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	application, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	expectCountry(application, http.StatusOK)
+
+	// A version that doesn't load is never written over the good copy
+	data.Store("not,a\nvalid,data,file,at,all\n")
+	if changed, err := application.Fetches.Fetch(context.Background()); err == nil || changed {
+		t.Errorf("expected an unloadable download to be rejected, got %v, %v", changed, err)
+	}
+	_ = application.Close()
+
+	// Cold start while the source is down serves the last good copy
+	down.Store(true)
+	restarted, err := New(cfg)
+	if err != nil {
+		t.Fatalf("expected a cold start from the local copy, got %v", err)
+	}
+	t.Cleanup(func() {
+		_ = restarted.Close()
+	})
+	expectCountry(restarted, http.StatusOK)
+}
+
+func TestIntegration_BatchLookup(t *testing.T) {
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+		BatchMaxSize:  5,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	body := `["77.88.8.8", "9.9.9.9", "not-an-ip", "10.0.0.1", "8.8.8.8"]`
+	req := httptest.NewRequest("POST", "/v1/find-country/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var results []models.BatchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	expected := []struct {
+		ip      string
+		status  int
+		country string
+	}{
+		{"77.88.8.8", http.StatusOK, "Russia"},
+		{"9.9.9.9", http.StatusNotFound, ""},
+		{"not-an-ip", http.StatusBadRequest, ""},
+		{"10.0.0.1", http.StatusUnprocessableEntity, ""},
+		{"8.8.8.8", http.StatusOK, "United States"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for i, want := range expected {
+		result := results[i]
+		if result.IP != want.ip || result.Status != want.status {
+			t.Errorf("result %d: expected %s with status %d, got %+v", i, want.ip, want.status, result)
+			continue
+		}
+		if want.country != "" && (result.Location == nil || result.Location.Country != want.country) {
+			t.Errorf("result %d: expected %s, got %+v", i, want.country, result.Location)
+		}
+		if want.status != http.StatusOK && (result.ErrorResponse == nil || result.Error == "") {
+			t.Errorf("result %d: expected an error message, got %+v", i, result)
+		}
+	}
+	if results[3].AddressClass != "private" {
+		t.Errorf("expected the private address class, got %q", results[3].AddressClass)
+	}
+
+	testCases := map[string]struct {
+		method string
+		body   string
+		status int
+	}{
+		"not an array":  {"POST", `{"ips": ["8.8.8.8"]}`, http.StatusBadRequest},
+		"null":          {"POST", `null`, http.StatusBadRequest},
+		"too large":     {"POST", `["1.1.1.1", "1.1.1.1", "1.1.1.1", "1.1.1.1", "1.1.1.1", "1.1.1.1"]`, http.StatusRequestEntityTooLarge},
+		"wrong method":  {"GET", "", http.StatusMethodNotAllowed},
+		"empty batch":   {"POST", `[]`, http.StatusOK},
+		"not addresses": {"POST", `[1, 2]`, http.StatusBadRequest},
+	}
+	for name, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "/v1/find-country/batch", strings.NewReader(tc.body))
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d: %s", name, tc.status, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestIntegration_BatchLookup_RateLimit(t *testing.T) {
+	application, err := New(&config.Config{
+		RateLimitRPS:  5,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/v1/find-country/batch", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// A batch of 4 leaves 1 of the 5 tokens
+	if status := post(`["8.8.8.8", "1.1.1.1", "77.88.8.8", "8.26.56.26"]`); status != http.StatusOK {
+		t.Fatalf("expected the first batch to succeed, got %d", status)
+	}
+	if status := post(`["8.8.8.8", "1.1.1.1"]`); status != http.StatusTooManyRequests {
+		t.Errorf("expected a batch beyond the remaining tokens to be rate limited, got %d", status)
+	}
+
+	// The rejected batch was admitted with the last token before its size
+	// was known, and keeps it
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	rr := httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected single lookups to share the limit, got %d", rr.Code)
+	}
+}
+
+func TestIntegration_BatchLookup_RateLimitInvalid(t *testing.T) {
+	application, err := New(&config.Config{
+		RateLimitRPS:  3,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	// Requests refused before the batch size is known still take a token
+	requests := []struct {
+		method string
+		body   string
+		status int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", `{not json`, http.StatusBadRequest},
+		{"POST", `["8.8.8.8"`, http.StatusBadRequest},
+		{"POST", `["8.8.8.8"]`, http.StatusTooManyRequests},
+	}
+	for _, tt := range requests {
+		req := httptest.NewRequest(tt.method, "/v1/find-country/batch", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %q: expected status %d, got %d", tt.method, tt.body, tt.status, rr.Code)
+		}
+	}
+}
+
+func TestIntegration_BatchLookup_LargerThanBucket(t *testing.T) {
+	application, err := New(&config.Config{
+		RateLimitRPS:  5,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	// 8 addresses against a full bucket of 5 tokens
+	body := `["8.8.8.8", "1.1.1.1", "77.88.8.8", "8.26.56.26", "208.67.222.222", "8.8.8.8", "1.1.1.1", "77.88.8.8"]`
+	req := httptest.NewRequest("POST", "/v1/find-country/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected a batch larger than the bucket to be accepted when it is full, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The batch left the bucket 3 tokens in debt
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	rr = httptest.NewRecorder()
+	application.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the excess to be paid back before the next lookup, got %d", rr.Code)
+	}
+}
+
+func setupStreamServer(t *testing.T, cfg *config.Config) *httptest.Server {
+	t.Helper()
+
+	application, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	server := httptest.NewServer(application.Handler)
+	t.Cleanup(func() {
+		server.Close()
+		_ = application.Close()
+	})
+	return server
+}
+
+func TestIntegration_StreamLookup(t *testing.T) {
+	server := setupStreamServer(t, &config.Config{
+		RateLimitRPS:   100,
+		DatastoreType:  "csv",
+		DatastoreFile:  "../../testdata/sample_ips.csv",
+		StreamMaxLines: 5,
+	})
+
+	body := "77.88.8.8\n\"8.8.8.8\"\r\n{\"ip\": \"9.9.9.9\", \"ts\": 1700000000}\n{not json\n\n1.1.1.1\n8.26.56.26"
+	resp, err := http.Post(server.URL+"/v1/find-country/stream", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var results []models.BatchResult
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var result models.BatchResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("failed to decode result line: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	expected := []struct {
+		ip     string
+		status int
+	}{
+		{"77.88.8.8", http.StatusOK},
+		{"8.8.8.8", http.StatusOK},
+		{"9.9.9.9", http.StatusNotFound},
+		{"", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+		// The line cap of 5 ends the stream
+		{"", http.StatusRequestEntityTooLarge},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d result lines, got %d: %+v", len(expected), len(results), results)
+	}
+	for i, want := range expected {
+		if results[i].IP != want.ip || results[i].Status != want.status {
+			t.Errorf("line %d: expected %q with status %d, got %+v", i+1, want.ip, want.status, results[i])
+		}
+	}
+	if results[0].Location == nil || results[0].Location.Country != "Russia" {
+		t.Errorf("expected Russia for the first line, got %+v", results[0].Location)
+	}
+}
+
+func TestIntegration_StreamLookup_RateLimit(t *testing.T) {
+	server := setupStreamServer(t, &config.Config{
+		RateLimitRPS:  5,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+
+	body := "8.8.8.8\n1.1.1.1\n77.88.8.8\n8.26.56.26\n208.67.222.222\n8.8.8.8\n1.1.1.1\n77.88.8.8\n"
+	start := time.Now()
+	resp, err := http.Post(server.URL+"/v1/find-country/stream", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var results []models.BatchResult
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var result models.BatchResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("failed to decode result line: %v", err)
+		}
+		results = append(results, result)
+	}
+	elapsed := time.Since(start)
+
+	// Lines past the 5 tokens in the bucket wait for a refill instead of
+	// ending the stream
+	if len(results) != 8 {
+		t.Fatalf("expected 8 result lines, got %d: %+v", len(results), results)
+	}
+	for i, result := range results {
+		if result.Status != http.StatusOK {
+			t.Errorf("line %d: expected status 200, got %+v", i+1, result)
+		}
+	}
+	// The 3 lines over the burst take 3 refills at 5 per second
+	if elapsed < 500*time.Millisecond {
+		t.Errorf("expected the stream to be paced to the rate limit, took %v", elapsed)
+	}
+
+	// With the bucket empty the next stream is refused outright
+	resp, err = http.Post(server.URL+"/v1/find-country/stream", "application/x-ndjson", strings.NewReader("8.8.8.8\n"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", resp.StatusCode)
+	}
+}
+
+func TestIntegration_StreamLookup_Interactive(t *testing.T) {
+	server := setupStreamServer(t, &config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+
+	input, writer := io.Pipe()
+	req, _ := http.NewRequest("POST", server.URL+"/v1/find-country/stream", input)
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("request failed: %v", err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+
+	// Each answer arrives while the request body is still open
+	var output *bufio.Reader
+	for i, ip := range []string{"8.8.8.8", "77.88.8.8"} {
+		if _, err := writer.Write([]byte(ip + "\n")); err != nil {
+			t.Fatalf("failed to write line: %v", err)
+		}
+		if i == 0 {
+			resp, ok := <-responses
+			if !ok {
+				t.FailNow()
+			}
+			defer resp.Body.Close()
+			output = bufio.NewReader(resp.Body)
+		}
+		line, err := output.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("failed to read result line: %v", err)
+		}
+		var result models.BatchResult
+		if err := json.Unmarshal(line, &result); err != nil || result.IP != ip || result.Status != http.StatusOK {
+			t.Errorf("unexpected result line for %s: %s", ip, line)
+		}
+	}
+	_ = writer.Close()
+	if rest, _ := io.ReadAll(output); len(rest) != 0 {
+		t.Errorf("expected the stream to end with the input, got %q", rest)
+	}
+}
+
+func TestIntegration_StreamLookup_ClientDisconnect(t *testing.T) {
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+		cancelled <- struct{}{}
+	}))
+	t.Cleanup(upstream.Close)
+
+	server := setupStreamServer(t, &config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "http",
+		DatastoreURL:  upstream.URL + "/geo/{ip}",
+		HTTPTimeout:   time.Minute,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	input, writer := io.Pipe()
+	t.Cleanup(func() {
+		_ = writer.Close()
+	})
+	req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+"/v1/find-country/stream", input)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+	_, _ = writer.Write([]byte("8.8.8.8\n"))
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lookup to reach the upstream")
+	}
+	cancel()
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lookup to be cancelled with the client")
+	}
+}
+
+func TestIntegration_FindCaller(t *testing.T) {
+	// The IPv4-mapped spelling of 10.0.0.0/8 must match IPv4 peers
+	proxies, err := config.ParseTrustedProxies("::ffff:10.0.0.0/104")
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+	application, err := New(&config.Config{
+		RateLimitRPS:   100,
+		DatastoreType:  "csv",
+		DatastoreFile:  "../../testdata/sample_ips.csv",
+		TrustedProxies: proxies,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	testCases := []struct {
+		path       string
+		remoteAddr string
+		forwarded  string
+		status     int
+		country    string
+	}{
+		{"/v1/me", "77.88.8.8:40000", "", http.StatusOK, "Russia"},
+		{"/v1/find-country", "77.88.8.8:40000", "", http.StatusOK, "Russia"},
+		// Headers from a trusted proxy name the client
+		{"/v1/me", "10.1.2.3:40000", "8.26.56.26", http.StatusOK, "Germany"},
+		// Headers from anyone else are ignored
+		{"/v1/me", "77.88.8.8:40000", "8.26.56.26", http.StatusOK, "Russia"},
+		{"/v1/me", "127.0.0.1:40000", "", http.StatusUnprocessableEntity, ""},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != tc.status {
+			t.Errorf("%s from %s: expected status %d, got %d: %s", tc.path, tc.remoteAddr, tc.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if tc.country == "" {
+			continue
+		}
+		var location models.Location
+		if err := json.Unmarshal(rr.Body.Bytes(), &location); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if location.Country != tc.country {
+			t.Errorf("%s from %s: expected %s, got %s", tc.path, tc.remoteAddr, tc.country, location.Country)
+		}
+	}
+}
+
+func TestIntegration_Networks(t *testing.T) {
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/v1/network?ip=77.88.8.8")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var record models.NetworkRecord
+	if err := json.Unmarshal(rr.Body.Bytes(), &record); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if record.Network != "77.88.8.8/32" || record.Source != "sample_ips.csv" || record.Location.Country != "Russia" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+
+	rr = get("/v1/networks?cidr=8.0.0.0/8")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var list models.NetworkList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if list.Network != "8.0.0.0/8" || len(list.Records) != 2 || list.Truncated {
+		t.Errorf("unexpected list: %+v", list)
+	} else if list.Records[0].Network != "8.8.8.8/32" || list.Records[1].Network != "8.26.56.26/32" {
+		t.Errorf("expected records in address order, got %+v", list.Records)
+	}
+
+	rr = get("/v1/networks?cidr=8.0.0.0/8&limit=1")
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(list.Records) != 1 || !list.Truncated {
+		t.Errorf("expected a truncated list of one, got %+v", list)
+	}
+
+	testCases := map[string]int{
+		"/v1/network?ip=9.9.9.9":              http.StatusNotFound,
+		"/v1/network?ip=10.0.0.1":             http.StatusUnprocessableEntity,
+		"/v1/network":                         http.StatusBadRequest,
+		"/v1/networks?cidr=10.0.0.0/8":        http.StatusOK,
+		"/v1/networks":                        http.StatusBadRequest,
+		"/v1/networks?cidr=8.8.8.8/33":        http.StatusBadRequest,
+		"/v1/networks?cidr=8.0.0.0/8&limit=0": http.StatusBadRequest,
+	}
+	for path, expected := range testCases {
+		if rr := get(path); rr.Code != expected {
+			t.Errorf("%s: expected status %d, got %d: %s", path, expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestIntegration_Networks_Unsupported(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"country": "United States"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "http",
+		DatastoreURL:  upstream.URL + "/geo/{ip}",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	for _, path := range []string{"/v1/network?ip=8.8.8.8", "/v1/networks?cidr=8.0.0.0/8"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("%s: expected status 501, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestIntegration_CountryNetworks(t *testing.T) {
+	application, err := New(&config.Config{
+		RateLimitRPS:  100,
+		DatastoreType: "csv",
+		DatastoreFile: "../../testdata/sample_ips.csv",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test application: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = application.Close()
+	})
+
+	get := func(path string) (*httptest.ResponseRecorder, models.CountryNetworks) {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		application.Handler.ServeHTTP(rr, req)
+		var page models.CountryNetworks
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+		}
+		return rr, page
+	}
+
+	// Page through the country two networks at a time
+	var networks []string
+	path := "/v1/countries/united%20states/networks?limit=2"
+	for range 3 {
+		rr, page := get(path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		networks = append(networks, page.Networks...)
+		if page.Next == "" {
+			break
+		}
+		path = "/v1/countries/united%20states/networks?limit=2&cursor=" + page.Next
+	}
+	if result := strings.Join(networks, " "); result != "1.1.1.1/32 8.8.8.8/32 208.67.222.222/32" {
+		t.Errorf("unexpected networks: %s", result)
+	}
+
+	if rr, page := get("/v1/countries/United%20States/networks?city=san%20francisco"); rr.Code != http.StatusOK || strings.Join(page.Networks, " ") != "1.1.1.1/32 208.67.222.222/32" {
+		t.Errorf("unexpected city page: %d %s", rr.Code, rr.Body.String())
+	}
+
+	testCases := map[string]int{
+		"/v1/countries/France/networks":              http.StatusNotFound,
+		"/v1/countries/Russia/networks?city=Paris":   http.StatusNotFound,
+		"/v1/countries/Russia/networks?cursor=bogus": http.StatusBadRequest,
+		"/v1/countries/Russia/networks?limit=-1":     http.StatusBadRequest,
+	}
+	for path, expected := range testCases {
+		if rr, _ := get(path); rr.Code != expected {
+			t.Errorf("%s: expected status %d, got %d: %s", path, expected, rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -2,8 +2,17 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ip_country_project/internal/redis"
+	"ip_country_project/internal/utils"
 )
 
 type Config struct {
@@ -12,14 +21,96 @@ type Config struct {
 	RateLimitRPS  float64
 	DatastoreType string
 	DatastoreFile string
+	// DatastoreURL is the upstream URL template of the "http" datastore,
+	// with {ip} replaced by the queried address, or the redis:// URL of
+	// the "redis" datastore
+	DatastoreURL string
+	// RedisPrefix namespaces the keys of the "redis" datastore
+	RedisPrefix string
+	// HTTPFields maps location fields to upstream JSON paths, e.g.
+	// "country=country.name,city=city.name"
+	HTTPFields string
+	// HTTPTimeout bounds each upstream attempt; HTTPRetries more attempts
+	// follow a 5xx or transport error
+	HTTPTimeout time.Duration
+	HTTPRetries int
+	// BreakerThreshold consecutive failed lookups trip the circuit breaker
+	// guarding http and redis datastores; 0 disables it. A tripped breaker
+	// fails fast for BreakerOpenTimeout, then lets BreakerHalfOpenRequests
+	// trial lookups through.
+	BreakerThreshold        int
+	BreakerOpenTimeout      time.Duration
+	BreakerHalfOpenRequests int
+	// DatastoreLayers are the stores of a "composite" datastore in priority order
+	DatastoreLayers []DatastoreLayer
+	// DatastoreLoadMode is "strict" (abort on bad rows) or "lenient" (skip them)
+	DatastoreLoadMode string
+	// DuplicatePolicy resolves repeated networks: "error", "first-wins" or
+	// "last-wins". "error" also rejects nested networks that change country.
+	DuplicatePolicy string
+	// CSVHeader marks the first CSV row as column names
+	CSVHeader bool
+	// CSVDelimiter and CSVComment are single runes; zero means default/disabled
+	CSVDelimiter rune
+	CSVComment   rune
+	// CSVColumns maps fields to columns, e.g. "ip=0,city=1,country=2"
+	CSVColumns string
+	// FetchURL makes the service download DatastoreFile from this URL
+	// every FetchInterval, verified against the SHA-256 at
+	// FetchChecksumURL (default FetchURL + ".sha256")
+	FetchURL         string
+	FetchChecksumURL string
+	FetchInterval    time.Duration
+	// ReloadInterval enables polling the data file for changes; 0 disables
+	ReloadInterval time.Duration
+	// AdminToken enables the admin endpoints, guarded by this bearer token
+	AdminToken string
+	// CacheSize enables an LRU cache of up to this many lookups; 0
+	// disables it. Found locations are cached for CacheTTL and not-found
+	// answers for CacheNegativeTTL.
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+	// SpecialAddresses is "lookup" (classify private, loopback and other
+	// special-purpose addresses only when the datastore has no entry) or
+	// "reject" (answer them without a lookup)
+	SpecialAddresses string
+	// BatchMaxSize is the most addresses one batch lookup may hold
+	BatchMaxSize int
+	// StreamMaxLines is the most addresses one bulk stream may hold
+	StreamMaxLines int
+	// TrustedProxies are the networks whose forwarding headers are
+	// believed when locating the caller
+	TrustedProxies []netip.Prefix
+	// RangeFormat is the column layout of "range" files: "default",
+	// "ip2location" or "dbip"
+	RangeFormat string
+}
+
+// DatastoreLayer is one layer of a composite datastore
+type DatastoreLayer struct {
+	Name string
+	Type string
+	File string
 }
 
 func Load() (*Config, error) {
 	config := &Config{
-		Host:          getEnv("HOST", "localhost"),
-		Port:          getEnv("PORT", "8080"),
-		DatastoreType: getEnv("DATASTORE_TYPE", "csv"),
-		DatastoreFile: getEnv("DATASTORE_FILE", "testdata/sample_ips.csv"),
+		Host:              getEnv("HOST", "localhost"),
+		Port:              getEnv("PORT", "8080"),
+		DatastoreType:     getEnv("DATASTORE_TYPE", "csv"),
+		DatastoreFile:     getEnv("DATASTORE_FILE", "testdata/sample_ips.csv"),
+		DatastoreLoadMode: getEnv("DATASTORE_LOAD_MODE", "strict"),
+		DuplicatePolicy:   getEnv("DATASTORE_DUPLICATE_POLICY", "last-wins"),
+		CSVColumns:        os.Getenv("CSV_COLUMNS"),
+		DatastoreURL:      os.Getenv("DATASTORE_URL"),
+		HTTPFields:        os.Getenv("HTTP_FIELDS"),
+		RedisPrefix:       getEnv("REDIS_KEY_PREFIX", "ipcountry:"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		FetchURL:          os.Getenv("DATASTORE_FETCH_URL"),
+		FetchChecksumURL:  os.Getenv("DATASTORE_FETCH_CHECKSUM_URL"),
+		SpecialAddresses:  getEnv("SPECIAL_ADDRESSES", "lookup"),
+		RangeFormat:       getEnv("RANGE_FORMAT", "default"),
 	}
 
 	var err error
@@ -28,6 +119,91 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid RATE_LIMIT_RPS: %w", err)
 	}
 
+	config.BatchMaxSize, err = getEnvInt("BATCH_MAX_SIZE", 100)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BATCH_MAX_SIZE: %w", err)
+	}
+
+	config.StreamMaxLines, err = getEnvInt("STREAM_MAX_LINES", 1_000_000)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STREAM_MAX_LINES: %w", err)
+	}
+
+	config.CSVHeader, err = getEnvBool("CSV_HEADER", false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV_HEADER: %w", err)
+	}
+
+	config.CSVDelimiter, err = getEnvRune("CSV_DELIMITER")
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV_DELIMITER: %w", err)
+	}
+
+	config.CSVComment, err = getEnvRune("CSV_COMMENT")
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV_COMMENT: %w", err)
+	}
+
+	config.TrustedProxies, err = ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	config.DatastoreLayers, err = ParseLayers(os.Getenv("DATASTORE_LAYERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATASTORE_LAYERS: %w", err)
+	}
+
+	config.HTTPTimeout, err = getEnvDuration("HTTP_TIMEOUT", 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP_TIMEOUT: %w", err)
+	}
+
+	config.HTTPRetries, err = getEnvInt("HTTP_RETRIES", 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP_RETRIES: %w", err)
+	}
+
+	config.BreakerThreshold, err = getEnvInt("BREAKER_FAILURE_THRESHOLD", 5)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BREAKER_FAILURE_THRESHOLD: %w", err)
+	}
+
+	config.BreakerOpenTimeout, err = getEnvDuration("BREAKER_OPEN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BREAKER_OPEN_TIMEOUT: %w", err)
+	}
+
+	config.BreakerHalfOpenRequests, err = getEnvInt("BREAKER_HALF_OPEN_REQUESTS", 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BREAKER_HALF_OPEN_REQUESTS: %w", err)
+	}
+
+	config.CacheSize, err = getEnvInt("CACHE_SIZE", 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CACHE_SIZE: %w", err)
+	}
+
+	config.CacheTTL, err = getEnvDuration("CACHE_TTL", 5*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CACHE_TTL: %w", err)
+	}
+
+	config.CacheNegativeTTL, err = getEnvDuration("CACHE_NEGATIVE_TTL", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CACHE_NEGATIVE_TTL: %w", err)
+	}
+
+	config.FetchInterval, err = getEnvDuration("DATASTORE_FETCH_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATASTORE_FETCH_INTERVAL: %w", err)
+	}
+
+	config.ReloadInterval, err = getEnvDuration("DATASTORE_RELOAD_INTERVAL", 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATASTORE_RELOAD_INTERVAL: %w", err)
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
@@ -39,12 +215,186 @@ func (c *Config) Validate() error {
 	if c.RateLimitRPS <= 0 {
 		return fmt.Errorf("RATE_LIMIT_RPS must be positive, got: %f", c.RateLimitRPS)
 	}
-	if c.DatastoreType != "csv" && c.DatastoreType != "json" {
-		return fmt.Errorf("unsupported DATASTORE_TYPE: %s (supported: csv, json)", c.DatastoreType)
+	if c.BatchMaxSize < 0 {
+		return fmt.Errorf("BATCH_MAX_SIZE must not be negative, got: %d", c.BatchMaxSize)
+	}
+	if c.StreamMaxLines < 0 {
+		return fmt.Errorf("STREAM_MAX_LINES must not be negative, got: %d", c.StreamMaxLines)
+	}
+	if c.ReloadInterval < 0 {
+		return fmt.Errorf("DATASTORE_RELOAD_INTERVAL must not be negative, got: %s", c.ReloadInterval)
+	}
+	if c.DatastoreLoadMode != "" && c.DatastoreLoadMode != "strict" && c.DatastoreLoadMode != "lenient" {
+		return fmt.Errorf("unsupported DATASTORE_LOAD_MODE: %s (supported: strict, lenient)", c.DatastoreLoadMode)
+	}
+	if c.CSVDelimiter != 0 && c.CSVDelimiter == c.CSVComment {
+		return fmt.Errorf("CSV_DELIMITER and CSV_COMMENT must differ")
+	}
+	switch c.DuplicatePolicy {
+	case "", "error", "first-wins", "last-wins":
+	default:
+		return fmt.Errorf("unsupported DATASTORE_DUPLICATE_POLICY: %s (supported: error, first-wins, last-wins)", c.DuplicatePolicy)
+	}
+	if c.HTTPTimeout < 0 || c.HTTPRetries < 0 {
+		return fmt.Errorf("HTTP_TIMEOUT and HTTP_RETRIES must not be negative")
+	}
+	if c.BreakerThreshold < 0 || c.BreakerOpenTimeout < 0 || c.BreakerHalfOpenRequests < 0 {
+		return fmt.Errorf("BREAKER_FAILURE_THRESHOLD, BREAKER_OPEN_TIMEOUT and BREAKER_HALF_OPEN_REQUESTS must not be negative")
+	}
+	if c.CacheSize < 0 || c.CacheTTL < 0 || c.CacheNegativeTTL < 0 {
+		return fmt.Errorf("CACHE_SIZE, CACHE_TTL and CACHE_NEGATIVE_TTL must not be negative")
+	}
+	if c.FetchURL != "" {
+		if err := c.validateFetch(); err != nil {
+			return err
+		}
+	}
+	switch c.RangeFormat {
+	case "", "default", "ip2location", "dbip":
+	default:
+		return fmt.Errorf("unsupported RANGE_FORMAT: %s (supported: default, ip2location, dbip)", c.RangeFormat)
+	}
+	switch c.SpecialAddresses {
+	case "", "reject", "lookup":
+	default:
+		return fmt.Errorf("unsupported SPECIAL_ADDRESSES: %s (supported: reject, lookup)", c.SpecialAddresses)
+	}
+	switch c.DatastoreType {
+	case "csv", "json", "range", "mmdb", "compiled":
+	case "http":
+		if err := validateURLTemplate(c.DatastoreURL); err != nil {
+			return fmt.Errorf("invalid DATASTORE_URL: %w", err)
+		}
+	case "redis":
+		if _, err := redis.ParseURL(c.DatastoreURL); err != nil {
+			return fmt.Errorf("invalid DATASTORE_URL: %w", err)
+		}
+	case "composite":
+		if len(c.DatastoreLayers) == 0 {
+			return fmt.Errorf("DATASTORE_LAYERS is required for the composite datastore")
+		}
+		for _, layer := range c.DatastoreLayers {
+			switch layer.Type {
+			case "csv", "json", "range", "mmdb", "compiled":
+			case "http":
+				if err := validateURLTemplate(layer.File); err != nil {
+					return fmt.Errorf("invalid URL for layer %s: %w", layer.Name, err)
+				}
+			case "redis":
+				if _, err := redis.ParseURL(layer.File); err != nil {
+					return fmt.Errorf("invalid URL for layer %s: %w", layer.Name, err)
+				}
+			default:
+				return fmt.Errorf("unsupported type for layer %s: %s (supported: csv, json, range, mmdb, compiled, http, redis)", layer.Name, layer.Type)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported DATASTORE_TYPE: %s (supported: csv, json, range, mmdb, compiled, http, redis, composite)", c.DatastoreType)
 	}
 	return nil
 }
 
+// validateFetch checks the settings for downloading the data file
+func (c *Config) validateFetch() error {
+	switch c.DatastoreType {
+	case "csv", "json", "range", "mmdb", "compiled":
+	default:
+		return fmt.Errorf("DATASTORE_FETCH_URL needs a file datastore, not %s", c.DatastoreType)
+	}
+	if err := validateHTTPURL(c.FetchURL); err != nil {
+		return fmt.Errorf("invalid DATASTORE_FETCH_URL: %w", err)
+	}
+	if c.FetchChecksumURL != "" {
+		if err := validateHTTPURL(c.FetchChecksumURL); err != nil {
+			return fmt.Errorf("invalid DATASTORE_FETCH_CHECKSUM_URL: %w", err)
+		}
+	}
+	if c.FetchInterval <= 0 {
+		return fmt.Errorf("DATASTORE_FETCH_INTERVAL must be positive, got: %s", c.FetchInterval)
+	}
+	return nil
+}
+
+// validateHTTPURL checks for an absolute http or https URL
+func validateHTTPURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%q must be an absolute http or https URL", rawURL)
+	}
+	return nil
+}
+
+// validateURLTemplate checks an http datastore URL: an absolute http or
+// https URL containing the {ip} placeholder
+func validateURLTemplate(template string) error {
+	if !strings.Contains(template, "{ip}") {
+		return fmt.Errorf("%q must contain {ip}", template)
+	}
+	if err := validateHTTPURL(strings.ReplaceAll(template, "{ip}", "192.0.2.1")); err != nil {
+		return fmt.Errorf("%q must be an absolute http or https URL", template)
+	}
+	return nil
+}
+
+// ParseTrustedProxies parses a comma-separated list of networks and
+// single addresses, e.g. "10.0.0.0/8,192.0.2.7,2001:db8::/32". Each entry
+// is read by utils.ParseNetwork, so ::ffff:10.0.0.0/104 trusts 10.0.0.0/8.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var networks []netip.Prefix
+	for _, part := range strings.Split(value, ",") {
+		network, err := utils.ParseNetwork(part)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ParseLayers parses a comma-separated list of [name=]type:file layers,
+// highest priority first, e.g.
+// "overrides=csv:data/offices.csv,mmdb:data/GeoLite2-City.mmdb". Layers
+// without a name are named after their file.
+func ParseLayers(value string) ([]DatastoreLayer, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var layers []DatastoreLayer
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		var layer DatastoreLayer
+		spec := strings.TrimSpace(part)
+		// A name can't contain ':', so an '=' in an http layer's query
+		// string isn't mistaken for one
+		if name, rest, ok := strings.Cut(spec, "="); ok && !strings.Contains(name, ":") {
+			layer.Name, spec = strings.TrimSpace(name), rest
+		}
+
+		datastoreType, file, ok := strings.Cut(spec, ":")
+		layer.Type, layer.File = strings.TrimSpace(datastoreType), strings.TrimSpace(file)
+		if !ok || layer.Type == "" || layer.File == "" {
+			return nil, fmt.Errorf("invalid layer %q: expected [name=]type:file", strings.TrimSpace(part))
+		}
+		if layer.Name == "" {
+			layer.Name = filepath.Base(layer.File)
+		}
+		if seen[layer.Name] {
+			return nil, fmt.Errorf("duplicate layer name %q", layer.Name)
+		}
+		seen[layer.Name] = true
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -58,3 +408,40 @@ func getEnvFloat(key string, defaultValue float64) (float64, error) {
 	}
 	return defaultValue, nil
 }
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	if value := os.Getenv(key); value != "" {
+		return strconv.Atoi(value)
+	}
+	return defaultValue, nil
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	if value := os.Getenv(key); value != "" {
+		return time.ParseDuration(value)
+	}
+	return defaultValue, nil
+}
+
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	if value := os.Getenv(key); value != "" {
+		return strconv.ParseBool(value)
+	}
+	return defaultValue, nil
+}
+
+// getEnvRune reads a single character; "tab" and "\t" are accepted for TSV
+func getEnvRune(key string) (rune, error) {
+	value := os.Getenv(key)
+	switch value {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("expected a single character, got %q", value)
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, nil
+}
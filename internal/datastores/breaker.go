@@ -0,0 +1,184 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed passes every lookup through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails every lookup fast with errors.ErrCircuitOpen
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a few trial lookups through to probe recovery
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig tunes a BreakerDataStore; zero fields take defaults
+type BreakerConfig struct {
+	// FailureThreshold is how many consecutive failed lookups open the
+	// breaker
+	FailureThreshold int
+	// OpenTimeout is how long an open breaker fails fast before letting
+	// trial lookups through
+	OpenTimeout time.Duration
+	// HalfOpenRequests is how many trial lookups may run at once while
+	// half-open. The first to succeed closes the breaker and any failure
+	// opens it again.
+	HalfOpenRequests int
+}
+
+// BreakerDataStore guards a remote datastore with a circuit breaker, so a
+// sick backend costs callers an immediate errors.ErrCircuitOpen instead of
+// a timeout each. Not-found answers count as successes; invalid addresses
+// and lookups cancelled by the caller don't count at all.
+type BreakerDataStore struct {
+	store  DataStore
+	config BreakerConfig
+	now    func() time.Time
+
+	mutex    sync.Mutex
+	state    BreakerState
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the breaker last opened
+	trials   int       // trial lookups in flight while half-open
+	trips    int       // times the breaker has opened
+	loadTracker
+}
+
+func NewBreakerDataStore(store DataStore, config BreakerConfig) *BreakerDataStore {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+	return &BreakerDataStore{
+		store:  store,
+		config: config,
+		now:    time.Now,
+		state:  BreakerClosed,
+	}
+}
+
+// Load loads the wrapped datastore; loads bypass the breaker
+func (b *BreakerDataStore) Load(ctx context.Context) error {
+	err := b.store.Load(ctx)
+	if err != nil {
+		b.recordFailure(err, nil)
+		return err
+	}
+	b.recordSuccess(0, nil)
+	return nil
+}
+
+func (b *BreakerDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	trial, err := b.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := b.store.FindLocation(ctx, ip)
+	b.release(ctx, trial, err)
+	return location, err
+}
+
+// acquire admits a lookup, reporting whether it is a half-open trial
+func (b *BreakerDataStore) acquire() (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return false, errors.ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		fallthrough
+	case BreakerHalfOpen:
+		if b.trials >= b.config.HalfOpenRequests {
+			return false, errors.ErrCircuitOpen
+		}
+		b.trials++
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// release records the outcome of an admitted lookup. Lookups admitted
+// before the breaker changed state no longer say anything about it and
+// are ignored.
+func (b *BreakerDataStore) release(ctx context.Context, trial bool, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if trial {
+		b.trials--
+	}
+	if trial != (b.state == BreakerHalfOpen) {
+		return
+	}
+
+	switch {
+	case err == nil, stderrors.Is(err, errors.ErrIPNotFound):
+		b.state = BreakerClosed
+		b.failures = 0
+	case stderrors.Is(err, errors.ErrInvalidIP), stderrors.Is(ctx.Err(), context.Canceled):
+		// Says nothing about the backend's health
+	default:
+		b.failures++
+		if trial || b.failures >= b.config.FailureThreshold {
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+			b.failures = 0
+			b.trips++
+		}
+	}
+}
+
+// Close closes the wrapped datastore
+func (b *BreakerDataStore) Close() error {
+	return b.store.Close()
+}
+
+// LoadStatus is the wrapped datastore's status, when it reports one, with
+// the breaker's state added
+func (b *BreakerDataStore) LoadStatus() models.LoadStatus {
+	status := b.loadTracker.LoadStatus()
+	if reporter, ok := b.store.(StatusReporter); ok {
+		status = reporter.LoadStatus()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breaker := &models.BreakerStatus{
+		State:               string(b.state),
+		ConsecutiveFailures: b.failures,
+		Trips:               b.trips,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		breaker.OpenedAt = &openedAt
+	}
+	status.Breaker = breaker
+	return status
+}
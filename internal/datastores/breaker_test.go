@@ -0,0 +1,154 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+// setupTestBreaker wraps a stub in a breaker with a controllable clock
+func setupTestBreaker(config BreakerConfig) (*BreakerDataStore, *stubDataStore, *time.Time) {
+	stub := &stubDataStore{location: &models.Location{Country: "Germany"}}
+	breaker := NewBreakerDataStore(stub, config)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time { return clock }
+	return breaker, stub, &clock
+}
+
+func expectBreakerState(t *testing.T, breaker *BreakerDataStore, expected BreakerState) {
+	t.Helper()
+	if state := breaker.LoadStatus().Breaker.State; state != string(expected) {
+		t.Fatalf("expected breaker %s, got %s", expected, state)
+	}
+}
+
+func TestBreakerDataStore_Trips(t *testing.T) {
+	breaker, stub, _ := setupTestBreaker(BreakerConfig{FailureThreshold: 3})
+	stub.err = appErrors.ErrUpstream
+
+	for range 3 {
+		if _, err := breaker.FindLocation(context.Background(), "8.8.8.8"); !stderrors.Is(err, appErrors.ErrUpstream) {
+			t.Fatalf("expected the upstream error while closed, got %v", err)
+		}
+	}
+	expectBreakerState(t, breaker, BreakerOpen)
+
+	if _, err := breaker.FindLocation(context.Background(), "8.8.8.8"); !stderrors.Is(err, appErrors.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if stub.lookups != 3 {
+		t.Errorf("expected an open breaker not to reach the datastore, got %d lookups", stub.lookups)
+	}
+
+	status := breaker.LoadStatus().Breaker
+	if status.Trips != 1 || status.OpenedAt == nil {
+		t.Errorf("unexpected breaker status: %+v", status)
+	}
+}
+
+func TestBreakerDataStore_FailuresMustBeConsecutive(t *testing.T) {
+	breaker, stub, _ := setupTestBreaker(BreakerConfig{FailureThreshold: 2})
+
+	for _, err := range []error{appErrors.ErrUpstream, appErrors.ErrIPNotFound, appErrors.ErrUpstream, nil, appErrors.ErrUpstream} {
+		stub.err = err
+		_, _ = breaker.FindLocation(context.Background(), "8.8.8.8")
+	}
+	expectBreakerState(t, breaker, BreakerClosed)
+
+	// Neither invalid input nor callers giving up say anything about
+	// the backend
+	stub.err = appErrors.ErrInvalidIP
+	_, _ = breaker.FindLocation(context.Background(), "bogus")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stub.err = context.Canceled
+	_, _ = breaker.FindLocation(ctx, "8.8.8.8")
+	expectBreakerState(t, breaker, BreakerClosed)
+
+	stub.err = appErrors.ErrUpstream
+	_, _ = breaker.FindLocation(context.Background(), "8.8.8.8")
+	expectBreakerState(t, breaker, BreakerOpen)
+}
+
+func TestBreakerDataStore_HalfOpen(t *testing.T) {
+	breaker, stub, clock := setupTestBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: 10 * time.Second})
+	stub.err = appErrors.ErrUpstream
+	_, _ = breaker.FindLocation(context.Background(), "8.8.8.8")
+	expectBreakerState(t, breaker, BreakerOpen)
+
+	// Still failing after the timeout: the trial reopens the breaker
+	*clock = clock.Add(10 * time.Second)
+	if _, err := breaker.FindLocation(context.Background(), "8.8.8.8"); !stderrors.Is(err, appErrors.ErrUpstream) {
+		t.Fatalf("expected a trial lookup, got %v", err)
+	}
+	expectBreakerState(t, breaker, BreakerOpen)
+	*clock = clock.Add(9 * time.Second)
+	if _, err := breaker.FindLocation(context.Background(), "8.8.8.8"); !stderrors.Is(err, appErrors.ErrCircuitOpen) {
+		t.Errorf("expected the reopened breaker to fail fast, got %v", err)
+	}
+
+	// Recovered: the trial closes it
+	*clock = clock.Add(time.Second)
+	stub.err = nil
+	location, err := breaker.FindLocation(context.Background(), "8.8.8.8")
+	if err != nil || location.Country != "Germany" {
+		t.Fatalf("expected a successful trial, got %+v, %v", location, err)
+	}
+	expectBreakerState(t, breaker, BreakerClosed)
+	if status := breaker.LoadStatus().Breaker; status.Trips != 2 || status.OpenedAt != nil {
+		t.Errorf("unexpected breaker status: %+v", status)
+	}
+}
+
+func TestBreakerDataStore_HalfOpenLimitsTrials(t *testing.T) {
+	breaker, _, clock := setupTestBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Second, HalfOpenRequests: 2})
+	breaker.mutex.Lock()
+	breaker.state, breaker.openedAt = BreakerOpen, *clock
+	breaker.mutex.Unlock()
+	*clock = clock.Add(time.Second)
+
+	for i, expected := range []bool{true, true} {
+		trial, err := breaker.acquire()
+		if err != nil || trial != expected {
+			t.Fatalf("acquire %d: expected trial, got %v, %v", i, trial, err)
+		}
+	}
+	if _, err := breaker.acquire(); !stderrors.Is(err, appErrors.ErrCircuitOpen) {
+		t.Errorf("expected lookups beyond the trial limit to fail fast, got %v", err)
+	}
+
+	// A late result from before the breaker opened is ignored
+	breaker.release(context.Background(), false, nil)
+	expectBreakerState(t, breaker, BreakerHalfOpen)
+
+	breaker.release(context.Background(), true, nil)
+	expectBreakerState(t, breaker, BreakerClosed)
+	// The other trial finishing afterwards doesn't reopen it
+	breaker.release(context.Background(), true, appErrors.ErrUpstream)
+	expectBreakerState(t, breaker, BreakerClosed)
+}
+
+func TestBreakerDataStore_LoadStatus(t *testing.T) {
+	breaker, _, _ := setupTestBreaker(BreakerConfig{})
+	if err := breaker.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	status := breaker.LoadStatus()
+	if status.LastSuccess.IsZero() || status.Breaker == nil || status.Breaker.State != string(BreakerClosed) {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	// Datastores reporting their own status keep it
+	source := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n")
+	wrapped := NewBreakerDataStore(source, BreakerConfig{})
+	if err := wrapped.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	if status := wrapped.LoadStatus(); status.Entries != 1 || status.Breaker == nil {
+		t.Errorf("expected the wrapped status with breaker state, got %+v", status)
+	}
+}
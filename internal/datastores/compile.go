@@ -0,0 +1,63 @@
+package datastores
+
+import (
+	"fmt"
+	"io"
+
+	"ip_country_project/internal/errors"
+)
+
+// indexSource is implemented by datastores whose loaded data can be
+// exported for compiling
+type indexSource interface {
+	snapshot() (*rangeIndex, error)
+}
+
+// Compile writes the data currently loaded in source as a compiled index
+// that CompiledDataStore can serve
+func Compile(source DataStore, w io.Writer) error {
+	s, ok := source.(indexSource)
+	if !ok {
+		return fmt.Errorf("datastore %T cannot be compiled", source)
+	}
+
+	idx, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	if idx.records == 0 {
+		return errors.ErrEmptyDataset
+	}
+	return writeCompiledIndex(w, idx)
+}
+
+func (c *CSVDataStore) snapshot() (*rangeIndex, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.index, nil
+}
+
+func (j *JSONDataStore) snapshot() (*rangeIndex, error) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+	return j.index, nil
+}
+
+func (r *RangeDataStore) snapshot() (*rangeIndex, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.index, nil
+}
+
+// snapshot flattens the search tree into an index. Records without a
+// country or city are left out, matching FindLocation.
+func (m *MMDBDataStore) snapshot() (*rangeIndex, error) {
+	m.mutex.RLock()
+	reader := m.reader
+	m.mutex.RUnlock()
+
+	if reader == nil {
+		return newPrefixIndex(nil, newLocationTable()), nil
+	}
+	return reader.index()
+}
@@ -0,0 +1,103 @@
+package datastores
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+// CompiledDataStore serves a compiled index produced by Compile. The file
+// is memory-mapped and searched in place, so loading costs one checksum
+// pass instead of parsing every row.
+type CompiledDataStore struct {
+	filePath string
+	index    *compiledIndex
+	unmap    func() error
+	mutex    sync.RWMutex
+	loadTracker
+}
+
+func NewCompiledDataStore(filePath string) *CompiledDataStore {
+	return &CompiledDataStore{
+		filePath: filePath,
+	}
+}
+
+// Load maps and validates the compiled index before publishing it. On
+// failure the previously loaded index keeps serving.
+func (c *CompiledDataStore) Load(ctx context.Context) error {
+	data, unmap, err := mapFile(c.filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open compiled index: %w", err)
+		c.recordFailure(err, nil)
+		return err
+	}
+
+	index, err := parseCompiledIndex(data)
+	if err == nil && index.header.records == 0 {
+		err = errors.ErrEmptyDataset
+	}
+	if err != nil {
+		_ = unmap()
+		c.recordFailure(err, nil)
+		return err
+	}
+
+	c.mutex.Lock()
+	previous := c.unmap
+	c.index = index
+	c.unmap = unmap
+	c.mutex.Unlock()
+
+	// Lookups copy everything they return out of the mapping under the
+	// read lock, so nothing can still reference the old one
+	if previous != nil {
+		if err := previous(); err != nil {
+			log.Printf("Failed to unmap previous compiled index: %v", err)
+		}
+	}
+
+	c.recordSuccess(int(index.header.records), nil)
+	return nil
+}
+
+func (c *CompiledDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.index == nil {
+		return nil, errors.ErrIPNotFound
+	}
+	match, exists := c.index.lookup(addr)
+	if !exists {
+		return nil, errors.ErrIPNotFound
+	}
+
+	location := c.index.location(match.location)
+	location.IP = addr.String()
+	return location, nil
+}
+
+// Close unmaps the index; the datastore must not be used afterwards
+func (c *CompiledDataStore) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.index = nil
+	if c.unmap == nil {
+		return nil
+	}
+	err := c.unmap()
+	c.unmap = nil
+	return err
+}
@@ -0,0 +1,334 @@
+package datastores
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/netip"
+	"sort"
+
+	"ip_country_project/internal/models"
+)
+
+// Compiled index layout. All integers are little-endian.
+//
+//	header     compiledHeaderSize bytes, see below
+//	ranges     rangeCount × compiledRangeSize, sorted by (family, start)
+//	locations  locationCount × compiledLocationSize
+//	extras     extraCount × compiledExtraSize (key, value) string pairs
+//	strings    stringsSize bytes of uvarint-length-prefixed strings
+//
+// The header holds the magic, format version, a reserved flags field,
+// the record and section counts, and a CRC-32C of everything after it.
+// The locations and strings sections are the index's locationTable, so a
+// country name is stored once however many ranges refer to it.
+const (
+	compiledMagic   = "IPCI"
+	compiledVersion = 1
+
+	compiledHeaderSize   = 32
+	compiledRangeSize    = 40
+	compiledLocationSize = 16
+	compiledExtraSize    = 8
+
+	// compiledNoNetwork marks ranges that didn't come from a CIDR entry
+	compiledNoNetwork = 0xFF
+)
+
+var compiledChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+type compiledHeader struct {
+	version       uint16
+	records       uint32
+	rangeCount    uint32
+	locationCount uint32
+	extraCount    uint32
+	stringsSize   uint32
+	checksum      uint32
+}
+
+// writeCompiledIndex serializes an index in the compiled format. The
+// index's locationTable is already interned, so its records map directly
+// onto the locations and extras sections.
+func writeCompiledIndex(w io.Writer, idx *rangeIndex) error {
+	table := idx.locations
+	strs := newStringTable()
+	offsets := make([]uint32, len(table.strings))
+	for i, s := range table.strings {
+		offsets[i] = strs.intern(s)
+	}
+
+	ranges := make([]byte, 0, len(idx.ranges)*compiledRangeSize)
+	for _, r := range idx.ranges {
+		var record [compiledRangeSize]byte
+		start, end := r.start.As16(), r.end.As16()
+		copy(record[0:16], start[:])
+		copy(record[16:32], end[:])
+		binary.LittleEndian.PutUint32(record[32:], r.location)
+		record[36] = compiledNoNetwork
+		if r.bits != noNetwork {
+			record[36] = byte(r.bits)
+		}
+		record[37] = 6
+		if r.start.Is4() {
+			record[37] = 4
+		}
+		ranges = append(ranges, record[:]...)
+	}
+
+	locations := make([]byte, 0, len(table.locations)*compiledLocationSize)
+	for _, location := range table.locations {
+		locations = binary.LittleEndian.AppendUint32(locations, offsets[location.country])
+		locations = binary.LittleEndian.AppendUint32(locations, offsets[location.city])
+		locations = binary.LittleEndian.AppendUint32(locations, location.extraStart)
+		locations = binary.LittleEndian.AppendUint32(locations, location.extraCount)
+	}
+
+	extras := make([]byte, 0, len(table.extras)*compiledExtraSize)
+	for _, pair := range table.extras {
+		extras = binary.LittleEndian.AppendUint32(extras, offsets[pair.name])
+		extras = binary.LittleEndian.AppendUint32(extras, offsets[pair.value])
+	}
+
+	sections := [][]byte{ranges, locations, extras, strs.data.Bytes()}
+	checksum := crc32.New(compiledChecksumTable)
+	for _, section := range sections {
+		checksum.Write(section)
+	}
+
+	var header [compiledHeaderSize]byte
+	copy(header[0:4], compiledMagic)
+	binary.LittleEndian.PutUint16(header[4:], compiledVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(idx.records))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(idx.ranges)))
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(table.locations)))
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(table.extras)))
+	binary.LittleEndian.PutUint32(header[24:], uint32(strs.data.Len()))
+	binary.LittleEndian.PutUint32(header[28:], checksum.Sum32())
+
+	buffered := bufio.NewWriter(w)
+	for _, section := range append([][]byte{header[:]}, sections...) {
+		if _, err := buffered.Write(section); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// stringTable interns strings into a length-prefixed blob and hands out
+// their offsets
+type stringTable struct {
+	data    bytes.Buffer
+	offsets map[string]uint32
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{offsets: make(map[string]uint32)}
+}
+
+func (t *stringTable) intern(s string) uint32 {
+	if offset, ok := t.offsets[s]; ok {
+		return offset
+	}
+	offset := uint32(t.data.Len())
+	t.data.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.data.WriteString(s)
+	t.offsets[s] = offset
+	return offset
+}
+
+// compiledIndex answers lookups directly from a compiled index buffer,
+// typically a read-only memory mapping. Sections are validated once when
+// parsed, so lookups can index them without further bounds checks.
+type compiledIndex struct {
+	header    compiledHeader
+	ranges    []byte
+	locations []byte
+	extras    []byte
+	strings   []byte
+	countries countryIndex
+}
+
+// parseCompiledIndex checks the header, checksum and every cross-reference
+// of a compiled index
+func parseCompiledIndex(buffer []byte) (*compiledIndex, error) {
+	if len(buffer) < compiledHeaderSize || string(buffer[0:4]) != compiledMagic {
+		return nil, fmt.Errorf("not a compiled index")
+	}
+
+	header := compiledHeader{
+		version:       binary.LittleEndian.Uint16(buffer[4:]),
+		records:       binary.LittleEndian.Uint32(buffer[8:]),
+		rangeCount:    binary.LittleEndian.Uint32(buffer[12:]),
+		locationCount: binary.LittleEndian.Uint32(buffer[16:]),
+		extraCount:    binary.LittleEndian.Uint32(buffer[20:]),
+		stringsSize:   binary.LittleEndian.Uint32(buffer[24:]),
+		checksum:      binary.LittleEndian.Uint32(buffer[28:]),
+	}
+	if header.version != compiledVersion {
+		return nil, fmt.Errorf("unsupported compiled index version %d (supported: %d)", header.version, compiledVersion)
+	}
+	if flags := binary.LittleEndian.Uint16(buffer[6:]); flags != 0 {
+		return nil, fmt.Errorf("unsupported compiled index flags %#x", flags)
+	}
+
+	sizes := []int{
+		int(header.rangeCount) * compiledRangeSize,
+		int(header.locationCount) * compiledLocationSize,
+		int(header.extraCount) * compiledExtraSize,
+		int(header.stringsSize),
+	}
+	expected := compiledHeaderSize
+	for _, size := range sizes {
+		expected += size
+	}
+	if len(buffer) != expected {
+		return nil, fmt.Errorf("compiled index is %d bytes, header describes %d", len(buffer), expected)
+	}
+
+	body := buffer[compiledHeaderSize:]
+	if sum := crc32.Checksum(body, compiledChecksumTable); sum != header.checksum {
+		return nil, fmt.Errorf("compiled index checksum mismatch: %#08x, expected %#08x", sum, header.checksum)
+	}
+
+	idx := &compiledIndex{header: header}
+	sections := []*[]byte{&idx.ranges, &idx.locations, &idx.extras, &idx.strings}
+	for i, size := range sizes {
+		*sections[i] = body[:size]
+		body = body[size:]
+	}
+
+	if err := idx.validate(); err != nil {
+		return nil, fmt.Errorf("corrupt compiled index: %w", err)
+	}
+	return idx, nil
+}
+
+// validate checks ordering and references so lookups can't go out of
+// bounds, even for a file that was written with a valid checksum by a
+// buggy producer
+func (idx *compiledIndex) validate() error {
+	checkString := func(offset uint32) error {
+		if _, ok := idx.string(offset); !ok {
+			return fmt.Errorf("string offset %d out of range", offset)
+		}
+		return nil
+	}
+
+	for i := range int(idx.header.extraCount) {
+		pair := idx.extras[i*compiledExtraSize:]
+		for _, offset := range []uint32{binary.LittleEndian.Uint32(pair[0:]), binary.LittleEndian.Uint32(pair[4:])} {
+			if err := checkString(offset); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range int(idx.header.locationCount) {
+		record := idx.locations[i*compiledLocationSize:]
+		for _, offset := range []uint32{binary.LittleEndian.Uint32(record[0:]), binary.LittleEndian.Uint32(record[4:])} {
+			if err := checkString(offset); err != nil {
+				return err
+			}
+		}
+		start := uint64(binary.LittleEndian.Uint32(record[8:]))
+		count := uint64(binary.LittleEndian.Uint32(record[12:]))
+		if start+count > uint64(idx.header.extraCount) {
+			return fmt.Errorf("location %d extras out of range", i)
+		}
+	}
+
+	var previous ipRange
+	for i := range int(idx.header.rangeCount) {
+		record := idx.ranges[i*compiledRangeSize:]
+		if family := record[37]; family != 4 && family != 6 {
+			return fmt.Errorf("range %d has unknown address family %d", i, family)
+		}
+		if location := binary.LittleEndian.Uint32(record[32:]); location >= idx.header.locationCount {
+			return fmt.Errorf("range %d location %d out of range", i, location)
+		}
+
+		r := idx.rangeAt(i)
+		if bits := record[36]; bits != compiledNoNetwork && bits > uint8(r.start.BitLen()) {
+			return fmt.Errorf("range %d has invalid network length %d", i, bits)
+		}
+		if r.end.Less(r.start) || r.start.BitLen() != r.end.BitLen() {
+			return fmt.Errorf("range %s-%s is inverted", r.start, r.end)
+		}
+		if i > 0 && !previous.end.Less(r.start) {
+			return fmt.Errorf("range %s-%s overlaps its predecessor", r.start, r.end)
+		}
+		previous = r
+	}
+	return nil
+}
+
+// rangeAt decodes range i
+func (idx *compiledIndex) rangeAt(i int) ipRange {
+	record := idx.ranges[i*compiledRangeSize : (i+1)*compiledRangeSize]
+	start := netip.AddrFrom16([16]byte(record[0:16]))
+	end := netip.AddrFrom16([16]byte(record[16:32]))
+	if record[37] == 4 {
+		start, end = start.Unmap(), end.Unmap()
+	}
+
+	r := ipRange{start: start, end: end, location: binary.LittleEndian.Uint32(record[32:]), bits: noNetwork}
+	if bits := record[36]; bits != compiledNoNetwork {
+		r.bits = int16(bits)
+	}
+	return r
+}
+
+// lookup finds the range containing addr
+func (idx *compiledIndex) lookup(addr netip.Addr) (ipRange, bool) {
+	count := int(idx.header.rangeCount)
+	i := sort.Search(count, func(i int) bool {
+		return addr.Less(idx.rangeAt(i).start)
+	})
+	if i == 0 {
+		return ipRange{}, false
+	}
+
+	r := idx.rangeAt(i - 1)
+	if r.end.Less(addr) {
+		return ipRange{}, false
+	}
+	return r, true
+}
+
+// location copies location id out of the buffer
+func (idx *compiledIndex) location(id uint32) *models.Location {
+	record := idx.locations[int(id)*compiledLocationSize:]
+	country, _ := idx.string(binary.LittleEndian.Uint32(record[0:]))
+	city, _ := idx.string(binary.LittleEndian.Uint32(record[4:]))
+	location := &models.Location{Country: country, City: city}
+
+	start := int(binary.LittleEndian.Uint32(record[8:]))
+	count := int(binary.LittleEndian.Uint32(record[12:]))
+	if count > 0 {
+		location.Extra = make(map[string]string, count)
+		for i := start; i < start+count; i++ {
+			pair := idx.extras[i*compiledExtraSize:]
+			name, _ := idx.string(binary.LittleEndian.Uint32(pair[0:]))
+			value, _ := idx.string(binary.LittleEndian.Uint32(pair[4:]))
+			location.Extra[name] = value
+		}
+	}
+	return location
+}
+
+// string copies the string at offset out of the strings section
+func (idx *compiledIndex) string(offset uint32) (string, bool) {
+	if uint64(offset) >= uint64(len(idx.strings)) {
+		return "", false
+	}
+	data := idx.strings[offset:]
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return "", false
+	}
+	return string(data[n : n+int(length)]), true
+}
@@ -0,0 +1,229 @@
+package datastores
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appErrors "ip_country_project/internal/errors"
+)
+
+// compileTestIndex compiles a loaded datastore into a temp file and
+// returns a loaded CompiledDataStore for it
+func compileTestIndex(t *testing.T, source DataStore) *CompiledDataStore {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Compile(source, &buf); err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.idx")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	ds := NewCompiledDataStore(path)
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load compiled index: %v", err)
+	}
+	t.Cleanup(func() { _ = ds.Close() })
+	return ds
+}
+
+func TestCompiledDataStore_MatchesSource(t *testing.T) {
+	testData := "network,country,city,asn\n" +
+		"8.8.8.0/24,United States,Mountain View,15169\n" +
+		"8.8.8.8,United States,Anycast,15169\n" +
+		"1.1.1.0/24,Australia,Sydney,13335\n" +
+		"2001:db8::/32,Nowhere,,64496\n"
+	source := setupTestDatastore(t, testData)
+	source.options.csvFormat = CSVFormat{
+		Header:  true,
+		Columns: CSVColumns{"ip": "network", "country": "country", "city": "city", "asn": "asn"},
+	}
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	ds := compileTestIndex(t, source)
+
+	for _, ip := range []string{"8.8.8.1", "8.8.8.8", "8.8.8.255", "1.1.1.1", "2001:db8::1", "9.9.9.9", "2001:db9::1"} {
+		expected, expectedErr := source.FindLocation(context.Background(), ip)
+		got, err := ds.FindLocation(context.Background(), ip)
+
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", ip, expectedErr, err)
+			continue
+		}
+		if expectedErr != nil {
+			continue
+		}
+		if got.IP != ip || got.Country != expected.Country || got.City != expected.City || got.Extra["asn"] != expected.Extra["asn"] {
+			t.Errorf("%s: expected %+v, got %+v", ip, expected, got)
+		}
+	}
+
+	if entries := ds.LoadStatus().Entries; entries != 4 {
+		t.Errorf("expected 4 entries, got %d", entries)
+	}
+}
+
+func TestCompiledDataStore_FromMMDB(t *testing.T) {
+	source := setupTestMMDBDatastore(t, 6, 28, testMMDBNetworks())
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load MMDB: %v", err)
+	}
+
+	ds := compileTestIndex(t, source)
+
+	testCases := map[string][2]string{
+		"8.8.8.8":     {"United States", "Mountain View"},
+		"77.88.8.8":   {"Russia", "Moscow"},
+		"2001:db8::1": {"Germany", "Berlin"},
+		"9.9.9.9":     {"CH", ""},
+	}
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.Country != expected[0] || location.City != expected[1] {
+			t.Errorf("expected %v for %s, got %s/%s", expected, ip, location.Country, location.City)
+		}
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "4.4.4.4"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound, got %v", err)
+	}
+}
+
+func TestCompiledFormat_InternsStrings(t *testing.T) {
+	var testData strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&testData, "10.0.%d.%d,Tel Aviv,Israel\n", i/256, i%256)
+	}
+	source := setupTestDatastore(t, testData.String())
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Compile(source, &buf); err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	idx, err := parseCompiledIndex(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse compiled index: %v", err)
+	}
+	if idx.header.locationCount != 1 {
+		t.Errorf("expected 1 interned location, got %d", idx.header.locationCount)
+	}
+	if count := bytes.Count(idx.strings, []byte("Israel")); count != 1 {
+		t.Errorf("expected 'Israel' stored once, found %d copies", count)
+	}
+}
+
+func TestCompiledDataStore_Load_Corrupt(t *testing.T) {
+	source := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n")
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Compile(source, &buf); err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	valid := buf.Bytes()
+
+	corruptions := map[string]func([]byte) []byte{
+		"empty file": func(b []byte) []byte { return nil },
+		"bad magic":  func(b []byte) []byte { b[0] = 'X'; return b },
+		"future version": func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[4:], compiledVersion+1)
+			return b
+		},
+		"truncated":   func(b []byte) []byte { return b[:len(b)-1] },
+		"checksum":    func(b []byte) []byte { b[len(b)-1] ^= 0xFF; return b },
+		"csv instead": func(b []byte) []byte { return []byte("8.8.8.8,Mountain View,United States\n") },
+		"range location": func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[compiledHeaderSize+32:], 7)
+			binary.LittleEndian.PutUint32(b[28:], crc32.Checksum(b[compiledHeaderSize:], compiledChecksumTable))
+			return b
+		},
+	}
+
+	for name, corrupt := range corruptions {
+		path := filepath.Join(t.TempDir(), "index.idx")
+		if err := os.WriteFile(path, corrupt(bytes.Clone(valid)), 0o644); err != nil {
+			t.Fatalf("failed to write index: %v", err)
+		}
+
+		ds := NewCompiledDataStore(path)
+		if err := ds.Load(context.Background()); err == nil {
+			t.Errorf("%s: expected load error", name)
+		}
+		if ds.LoadStatus().LastError == "" {
+			t.Errorf("%s: expected load status to record the failure", name)
+		}
+	}
+}
+
+func TestCompiledDataStore_ReloadKeepsServing(t *testing.T) {
+	first := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n")
+	if err := first.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	ds := compileTestIndex(t, first)
+
+	second := setupTestDatastore(t, "1.1.1.1,Sydney,Australia\n")
+	if err := second.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Compile(second, &buf); err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	replaceFile(t, ds.filePath, buf.Bytes())
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); err != nil {
+		t.Errorf("expected new data after reload, got error: %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected old data to be gone, got: %v", err)
+	}
+
+	// A broken replacement leaves the current index serving
+	replaceFile(t, ds.filePath, []byte("garbage"))
+	if err := ds.Load(context.Background()); err == nil {
+		t.Fatal("expected reload of garbage to fail")
+	}
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); err != nil {
+		t.Errorf("expected previous index to keep serving, got error: %v", err)
+	}
+}
+
+// replaceFile swaps in new contents by rename; writing in place would
+// truncate a file that is still mapped
+func replaceFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("failed to replace file: %v", err)
+	}
+}
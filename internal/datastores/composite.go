@@ -0,0 +1,100 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+// Layer is one named datastore in a CompositeDataStore
+type Layer struct {
+	Name  string
+	Store DataStore
+}
+
+// CompositeDataStore chains datastores in priority order, typically a
+// small hand-curated override file on top of a vendor dataset. The first
+// layer with an entry answers and is named in the location's Source;
+// ErrIPNotFound falls through to the next layer, any other error is
+// returned as is.
+type CompositeDataStore struct {
+	layers []Layer
+}
+
+func NewCompositeDataStore(layers ...Layer) *CompositeDataStore {
+	return &CompositeDataStore{
+		layers: layers,
+	}
+}
+
+// Load loads every layer, even after one fails, so a broken override file
+// doesn't stop the vendor dataset from refreshing. Each failed layer keeps
+// serving its previous data. When some layers loaded and others failed the
+// error wraps errors.ErrPartialLoad, as new data has still been published.
+func (c *CompositeDataStore) Load(ctx context.Context) error {
+	var errs []error
+	for _, layer := range c.layers {
+		if err := layer.Store.Load(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("layer %s: %w", layer.Name, err))
+		}
+	}
+	if len(errs) > 0 && len(errs) < len(c.layers) {
+		return fmt.Errorf("%w: %w", errors.ErrPartialLoad, stderrors.Join(errs...))
+	}
+	return stderrors.Join(errs...)
+}
+
+func (c *CompositeDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	for _, layer := range c.layers {
+		location, err := layer.Store.FindLocation(ctx, ip)
+		if stderrors.Is(err, errors.ErrIPNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		location.Source = layer.Name
+		return location, nil
+	}
+	return nil, errors.ErrIPNotFound
+}
+
+func (c *CompositeDataStore) Close() error {
+	var errs []error
+	for _, layer := range c.layers {
+		if err := layer.Store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("layer %s: %w", layer.Name, err))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// LoadStatus sums the layers' entries and reports the most recent attempt,
+// the oldest success and the first layer error. Per-layer statuses are
+// listed under Layers.
+func (c *CompositeDataStore) LoadStatus() models.LoadStatus {
+	var status models.LoadStatus
+	for _, layer := range c.layers {
+		reporter, ok := layer.Store.(StatusReporter)
+		if !ok {
+			continue
+		}
+		layerStatus := reporter.LoadStatus()
+		status.Layers = append(status.Layers, models.LayerStatus{Name: layer.Name, LoadStatus: layerStatus})
+
+		status.Entries += layerStatus.Entries
+		if layerStatus.LastAttempt.After(status.LastAttempt) {
+			status.LastAttempt = layerStatus.LastAttempt
+		}
+		if len(status.Layers) == 1 || layerStatus.LastSuccess.Before(status.LastSuccess) {
+			status.LastSuccess = layerStatus.LastSuccess
+		}
+		if status.LastError == "" && layerStatus.LastError != "" {
+			status.LastError = fmt.Sprintf("layer %s: %s", layer.Name, layerStatus.LastError)
+		}
+	}
+	return status
+}
@@ -0,0 +1,138 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"strings"
+	"testing"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+// stubDataStore answers every lookup with a fixed result
+type stubDataStore struct {
+	location *models.Location
+	err      error
+	loadErr  error
+	loads    int
+	lookups  int
+	closed   bool
+}
+
+func (s *stubDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	s.lookups++
+	if s.err != nil {
+		return nil, s.err
+	}
+	location := *s.location
+	return &location, nil
+}
+
+func (s *stubDataStore) Load(ctx context.Context) error {
+	s.loads++
+	return s.loadErr
+}
+
+func (s *stubDataStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestCompositeDataStore_FindLocation_Priority(t *testing.T) {
+	overrides := setupTestDatastore(t, "10.1.0.0/16,Office,Germany\n8.8.8.8,VPN Exit,Netherlands\n")
+	vendor := setupTestDatastore(t, "8.8.8.0/24,Mountain View,United States\n1.1.1.1,Sydney,Australia\n")
+	ds := NewCompositeDataStore(Layer{Name: "overrides", Store: overrides}, Layer{Name: "vendor", Store: vendor})
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load layers: %v", err)
+	}
+
+	testCases := map[string][2]string{
+		"8.8.8.8":  {"VPN Exit", "overrides"},
+		"8.8.8.9":  {"Mountain View", "vendor"},
+		"1.1.1.1":  {"Sydney", "vendor"},
+		"10.1.2.3": {"Office", "overrides"},
+	}
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.City != expected[0] || location.Source != expected[1] {
+			t.Errorf("expected %s from %s for %s, got %s from %s", expected[0], expected[1], ip, location.City, location.Source)
+		}
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "9.9.9.9"); !stderrors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound when no layer matches, got %v", err)
+	}
+}
+
+func TestCompositeDataStore_FindLocation_PropagatesErrors(t *testing.T) {
+	failure := stderrors.New("upstream unavailable")
+	broken := &stubDataStore{err: failure}
+	fallback := &stubDataStore{location: &models.Location{Country: "Fallback"}}
+	ds := NewCompositeDataStore(Layer{Name: "broken", Store: broken}, Layer{Name: "fallback", Store: fallback})
+
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !stderrors.Is(err, failure) {
+		t.Errorf("expected the layer's error, got %v", err)
+	}
+	if fallback.lookups != 0 {
+		t.Error("expected a real error not to fall through to the next layer")
+	}
+}
+
+func TestCompositeDataStore_Load_ContinuesAfterFailure(t *testing.T) {
+	failing := &stubDataStore{loadErr: stderrors.New("bad file")}
+	healthy := &stubDataStore{}
+	ds := NewCompositeDataStore(Layer{Name: "overrides", Store: failing}, Layer{Name: "vendor", Store: healthy})
+
+	err := ds.Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "layer overrides: bad file") {
+		t.Errorf("expected error naming the failed layer, got %v", err)
+	}
+	if !stderrors.Is(err, appErrors.ErrPartialLoad) {
+		t.Errorf("expected a partial load error, got %v", err)
+	}
+	if healthy.loads != 1 {
+		t.Error("expected later layers to load after an earlier one fails")
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if !failing.closed || !healthy.closed {
+		t.Error("expected every layer to be closed")
+	}
+}
+
+func TestCompositeDataStore_LoadStatus(t *testing.T) {
+	overrides := setupTestDatastore(t, "10.1.0.0/16,Office,Germany\n")
+	vendor := setupTestDatastore(t, "8.8.8.0/24,Mountain View,United States\n1.1.1.1,Sydney,Australia\n")
+	ds := NewCompositeDataStore(Layer{Name: "overrides", Store: overrides}, Layer{Name: "vendor", Store: vendor})
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load layers: %v", err)
+	}
+
+	// Break the override file; the vendor layer keeps loading
+	if err := os.WriteFile(overrides.filePath, []byte("not,a,valid,row\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Load(context.Background()); err == nil {
+		t.Fatal("expected reload to fail")
+	}
+
+	status := ds.LoadStatus()
+	if status.Entries != 3 {
+		t.Errorf("expected 3 entries across layers, got %d", status.Entries)
+	}
+	if !strings.HasPrefix(status.LastError, "layer overrides:") {
+		t.Errorf("expected error from the overrides layer, got %q", status.LastError)
+	}
+	if len(status.Layers) != 2 || status.Layers[0].Name != "overrides" || status.Layers[1].LastError != "" {
+		t.Errorf("unexpected layer statuses: %+v", status.Layers)
+	}
+}
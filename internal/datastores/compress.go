@@ -0,0 +1,80 @@
+package datastores
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ip_country_project/internal/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// dataFile is an opened datastore file, decompressed on the fly when the
+// artifact is gzip or zstd
+type dataFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (d *dataFile) Close() error {
+	return d.file.Close()
+}
+
+// openDataFile opens a datastore file for reading. Compression is detected
+// from the magic bytes; a .gz, .zst or .zstd extension on a file without
+// them selects that decompressor anyway so the mismatch is reported
+// instead of parsing compressed bytes as text.
+func openDataFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(file)
+	// A short peek just means a tiny file, which can't be compressed
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	var reader io.Reader
+	switch compressionFor(path, magic) {
+	case "gzip":
+		reader, err = gzip.NewReader(buffered)
+	case "zstd":
+		reader, err = zstd.NewReader(buffered)
+	default:
+		reader = buffered
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %w", filepath.Base(path), err)
+	}
+
+	return &dataFile{Reader: reader, file: file}, nil
+}
+
+// compressionFor names the compression of a file, or returns "" for plain
+// input
+func compressionFor(path string, magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "zstd"
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return "gzip"
+	case ".zst", ".zstd":
+		return "zstd"
+	}
+	return ""
+}
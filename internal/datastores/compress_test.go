@@ -0,0 +1,103 @@
+package datastores
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGzip compresses data into a temp file with the given name
+func writeGzip(t *testing.T, name, data string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, _ = writer.Write([]byte(data))
+	_ = writer.Close()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return path
+}
+
+func TestCSVDataStore_Load_Gzip(t *testing.T) {
+	// No .gz extension: detection relies on the magic bytes
+	path := writeGzip(t, "locations.csv", "8.8.8.8,Mountain View,United States\n1.1.1.0/24,Sydney,Australia\n")
+	ds := NewCSVDataStore(path)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.1.1.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if location.Country != "Australia" {
+		t.Errorf("expected 'Australia', got '%s'", location.Country)
+	}
+}
+
+func TestJSONDataStore_Load_Gzip(t *testing.T) {
+	path := writeGzip(t, "locations.json.gz", `[{"ip": "8.8.8.8", "city": "Mountain View", "country": "United States"}]`)
+	ds := NewJSONDataStore(path)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if location.City != "Mountain View" {
+		t.Errorf("expected 'Mountain View', got '%s'", location.City)
+	}
+}
+
+func TestCSVDataStore_Load_Zstd(t *testing.T) {
+	ds := NewCSVDataStore("../../testdata/sample_ips.csv.zst")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	plain := NewCSVDataStore("../../testdata/sample_ips.csv")
+	if err := plain.Load(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, expected := ds.LoadStatus().Entries, plain.LoadStatus().Entries; got != expected {
+		t.Errorf("expected %d entries from compressed file, got %d", expected, got)
+	}
+}
+
+func TestCSVDataStore_Load_CompressedExtensionMismatch(t *testing.T) {
+	for _, name := range []string{"locations.csv.gz", "locations.csv.zst"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte("8.8.8.8,Mountain View,United States\n"), 0o644); err != nil {
+			t.Fatalf("failed to write temp file: %v", err)
+		}
+
+		if err := NewCSVDataStore(path).Load(context.Background()); err == nil {
+			t.Errorf("expected error for uncompressed %s", name)
+		}
+	}
+}
+
+func TestCSVDataStore_Load_CorruptGzip(t *testing.T) {
+	path := writeGzip(t, "locations.csv.gz", "8.8.8.8,Mountain View,United States\n")
+	data, _ := os.ReadFile(path)
+	// Chop off the trailer so the stream ends early
+	_ = os.WriteFile(path, data[:len(data)-6], 0o644)
+
+	ds := NewCSVDataStore(path, WithLoadMode(LoadModeLenient))
+	if err := ds.Load(context.Background()); err == nil {
+		t.Error("expected error for truncated gzip stream even in lenient mode")
+	}
+}
@@ -0,0 +1,333 @@
+package datastores
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"ip_country_project/internal/errors"
+)
+
+// AddrRange is an inclusive span of addresses
+type AddrRange struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+// CountryRangeFinder is implemented by datastores that can list the
+// addresses they locate in a country
+type CountryRangeFinder interface {
+	// CountryRanges passes yield the addresses located in country, and in
+	// city unless it is empty, from the first one at or after from, in
+	// address order with adjacent ranges merged, until yield returns
+	// false. Names match case-insensitively. found is false when no
+	// address is located in the country, or in the city when one is
+	// given. An empty country passes every address the datastore locates.
+	CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (found bool, err error)
+}
+
+// countryIndex lists the ranges of each country, and of each city of a
+// country, by position in address order. Country queries build it on
+// first use; it lives as long as the index it was built from.
+type countryIndex struct {
+	once      sync.Once
+	countries map[string][]int32
+	cities    map[string][]int32
+}
+
+func countryKey(country string) string {
+	return strings.ToLower(country)
+}
+
+func cityKey(country, city string) string {
+	return strings.ToLower(country) + "\x00" + strings.ToLower(city)
+}
+
+func (c *countryIndex) build(idx networkIndex) {
+	type keys struct {
+		country, city string
+	}
+	// Locations are shared by many ranges; resolve each once
+	locationKeys := make(map[uint32]keys)
+
+	c.countries = make(map[string][]int32)
+	c.cities = make(map[string][]int32)
+	for i := range idx.rangeCount() {
+		id := idx.rangeAt(i).location
+		k, ok := locationKeys[id]
+		if !ok {
+			location := idx.location(id)
+			if location.Country != "" {
+				k.country = countryKey(location.Country)
+				if location.City != "" {
+					k.city = cityKey(location.Country, location.City)
+				}
+			}
+			locationKeys[id] = k
+		}
+		if k.country == "" {
+			continue
+		}
+		c.countries[k.country] = append(c.countries[k.country], int32(i))
+		if k.city != "" {
+			c.cities[k.city] = append(c.cities[k.city], int32(i))
+		}
+	}
+}
+
+// countryRanges implements CountryRanges over an index and its country
+// index
+func countryRanges(idx networkIndex, index *countryIndex, country, city string, from netip.Addr, yield func(AddrRange) bool) bool {
+	count := idx.rangeCount()
+	at := idx.rangeAt
+	if country != "" {
+		index.once.Do(func() {
+			index.build(idx)
+		})
+		positions, found := index.countries[countryKey(country)]
+		if city != "" {
+			positions, found = index.cities[cityKey(country, city)]
+		}
+		if !found {
+			return false
+		}
+		count = len(positions)
+		at = func(i int) ipRange {
+			return idx.rangeAt(int(positions[i]))
+		}
+	} else if count == 0 {
+		return false
+	}
+
+	i := sort.Search(count, func(i int) bool {
+		return !at(i).end.Less(from)
+	})
+	var current AddrRange
+	for ; i < count; i++ {
+		r := at(i)
+		start := r.start
+		if start.Less(from) {
+			start = from
+		}
+		if current.Start.IsValid() && current.End.Next() == start {
+			current.End = r.end
+			continue
+		}
+		if current.Start.IsValid() && !yield(current) {
+			return true
+		}
+		current = AddrRange{Start: start, End: r.end}
+	}
+	if current.Start.IsValid() {
+		yield(current)
+	}
+	return true
+}
+
+func (c *CSVDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (bool, error) {
+	index, _ := c.snapshot()
+	return countryRanges(index, &index.countries, country, city, from, yield), nil
+}
+
+func (j *JSONDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (bool, error) {
+	index, _ := j.snapshot()
+	return countryRanges(index, &index.countries, country, city, from, yield), nil
+}
+
+func (r *RangeDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (bool, error) {
+	index, _ := r.snapshot()
+	return countryRanges(index, &index.countries, country, city, from, yield), nil
+}
+
+// CountryRanges holds the read lock, and with it the mapping, until yield
+// is done
+func (c *CompiledDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.index == nil {
+		return false, nil
+	}
+	return countryRanges(c.index, &c.index.countries, country, city, from, yield), nil
+}
+
+// CountryRanges uses the flattened search tree, like ListNetworks
+func (m *MMDBDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (bool, error) {
+	m.mutex.RLock()
+	reader := m.reader
+	m.mutex.RUnlock()
+
+	if reader == nil {
+		return false, nil
+	}
+	index, err := reader.flattened()
+	if err != nil {
+		return false, err
+	}
+	return countryRanges(index, &index.countries, country, city, from, yield), nil
+}
+
+// countryRangeChunk is how many ranges CompositeDataStore.CountryRanges
+// reads from a layer at a time. Each read completes before the next, so
+// no layer is left holding a lock while the others are read.
+const countryRangeChunk = 256
+
+// layerRanges is one layer's ranges being merged by CountryRanges, with
+// the addresses higher layers locate taken out
+type layerRanges struct {
+	name   string
+	finder CountryRangeFinder
+	above  []CountryRangeFinder
+	ranges []AddrRange
+	from   netip.Addr
+	done   bool
+	found  bool
+}
+
+// head returns the layer's next range, reading chunks as needed
+func (l *layerRanges) head(ctx context.Context, country, city string) (AddrRange, bool, error) {
+	for len(l.ranges) == 0 && !l.done {
+		if err := l.read(ctx, country, city); err != nil {
+			return AddrRange{}, false, fmt.Errorf("layer %s: %w", l.name, err)
+		}
+	}
+	if len(l.ranges) == 0 {
+		return AddrRange{}, false, nil
+	}
+	return l.ranges[0], true, nil
+}
+
+func (l *layerRanges) read(ctx context.Context, country, city string) error {
+	var chunk []AddrRange
+	found, err := l.finder.CountryRanges(ctx, country, city, l.from, func(r AddrRange) bool {
+		chunk = append(chunk, r)
+		return len(chunk) < countryRangeChunk
+	})
+	if err != nil {
+		return err
+	}
+	l.found = l.found || found
+	if len(chunk) < countryRangeChunk {
+		l.done = true
+	} else {
+		l.from = nextAddr(chunk[len(chunk)-1].End)
+		l.done = !l.from.IsValid()
+	}
+
+	for _, r := range chunk {
+		pieces, err := uncovered(ctx, l.above, r)
+		if err != nil {
+			return err
+		}
+		l.ranges = append(l.ranges, pieces...)
+	}
+	return nil
+}
+
+// nextAddr returns the address after addr in address order, where every
+// IPv4 address comes before IPv6, or the zero Addr after the last one
+func nextAddr(addr netip.Addr) netip.Addr {
+	next := addr.Next()
+	if !next.IsValid() && addr.Is4() {
+		return netip.IPv6Unspecified()
+	}
+	return next
+}
+
+// uncovered returns the parts of r that none of the finders locates
+func uncovered(ctx context.Context, finders []CountryRangeFinder, r AddrRange) ([]AddrRange, error) {
+	pieces := []AddrRange{r}
+	for _, finder := range finders {
+		var rest []AddrRange
+		for _, piece := range pieces {
+			start := piece.Start
+			_, err := finder.CountryRanges(ctx, "", "", piece.Start, func(covered AddrRange) bool {
+				if piece.End.Less(covered.Start) {
+					return false
+				}
+				if start.Less(covered.Start) {
+					rest = append(rest, AddrRange{Start: start, End: covered.Start.Prev()})
+				}
+				if !covered.End.Less(piece.End) {
+					start = netip.Addr{}
+					return false
+				}
+				start = covered.End.Next()
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+			if start.IsValid() {
+				rest = append(rest, AddrRange{Start: start, End: piece.End})
+			}
+		}
+		pieces = rest
+	}
+	return pieces, nil
+}
+
+// CountryRanges merges the ranges of every layer that can list them.
+// Addresses a higher layer locates, in any country, are answered by that
+// layer, so lower layers only contribute the addresses no higher layer
+// locates. Layers that can't list their ranges can't be seen to locate
+// anything.
+func (c *CompositeDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(AddrRange) bool) (bool, error) {
+	var layers []*layerRanges
+	var above []CountryRangeFinder
+	for _, layer := range c.layers {
+		finder, ok := layer.Store.(CountryRangeFinder)
+		if !ok {
+			continue
+		}
+		layers = append(layers, &layerRanges{name: layer.Name, finder: finder, above: above, from: from})
+		above = append(above[:len(above):len(above)], finder)
+	}
+	if len(layers) == 0 {
+		return false, errors.ErrNetworksUnsupported
+	}
+
+	var current AddrRange
+	for {
+		// Take the layer range starting first, merging it into current if
+		// they overlap or touch
+		var first *layerRanges
+		var r AddrRange
+		for _, l := range layers {
+			head, ok, err := l.head(ctx, country, city)
+			if err != nil {
+				return false, err
+			}
+			if ok && (first == nil || head.Start.Less(r.Start)) {
+				first, r = l, head
+			}
+		}
+		if first == nil {
+			if current.Start.IsValid() {
+				yield(current)
+			}
+			break
+		}
+		first.ranges = first.ranges[1:]
+
+		if current.Start.IsValid() && (!current.End.Less(r.Start) || current.End.Next() == r.Start) {
+			if current.End.Less(r.End) {
+				current.End = r.End
+			}
+			continue
+		}
+		if current.Start.IsValid() && !yield(current) {
+			break
+		}
+		current = r
+	}
+
+	found := false
+	for _, l := range layers {
+		found = found || l.found
+	}
+	return found, nil
+}
@@ -0,0 +1,172 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+// collectCountryRanges returns the ranges CountryRanges yields as
+// "start-end" strings
+func collectCountryRanges(t *testing.T, finder CountryRangeFinder, country, city, from string) (string, bool) {
+	t.Helper()
+	var fromAddr netip.Addr
+	if from != "" {
+		fromAddr = netip.MustParseAddr(from)
+	}
+	var ranges []string
+	found, err := finder.CountryRanges(context.Background(), country, city, fromAddr, func(r AddrRange) bool {
+		ranges = append(ranges, r.Start.String()+"-"+r.End.String())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return strings.Join(ranges, " "), found
+}
+
+func TestCountryRangeFinder_CountryRanges(t *testing.T) {
+	source := setupTestDatastore(t, testNestedNetworks+"9.9.9.10,Zurich,Switzerland\n")
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	finders := map[string]CountryRangeFinder{
+		"csv":      source,
+		"compiled": compileTestIndex(t, source),
+	}
+
+	for name, finder := range finders {
+		testCases := []struct {
+			country, city, from string
+			expected            string
+		}{
+			// The German network nested in the /16 splits it in two
+			{"United States", "", "", "8.8.0.0-8.8.3.255 8.8.5.0-8.8.255.255"},
+			{"united states", "MOUNTAIN VIEW", "", "8.8.8.0-8.8.8.255"},
+			{"United States", "Anywhere", "", "8.8.0.0-8.8.3.255 8.8.5.0-8.8.7.255 8.8.9.0-8.8.255.255"},
+			{"United States", "", "8.8.6.0", "8.8.6.0-8.8.255.255"},
+			{"Germany", "", "", "8.8.4.0-8.8.4.255 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+			{"Germany", "", "8.8.5.0", "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+			// Adjacent addresses merge into one range
+			{"Switzerland", "", "", "9.9.9.9-9.9.9.10"},
+		}
+		for _, tc := range testCases {
+			ranges, found := collectCountryRanges(t, finder, tc.country, tc.city, tc.from)
+			if !found || ranges != tc.expected {
+				t.Errorf("%s: expected %q for %s/%s from %q, got %q (found %v)", name, tc.expected, tc.country, tc.city, tc.from, ranges, found)
+			}
+		}
+
+		if ranges, found := collectCountryRanges(t, finder, "France", "", ""); found || ranges != "" {
+			t.Errorf("%s: expected France not to be found, got %q", name, ranges)
+		}
+		if ranges, found := collectCountryRanges(t, finder, "Switzerland", "Geneva", ""); found || ranges != "" {
+			t.Errorf("%s: expected Geneva not to be found, got %q", name, ranges)
+		}
+
+		// An empty country lists every located address
+		if ranges, found := collectCountryRanges(t, finder, "", "", "8.8.200.0"); !found || ranges != "8.8.200.0-8.8.255.255 9.9.9.9-9.9.9.10 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff" {
+			t.Errorf("%s: expected every located address, got %q", name, ranges)
+		}
+
+		// Stopping early yields nothing more
+		calls := 0
+		found, err := finder.CountryRanges(context.Background(), "United States", "", netip.Addr{}, func(AddrRange) bool {
+			calls++
+			return false
+		})
+		if err != nil || !found || calls != 1 {
+			t.Errorf("%s: expected a single call, got %d (found %v, err %v)", name, calls, found, err)
+		}
+	}
+}
+
+func TestMMDBDataStore_CountryRanges(t *testing.T) {
+	ds := setupTestMMDBDatastore(t, 6, 28, testMMDBNetworks())
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load MMDB: %v", err)
+	}
+
+	testCases := map[string]string{
+		"Russia": "77.88.0.0-77.88.255.255",
+		// Records without a country name are located by their code
+		"ch": "9.9.9.0-9.9.9.255",
+	}
+	for country, expected := range testCases {
+		if ranges, found := collectCountryRanges(t, ds, country, "", ""); !found || ranges != expected {
+			t.Errorf("expected %q for %s, got %q", expected, country, ranges)
+		}
+	}
+}
+
+func TestCompositeDataStore_CountryRanges(t *testing.T) {
+	overrides := setupTestDatastore(t, "8.8.4.0/24,Office,United States\n8.9.0.0/16,Office,United States\n8.8.100.0/24,Office,Mexico\n")
+	vendor := setupTestDatastore(t, testNestedNetworks)
+	remote := &stubDataStore{location: &models.Location{Country: "Canada"}}
+	composite := NewCompositeDataStore(
+		Layer{Name: "overrides", Store: overrides},
+		Layer{Name: "vendor", Store: vendor},
+		Layer{Name: "remote", Store: remote},
+	)
+	if err := composite.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	// The layers' ranges touch and merge, except where the overrides
+	// locate the vendor's addresses elsewhere
+	if ranges, found := collectCountryRanges(t, composite, "United States", "", ""); !found || ranges != "8.8.0.0-8.8.99.255 8.8.101.0-8.9.255.255" {
+		t.Errorf("expected the layers' ranges merged, got %q", ranges)
+	}
+	if ranges, found := collectCountryRanges(t, composite, "Mexico", "", ""); !found || ranges != "8.8.100.0-8.8.100.255" {
+		t.Errorf("expected the override's range, got %q", ranges)
+	}
+	// The vendor's German /24 is overridden
+	if ranges, found := collectCountryRanges(t, composite, "Germany", "", ""); !found || ranges != "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff" {
+		t.Errorf("expected only the vendor's German addresses no override locates, got %q", ranges)
+	}
+	if ranges, found := collectCountryRanges(t, composite, "United States", "", "8.8.200.0"); !found || ranges != "8.8.200.0-8.9.255.255" {
+		t.Errorf("expected the merged range from 8.8.200.0, got %q", ranges)
+	}
+	if ranges, found := collectCountryRanges(t, composite, "United States", "Office", ""); !found || ranges != "8.8.4.0-8.8.4.255 8.9.0.0-8.9.255.255" {
+		t.Errorf("expected the office ranges, got %q", ranges)
+	}
+	if _, found := collectCountryRanges(t, composite, "Canada", "", ""); found {
+		t.Error("expected layers that can't list ranges to be skipped")
+	}
+
+	calls := 0
+	found, err := composite.CountryRanges(context.Background(), "Germany", "", netip.Addr{}, func(AddrRange) bool {
+		calls++
+		return false
+	})
+	if err != nil || !found || calls != 1 {
+		t.Errorf("expected a single call, got %d (found %v, err %v)", calls, found, err)
+	}
+
+	// Ranges are read from the layers in chunks
+	var many strings.Builder
+	for k := range 3 * countryRangeChunk {
+		fmt.Fprintf(&many, "10.%d.%d.0/24,,Portugal\n", k/128, 2*(k%128))
+	}
+	overrides = setupTestDatastore(t, "10.1.0.0/16,Office,Spain\n")
+	vendor = setupTestDatastore(t, many.String())
+	composite = NewCompositeDataStore(Layer{Name: "overrides", Store: overrides}, Layer{Name: "vendor", Store: vendor})
+	if err := composite.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	ranges, _ := collectCountryRanges(t, composite, "Portugal", "", "")
+	if listed := strings.Fields(ranges); len(listed) != 3*countryRangeChunk-128 || strings.Contains(ranges, "10.1.") {
+		t.Errorf("expected every range outside the override, got %d", len(listed))
+	}
+
+	_, err = NewCompositeDataStore(Layer{Name: "remote", Store: remote}).CountryRanges(context.Background(), "Canada", "", netip.Addr{}, func(AddrRange) bool { return true })
+	if !stderrors.Is(err, appErrors.ErrNetworksUnsupported) {
+		t.Errorf("expected ErrNetworksUnsupported without a listable layer, got %v", err)
+	}
+}
@@ -3,8 +3,10 @@ package datastores
 import (
 	"context"
 	"encoding/csv"
+	stderrors "errors"
 	"fmt"
-	"os"
+	"io"
+	"slices"
 	"sync"
 
 	"ip_country_project/internal/errors"
@@ -14,75 +16,143 @@ import (
 
 type CSVDataStore struct {
 	filePath string
-	data     map[string]*models.Location
+	index    *rangeIndex
 	mutex    sync.RWMutex
+	options  loadOptions
+	loadTracker
 }
 
-func NewCSVDataStore(filePath string) *CSVDataStore {
+func NewCSVDataStore(filePath string, opts ...Option) *CSVDataStore {
 	return &CSVDataStore{
 		filePath: filePath,
-		data:     make(map[string]*models.Location),
+		index:    newPrefixIndex(nil, newLocationTable()),
+		options:  applyOptions(opts),
 	}
 }
 
+// Load reads the CSV file, mapping columns by header name or position as
+// configured, into a new index.
 func (c *CSVDataStore) Load(ctx context.Context) error {
-	file, err := os.Open(c.filePath)
+	return loadIndex(c.filePath, c.options.mode, &c.loadTracker, func(report *reportBuilder) (*rangeIndex, error) {
+		return c.buildIndex(ctx, report)
+	}, func(index *rangeIndex) {
+		c.mutex.Lock()
+		c.index = index
+		c.mutex.Unlock()
+	})
+}
+
+// buildIndex streams the file row by row into a fresh index without
+// touching the published one
+func (c *CSVDataStore) buildIndex(ctx context.Context, report *reportBuilder) (*rangeIndex, error) {
+	file, err := openDataFile(c.filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open CSV file: %w", err)
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
 	}
 	defer file.Close()
 
+	format := c.options.csvFormat
 	reader := csv.NewReader(file)
-	// CSV is loaded fully into memory at startup.
-	// This is acceptable for the exercise and small datasets.
-	records, err := reader.ReadAll()
+	// Field counts are checked per row so lenient mode can skip bad rows
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	if format.Delimiter != 0 {
+		reader.Comma = format.Delimiter
+	}
+	reader.Comment = format.Comment
+
+	var header []string
+	if format.Header {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, errors.ErrEmptyDataset
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		header = slices.Clone(record)
+	}
+
+	layout, err := resolveCSVLayout(format, header)
 	if err != nil {
-		return fmt.Errorf("failed to read CSV: %w", err)
+		return nil, fmt.Errorf("invalid CSV column mapping: %w", err)
+	}
+
+	locations := newLocationTable()
+	// Interning copies the values, so one map serves every row
+	var extra map[string]string
+	if len(layout.extras) > 0 {
+		extra = make(map[string]string, len(layout.extras))
 	}
 
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	var entries []networkEntry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
 
-	for i, record := range records {
-		if len(record) != 3 {
-			return fmt.Errorf("invalid CSV format at line %d: expected 3 fields, got %d", i+1, len(record))
+		var parseErr *csv.ParseError
+		if stderrors.As(err, &parseErr) {
+			report.read()
+			if err := report.reject(parseErr.Line, skipInvalidFormat, fmt.Errorf("failed to read CSV: %w", err)); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		report.read()
 
-		ip, city, country := record[0], record[1], record[2]
+		if err := layout.checkFields(record); err != nil {
+			if err := report.reject(line, skipInvalidFormat, fmt.Errorf("invalid CSV format at line %d: %w", line, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-		if !utils.IsValidIP(ip) {
-			return fmt.Errorf("invalid IP address at line %d: %s", i+1, ip)
+		// The IP column holds either a single IP or a CIDR network
+		ip := record[layout.ip]
+		prefix, err := utils.ParseNetwork(ip)
+		if err != nil {
+			if err := report.reject(line, skipInvalidIP, fmt.Errorf("invalid IP address at line %d: %s", line, ip)); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		c.data[ip] = &models.Location{
-			IP:      ip,
-			City:    city,
-			Country: country,
+		for _, column := range layout.extras {
+			extra[column.name] = record[column.index]
 		}
+
+		entries = append(entries, networkEntry{
+			prefix:   prefix,
+			location: locations.intern(field(record, layout.country), field(record, layout.city), extra),
+			row:      line,
+		})
 	}
 
-	return nil
+	return buildPrefixIndex(entries, locations, c.options.duplicates, report)
 }
 
 func (c *CSVDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
-	if !utils.IsValidIP(ip) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
 		return nil, errors.ErrInvalidIP
 	}
 
 	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-
-	location, exists := c.data[ip]
-	if !exists {
-		return nil, errors.ErrIPNotFound
-	}
+	index := c.index
+	c.mutex.RUnlock()
 
-	// Return a copy to avoid race conditions
-	return &models.Location{
-		IP:      location.IP,
-		City:    location.City,
-		Country: location.Country,
-	}, nil
+	return index.find(addr)
 }
 
 func (c *CSVDataStore) Close() error {
@@ -0,0 +1,142 @@
+package datastores
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Location fields every CSV column mapping understands; any other mapped
+// field name is kept as an extra location attribute
+const (
+	fieldIP      = "ip"
+	fieldCity    = "city"
+	fieldCountry = "country"
+)
+
+// CSVColumns maps location fields to columns. A column is either a 0-based
+// index or, when the file has a header row, a header name.
+type CSVColumns map[string]string
+
+// CSVFormat describes the layout of a CSV data file
+type CSVFormat struct {
+	Header    bool       // first row names the columns and is not data
+	Delimiter rune       // field separator, ',' when zero
+	Comment   rune       // lines starting with this rune are ignored; zero disables
+	Columns   CSVColumns // nil means ip,city,country in positions 0,1,2
+}
+
+// defaultCSVColumns is the original positional ip,city,country layout
+var defaultCSVColumns = CSVColumns{fieldIP: "0", fieldCity: "1", fieldCountry: "2"}
+
+// ParseCSVColumns parses a mapping such as "ip=0,country=2" or
+// "ip=network,country=country_name,asn=autonomous_system_number"
+func ParseCSVColumns(spec string) (CSVColumns, error) {
+	columns := make(CSVColumns)
+	for _, pair := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid column mapping %q: expected field=column", pair)
+		}
+		if _, exists := columns[field]; exists {
+			return nil, fmt.Errorf("field %q mapped more than once", field)
+		}
+		columns[field] = column
+	}
+
+	if _, ok := columns[fieldIP]; !ok {
+		return nil, fmt.Errorf("column mapping must include %q", fieldIP)
+	}
+	return columns, nil
+}
+
+// csvLayout is a CSVColumns mapping resolved to column indexes
+type csvLayout struct {
+	ip, city, country int // -1 when unmapped
+	extras            []extraColumn
+	expectedFields    int // exact field count required, 0 to only require maxIndex
+	maxIndex          int
+}
+
+type extraColumn struct {
+	name  string
+	index int
+}
+
+// resolveCSVLayout turns column names or indexes into positions, using the
+// header row when the format has one
+func resolveCSVLayout(format CSVFormat, header []string) (*csvLayout, error) {
+	columns := format.Columns
+	if columns == nil {
+		columns = defaultCSVColumns
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	layout := &csvLayout{ip: -1, city: -1, country: -1}
+	for field, column := range columns {
+		index, err := strconv.Atoi(column)
+		if err != nil {
+			if header == nil {
+				return nil, fmt.Errorf("column %q for field %q needs a header row", column, field)
+			}
+			var ok bool
+			index, ok = positions[strings.ToLower(column)]
+			if !ok {
+				return nil, fmt.Errorf("column %q for field %q not found in header", column, field)
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("invalid column index %d for field %q", index, field)
+		}
+
+		switch field {
+		case fieldIP:
+			layout.ip = index
+		case fieldCity:
+			layout.city = index
+		case fieldCountry:
+			layout.country = index
+		default:
+			layout.extras = append(layout.extras, extraColumn{name: field, index: index})
+		}
+		layout.maxIndex = max(layout.maxIndex, index)
+	}
+	sort.Slice(layout.extras, func(i, j int) bool {
+		return layout.extras[i].name < layout.extras[j].name
+	})
+
+	// Keep the original strict three-field check for the default layout
+	switch {
+	case header != nil:
+		layout.expectedFields = len(header)
+	case format.Columns == nil:
+		layout.expectedFields = 3
+	}
+
+	return layout, nil
+}
+
+// checkFields validates a record's field count against the layout
+func (l *csvLayout) checkFields(record []string) error {
+	if l.expectedFields > 0 && len(record) != l.expectedFields {
+		return fmt.Errorf("expected %d fields, got %d", l.expectedFields, len(record))
+	}
+	if len(record) <= l.maxIndex {
+		return fmt.Errorf("expected at least %d fields, got %d", l.maxIndex+1, len(record))
+	}
+	return nil
+}
+
+// field returns the value at index, or "" for unmapped fields
+func field(record []string, index int) string {
+	if index < 0 {
+		return ""
+	}
+	return record[index]
+}
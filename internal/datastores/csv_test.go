@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/utils"
 )
 
 // Helper function to create test CSV file and datastore
@@ -117,3 +119,431 @@ func TestCSVDataStore_Load_InvalidIPInCSV(t *testing.T) {
 		t.Error("expected error loading CSV with invalid IP")
 	}
 }
+
+func TestCSVDataStore_FindLocation_CIDR(t *testing.T) {
+	testData := "8.8.0.0/16,Anycast,United States\n8.8.8.0/24,Mountain View,United States\n8.8.8.8,Google DNS,United States\n"
+	ds := setupTestDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	testCases := map[string]string{
+		"8.8.8.8": "Google DNS",
+		"8.8.8.9": "Mountain View",
+		"8.8.4.4": "Anycast",
+	}
+
+	for ip, expectedCity := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.City != expectedCity {
+			t.Errorf("expected city '%s' for %s, got '%s'", expectedCity, ip, location.City)
+		}
+		if location.IP != ip {
+			t.Errorf("expected IP '%s', got '%s'", ip, location.IP)
+		}
+	}
+
+	_, err := ds.FindLocation(context.Background(), "8.9.0.1")
+	if !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound outside all networks, got %v", err)
+	}
+}
+
+func TestCSVDataStore_FindLocation_IPv6(t *testing.T) {
+	testData := "2001:DB8::1,Host,Nowhere\n" +
+		"2001:0DB8:0001::/48,Site,Nowhere\n" +
+		"2001:db8::/32,Block,Nowhere\n" +
+		"8.8.8.8,Google DNS,United States\n" +
+		"::ffff:9.9.9.0/120,Quad9,Switzerland\n"
+	ds := setupTestDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	// Queries in any notation resolve to the canonical address
+	testCases := map[string][2]string{
+		"2001:db8::1":          {"Host", "2001:db8::1"},
+		"2001:0db8:0000::0001": {"Host", "2001:db8::1"},
+		"2001:db8:1:ffff::1":   {"Site", "2001:db8:1:ffff::1"},
+		"2001:db8:2::1":        {"Block", "2001:db8:2::1"},
+		"::ffff:8.8.8.8":       {"Google DNS", "8.8.8.8"},
+		"::FFFF:808:808":       {"Google DNS", "8.8.8.8"},
+		"9.9.9.9":              {"Quad9", "9.9.9.9"},
+		"::ffff:9.9.9.10":      {"Quad9", "9.9.9.10"},
+		"2001:DB8:0:0:0:0:0:0": {"Block", "2001:db8::"},
+	}
+
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.City != expected[0] || location.IP != expected[1] {
+			t.Errorf("expected %s at %s for %s, got %s at %s", expected[0], expected[1], ip, location.City, location.IP)
+		}
+	}
+
+	// An IPv4-compatible address (::a.b.c.d) is IPv6, not the IPv4 address
+	if _, err := ds.FindLocation(context.Background(), "::8.8.8.8"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound for ::8.8.8.8, got %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "fe80::1%eth0"); !errors.Is(err, appErrors.ErrInvalidIP) {
+		t.Errorf("expected ErrInvalidIP for a zoned address, got %v", err)
+	}
+}
+
+func TestCSVDataStore_Load_InvalidCIDR(t *testing.T) {
+	testData := "8.8.8.0/33,Mountain View,United States\n"
+	ds := setupTestDatastore(t, testData)
+
+	err := ds.Load(context.Background())
+	if err == nil {
+		t.Error("expected error loading CSV with invalid CIDR")
+	}
+}
+
+func TestCSVDataStore_Load_ReplacesData(t *testing.T) {
+	ds := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	if err := os.WriteFile(ds.filePath, []byte("1.1.1.1,San Francisco,United States\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite CSV: %v", err)
+	}
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to reload CSV: %v", err)
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); err != nil {
+		t.Errorf("expected new entry after reload, got error: %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected stale entry to be gone after reload, got: %v", err)
+	}
+}
+
+func TestCSVDataStore_ConcurrentReload(t *testing.T) {
+	ds := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n8.8.4.0/24,Mountain View,United States\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	// Lookups racing with reloads must always see a complete dataset
+	done := make(chan struct{})
+	failures := make(chan error, 1)
+	utils.Go(func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if _, err := ds.FindLocation(context.Background(), "8.8.4.4"); err != nil {
+				select {
+				case failures <- err:
+				default:
+				}
+				return
+			}
+		}
+	})
+
+	for i := 0; i < 20; i++ {
+		if err := ds.Load(context.Background()); err != nil {
+			t.Fatalf("failed to reload CSV: %v", err)
+		}
+	}
+	<-done
+
+	select {
+	case err := <-failures:
+		t.Errorf("lookup failed during reload: %v", err)
+	default:
+	}
+}
+
+func TestCSVDataStore_Load_FailureKeepsPreviousData(t *testing.T) {
+	ds := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	// Valid rows before the bad one must not leak into the served data
+	badData := "1.1.1.1,San Francisco,United States\ninvalid-ip,Nowhere,Nowhere\n"
+	if err := os.WriteFile(ds.filePath, []byte(badData), 0o644); err != nil {
+		t.Fatalf("failed to rewrite CSV: %v", err)
+	}
+	if err := ds.Load(context.Background()); err == nil {
+		t.Fatal("expected error loading CSV with invalid IP")
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); err != nil {
+		t.Errorf("expected previous data to keep serving, got error: %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected rows from failed load to be discarded, got: %v", err)
+	}
+
+	status := ds.LoadStatus()
+	if status.LastError == "" {
+		t.Error("expected load status to expose the failure reason")
+	}
+	if status.Entries != 1 {
+		t.Errorf("expected status to report the 1 entry still served, got %d", status.Entries)
+	}
+	if !status.LastAttempt.After(status.LastSuccess) {
+		t.Error("expected last attempt to be after last success")
+	}
+}
+
+func TestCSVDataStore_Load_EmptyFile(t *testing.T) {
+	ds := setupTestDatastore(t, "")
+
+	err := ds.Load(context.Background())
+	if !errors.Is(err, appErrors.ErrEmptyDataset) {
+		t.Errorf("expected ErrEmptyDataset, got %v", err)
+	}
+}
+
+func TestCSVDataStore_LoadStatus(t *testing.T) {
+	ds := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\n1.1.1.0/24,San Francisco,United States\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	status := ds.LoadStatus()
+	if status.Entries != 2 {
+		t.Errorf("expected 2 entries, got %d", status.Entries)
+	}
+	if status.LastError != "" {
+		t.Errorf("expected no error, got '%s'", status.LastError)
+	}
+	if status.LastSuccess.IsZero() {
+		t.Error("expected last success to be set")
+	}
+}
+
+func TestCSVDataStore_Load_LenientSkipsBadRows(t *testing.T) {
+	testData := "8.8.8.8,Mountain View,United States\n" +
+		"invalid-ip,Nowhere,Nowhere\n" +
+		"1.1.1.1,San Francisco\n" +
+		"1.1.1.1,San Francisco,United States\n" +
+		"8.8.8.8,Mountain View,United States\n"
+	tmpFile := setupTestDatastore(t, testData).filePath
+	ds := NewCSVDataStore(tmpFile, WithLoadMode(LoadModeLenient))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("expected lenient load to succeed, got: %v", err)
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); err != nil {
+		t.Errorf("expected valid rows to load, got error: %v", err)
+	}
+
+	report := ds.LoadStatus().Report
+	if report == nil {
+		t.Fatal("expected load report")
+	}
+	if report.Mode != "lenient" {
+		t.Errorf("expected mode 'lenient', got '%s'", report.Mode)
+	}
+	if report.RowsRead != 5 {
+		t.Errorf("expected 5 rows read, got %d", report.RowsRead)
+	}
+	if report.Accepted != 2 {
+		t.Errorf("expected 2 accepted, got %d", report.Accepted)
+	}
+	if report.Duplicates != 1 {
+		t.Errorf("expected 1 duplicate, got %d", report.Duplicates)
+	}
+	if report.Skipped["invalid_ip"] != 1 || report.Skipped["invalid_format"] != 1 {
+		t.Errorf("unexpected skip counts: %v", report.Skipped)
+	}
+	if len(report.OffendingRows) != 2 || report.OffendingRows[0] != 2 || report.OffendingRows[1] != 3 {
+		t.Errorf("expected offending rows [2 3], got %v", report.OffendingRows)
+	}
+}
+
+func TestCSVDataStore_Load_StrictReportsFailure(t *testing.T) {
+	ds := setupTestDatastore(t, "8.8.8.8,Mountain View,United States\ninvalid-ip,Nowhere,Nowhere\n")
+
+	if err := ds.Load(context.Background()); err == nil {
+		t.Fatal("expected strict load to fail")
+	}
+
+	report := ds.LoadStatus().Report
+	if report == nil || len(report.OffendingRows) != 1 || report.OffendingRows[0] != 2 {
+		t.Errorf("expected report naming row 2, got %+v", report)
+	}
+}
+
+func TestCSVDataStore_Load_DuplicatePolicyError(t *testing.T) {
+	testData := "8.8.8.8,Mountain View,United States\n8.8.8.8,Frankfurt,Germany\n"
+	tmpFile := setupTestDatastore(t, testData).filePath
+	ds := NewCSVDataStore(tmpFile, WithDuplicatePolicy(DuplicateError))
+
+	if err := ds.Load(context.Background()); err == nil {
+		t.Fatal("expected error for conflicting duplicate rows")
+	}
+
+	report := ds.LoadStatus().Report
+	if report == nil || report.Conflicts != 1 {
+		t.Errorf("expected report with 1 conflict, got %+v", report)
+	}
+}
+
+func TestCSVDataStore_Load_DuplicatePolicyFirstWins(t *testing.T) {
+	testData := "8.8.8.8,Mountain View,United States\n8.8.8.8,Frankfurt,Germany\n"
+	tmpFile := setupTestDatastore(t, testData).filePath
+	ds := NewCSVDataStore(tmpFile, WithDuplicatePolicy(DuplicateFirstWins))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "United States" {
+		t.Errorf("expected first row to win, got '%s'", location.Country)
+	}
+}
+
+func TestCSVDataStore_Load_HeaderAndNamedColumns(t *testing.T) {
+	testData := "network,asn,country_name,city_name\n" +
+		"8.8.8.0/24,15169,United States,Mountain View\n" +
+		"77.88.8.0/24,13238,Russia,Moscow\n"
+	tmpFile := setupTestDatastore(t, testData).filePath
+
+	columns, err := ParseCSVColumns("ip=network,country=Country_Name,city=city_name,asn=asn")
+	if err != nil {
+		t.Fatalf("failed to parse columns: %v", err)
+	}
+	ds := NewCSVDataStore(tmpFile, WithCSVFormat(CSVFormat{Header: true, Columns: columns}))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "77.88.8.8")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Russia" || location.City != "Moscow" {
+		t.Errorf("unexpected location: %+v", location)
+	}
+	if location.Extra["asn"] != "13238" {
+		t.Errorf("expected extra field asn '13238', got %v", location.Extra)
+	}
+	if ds.LoadStatus().Report.RowsRead != 2 {
+		t.Errorf("expected header row not to count as data, got %d rows", ds.LoadStatus().Report.RowsRead)
+	}
+}
+
+func TestCSVDataStore_Load_TSVWithComments(t *testing.T) {
+	testData := "# generated 2025-01-01\n" +
+		"United States\t8.8.8.8\n" +
+		"\n" +
+		"# vendor block\n" +
+		"Germany\tnot-an-ip\n"
+	tmpFile := setupTestDatastore(t, testData).filePath
+
+	columns, _ := ParseCSVColumns("ip=1,country=0")
+	ds := NewCSVDataStore(tmpFile, WithCSVFormat(CSVFormat{Delimiter: '\t', Comment: '#', Columns: columns}))
+
+	err := ds.Load(context.Background())
+	if err == nil {
+		t.Fatal("expected error for invalid IP")
+	}
+	// Line numbers must count comments and blank lines
+	if !strings.Contains(err.Error(), "line 5") {
+		t.Errorf("expected error to name line 5, got: %v", err)
+	}
+
+	lenient := NewCSVDataStore(tmpFile, WithLoadMode(LoadModeLenient),
+		WithCSVFormat(CSVFormat{Delimiter: '\t', Comment: '#', Columns: columns}))
+	if err := lenient.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load TSV: %v", err)
+	}
+	location, err := lenient.FindLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "United States" || location.City != "" {
+		t.Errorf("unexpected location: %+v", location)
+	}
+}
+
+func TestCSVDataStore_Load_SemicolonDelimiter(t *testing.T) {
+	tmpFile := setupTestDatastore(t, "8.8.8.8;Mountain View;United States\n").filePath
+	ds := NewCSVDataStore(tmpFile, WithCSVFormat(CSVFormat{Delimiter: ';'}))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	location, err := ds.FindLocation(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.City != "Mountain View" {
+		t.Errorf("expected city 'Mountain View', got '%s'", location.City)
+	}
+}
+
+func TestCSVDataStore_Load_InvalidColumnMapping(t *testing.T) {
+	tmpFile := setupTestDatastore(t, "ip,country\n8.8.8.8,United States\n").filePath
+
+	// Named columns without a header row
+	columns, _ := ParseCSVColumns("ip=ip,country=country")
+	ds := NewCSVDataStore(tmpFile, WithCSVFormat(CSVFormat{Columns: columns}))
+	if err := ds.Load(context.Background()); err == nil {
+		t.Error("expected error for named columns without header")
+	}
+
+	// Header without the mapped column
+	columns, _ = ParseCSVColumns("ip=ip,country=country_name")
+	ds = NewCSVDataStore(tmpFile, WithCSVFormat(CSVFormat{Header: true, Columns: columns}))
+	if err := ds.Load(context.Background()); err == nil {
+		t.Error("expected error for column missing from header")
+	}
+}
+
+func TestCSVDataStore_Load_LenientSkipsUnparsableRows(t *testing.T) {
+	testData := "8.8.8.8,Mountain View,United States\n1.1.1.1,\"San \"Francisco,United States\n77.88.8.8,Moscow,Russia\n"
+	tmpFile := setupTestDatastore(t, testData).filePath
+	ds := NewCSVDataStore(tmpFile, WithLoadMode(LoadModeLenient))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("expected lenient load to succeed, got: %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "77.88.8.8"); err != nil {
+		t.Errorf("expected rows after a parse error to load, got: %v", err)
+	}
+	if report := ds.LoadStatus().Report; report.Skipped["invalid_format"] != 1 {
+		t.Errorf("expected 1 invalid_format skip, got %v", report.Skipped)
+	}
+}
+
+func TestParseCSVColumns(t *testing.T) {
+	columns, err := ParseCSVColumns(" ip = 0 , country=2 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if columns["ip"] != "0" || columns["country"] != "2" {
+		t.Errorf("unexpected columns: %v", columns)
+	}
+
+	invalid := []string{"", "country=2", "ip", "ip=0,ip=1", "ip=0,=1"}
+	for _, spec := range invalid {
+		if _, err := ParseCSVColumns(spec); err == nil {
+			t.Errorf("expected error for '%s'", spec)
+		}
+	}
+}
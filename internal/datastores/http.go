@@ -0,0 +1,256 @@
+package datastores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+const (
+	defaultHTTPTimeout = 2 * time.Second
+	defaultHTTPBackoff = 100 * time.Millisecond
+	maxHTTPBackoff     = 2 * time.Second
+
+	// maxHTTPResponseSize bounds how much of an upstream response is read
+	maxHTTPResponseSize = 1 << 20
+)
+
+// HTTPFields maps location fields to dot-separated paths in the upstream
+// JSON response, e.g. country -> "location.country.name". Fields other
+// than city and country are returned as extras.
+type HTTPFields map[string]string
+
+// defaultHTTPFields reads top-level "country" and "city" keys
+var defaultHTTPFields = HTTPFields{fieldCountry: fieldCountry, fieldCity: fieldCity}
+
+// ParseHTTPFields parses a mapping such as
+// "country=country_name,city=city,asn=connection.asn"
+func ParseHTTPFields(spec string) (HTTPFields, error) {
+	fields := make(HTTPFields)
+	for _, pair := range strings.Split(spec, ",") {
+		field, path, ok := strings.Cut(pair, "=")
+		field, path = strings.TrimSpace(field), strings.TrimSpace(path)
+		if !ok || field == "" || path == "" {
+			return nil, fmt.Errorf("invalid field mapping %q: expected field=path", pair)
+		}
+		if _, exists := fields[field]; exists {
+			return nil, fmt.Errorf("field %q mapped more than once", field)
+		}
+		fields[field] = path
+	}
+
+	if _, ok := fields[fieldCountry]; !ok {
+		return nil, fmt.Errorf("field mapping must include %q", fieldCountry)
+	}
+	return fields, nil
+}
+
+// HTTPConfig describes an upstream geo API
+type HTTPConfig struct {
+	// URL is a template in which {ip} is replaced by the queried address,
+	// e.g. "https://geo.example.com/v1/{ip}?key=secret"
+	URL    string
+	Fields HTTPFields // nil means top-level country and city keys
+	// Timeout bounds each attempt; the request context's deadline, when
+	// sooner, always wins
+	Timeout time.Duration
+	// Retries is how many more attempts follow a 5xx or transport error
+	Retries int
+	// Backoff is the base delay between attempts, doubled every retry
+	// and jittered
+	Backoff time.Duration
+	// Client defaults to a dedicated client with pooled connections
+	Client *http.Client
+}
+
+// HTTPDataStore looks addresses up in an upstream geo API. There is no
+// dataset to load: every lookup is a request.
+type HTTPDataStore struct {
+	config HTTPConfig
+	client *http.Client
+}
+
+func NewHTTPDataStore(config HTTPConfig) *HTTPDataStore {
+	if config.Fields == nil {
+		config.Fields = defaultHTTPFields
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultHTTPBackoff
+	}
+	config.Retries = max(config.Retries, 0)
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	}
+	return &HTTPDataStore{
+		config: config,
+		client: client,
+	}
+}
+
+// Load has nothing to read for a remote datastore
+func (h *HTTPDataStore) Load(ctx context.Context) error {
+	return nil
+}
+
+// FindLocation queries the upstream API, retrying 5xx responses and
+// transport errors with jittered exponential backoff. 404 responses and
+// responses without a country are ErrIPNotFound; other failures wrap
+// errors.ErrUpstream.
+func (h *HTTPDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+	endpoint := strings.ReplaceAll(h.config.URL, "{ip}", url.PathEscape(addr.String()))
+
+	var err error
+	for attempt := 0; attempt <= h.config.Retries; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleepContext(ctx, h.backoff(attempt)); sleepErr != nil {
+				return nil, fmt.Errorf("%w: %v (giving up: %v)", errors.ErrUpstream, err, sleepErr)
+			}
+		}
+
+		var location *models.Location
+		var retry bool
+		location, retry, err = h.fetch(ctx, endpoint)
+		if err == nil {
+			location.IP = addr.String()
+			return location, nil
+		}
+		if !retry {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// fetch makes one attempt and reports whether a failure is worth retrying
+func (h *HTTPDataStore) fetch(ctx context.Context, endpoint string) (*models.Location, bool, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, h.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", errors.ErrUpstream, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// Only the attempt's own timeout is retried; once the caller's
+		// context is done there is no point
+		return nil, ctx.Err() == nil, fmt.Errorf("%w: %v", errors.ErrUpstream, err)
+	}
+	defer func() {
+		// Drain so the connection can be reused
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxHTTPResponseSize))
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, errors.ErrIPNotFound
+	case resp.StatusCode >= 500:
+		return nil, true, fmt.Errorf("%w: status %d", errors.ErrUpstream, resp.StatusCode)
+	default:
+		return nil, false, fmt.Errorf("%w: status %d", errors.ErrUpstream, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	decoder.UseNumber()
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return nil, false, fmt.Errorf("%w: invalid response: %v", errors.ErrUpstream, err)
+	}
+
+	location := &models.Location{}
+	for field, path := range h.config.Fields {
+		value := jsonPath(body, path)
+		switch field {
+		case fieldCountry:
+			location.Country = value
+		case fieldCity:
+			location.City = value
+		default:
+			if value == "" {
+				continue
+			}
+			if location.Extra == nil {
+				location.Extra = make(map[string]string)
+			}
+			location.Extra[field] = value
+		}
+	}
+	if location.Country == "" {
+		return nil, false, errors.ErrIPNotFound
+	}
+	return location, false, nil
+}
+
+// backoff returns the delay before retry attempt: the base doubled per
+// retry, capped, with the upper half jittered so that clients retrying
+// together spread out
+func (h *HTTPDataStore) backoff(attempt int) time.Duration {
+	delay := min(h.config.Backoff<<min(attempt-1, 16), maxHTTPBackoff)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// Close releases idle upstream connections
+func (h *HTTPDataStore) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// jsonPath resolves a dot-separated path of object keys and renders the
+// value as a string; missing keys and null give ""
+func jsonPath(value any, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	default:
+		// Objects and arrays aren't location values
+		return ""
+	}
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,216 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appErrors "ip_country_project/internal/errors"
+)
+
+// setupTestHTTPDatastore serves handler from a stand-in upstream API
+func setupTestHTTPDatastore(t *testing.T, handler http.HandlerFunc, config HTTPConfig) *HTTPDataStore {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config.URL = server.URL + "/lookup/{ip}"
+	if config.Backoff == 0 {
+		config.Backoff = time.Millisecond
+	}
+	ds := NewHTTPDataStore(config)
+	t.Cleanup(func() {
+		_ = ds.Close()
+	})
+	return ds
+}
+
+func TestHTTPDataStore_FindLocation_Success(t *testing.T) {
+	var path string
+	ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, _ = w.Write([]byte(`{"country": "United States", "city": "Mountain View"}`))
+	}, HTTPConfig{})
+
+	location, err := ds.FindLocation(context.Background(), "::ffff:8.8.8.8")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "United States" || location.City != "Mountain View" || location.IP != "8.8.8.8" {
+		t.Errorf("unexpected location: %+v", location)
+	}
+	if path != "/lookup/8.8.8.8" {
+		t.Errorf("expected the canonical address in the URL, got %s", path)
+	}
+}
+
+func TestHTTPDataStore_FindLocation_FieldMapping(t *testing.T) {
+	fields, err := ParseHTTPFields("country=location.country.name,city=location.city,asn=connection.asn,mobile=connection.mobile")
+	if err != nil {
+		t.Fatalf("failed to parse fields: %v", err)
+	}
+	ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"location": {"country": {"name": "Germany", "code": "DE"}, "city": null},
+			"connection": {"asn": 3320, "mobile": false}
+		}`))
+	}, HTTPConfig{Fields: fields})
+
+	location, err := ds.FindLocation(context.Background(), "2003::1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Germany" || location.City != "" {
+		t.Errorf("unexpected location: %+v", location)
+	}
+	if location.Extra["asn"] != "3320" || location.Extra["mobile"] != "false" {
+		t.Errorf("unexpected extras: %v", location.Extra)
+	}
+}
+
+func TestHTTPDataStore_FindLocation_NotFound(t *testing.T) {
+	responses := map[string]func(w http.ResponseWriter){
+		"404":        func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+		"no country": func(w http.ResponseWriter) { _, _ = w.Write([]byte(`{"status": "fail"}`)) },
+	}
+
+	for name, respond := range responses {
+		ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+			respond(w)
+		}, HTTPConfig{})
+
+		if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !stderrors.Is(err, appErrors.ErrIPNotFound) {
+			t.Errorf("%s: expected ErrIPNotFound, got %v", name, err)
+		}
+	}
+}
+
+func TestHTTPDataStore_FindLocation_RetriesServerErrors(t *testing.T) {
+	var attempts atomic.Int32
+	ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"country": "Australia"}`))
+	}, HTTPConfig{Retries: 2})
+
+	location, err := ds.FindLocation(context.Background(), "1.1.1.1")
+	if err != nil {
+		t.Fatalf("expected lookup to succeed on the third attempt, got: %v", err)
+	}
+	if location.Country != "Australia" || attempts.Load() != 3 {
+		t.Errorf("expected Australia after 3 attempts, got %s after %d", location.Country, attempts.Load())
+	}
+}
+
+func TestHTTPDataStore_FindLocation_GivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}, HTTPConfig{Retries: 2})
+
+	_, err := ds.FindLocation(context.Background(), "1.1.1.1")
+	if !stderrors.Is(err, appErrors.ErrUpstream) || !strings.Contains(err.Error(), "status 502") {
+		t.Errorf("expected upstream error with the last status, got %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts.Load())
+	}
+
+	// Client errors are not retried
+	attempts.Store(0)
+	ds = setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}, HTTPConfig{Retries: 2})
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); !stderrors.Is(err, appErrors.ErrUpstream) {
+		t.Errorf("expected upstream error, got %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("expected a 401 not to be retried, got %d attempts", attempts.Load())
+	}
+}
+
+func TestHTTPDataStore_FindLocation_Timeouts(t *testing.T) {
+	release := make(chan struct{})
+	var attempts atomic.Int32
+	ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, HTTPConfig{Timeout: 20 * time.Millisecond, Retries: 1})
+	defer close(release)
+
+	// Each attempt times out on its own and is retried
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); !stderrors.Is(err, appErrors.ErrUpstream) {
+		t.Errorf("expected upstream error, got %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts.Load())
+	}
+
+	// The caller's deadline cuts the lookup short and is not retried
+	attempts.Store(0)
+	ds.config.Timeout = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ds.FindLocation(ctx, "1.1.1.1"); err == nil {
+		t.Error("expected the request deadline to fail the lookup")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected lookup to stop at the request deadline, took %s", elapsed)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("expected no retry after the request deadline, got %d attempts", attempts.Load())
+	}
+}
+
+func TestHTTPDataStore_FindLocation_InvalidIP(t *testing.T) {
+	ds := setupTestHTTPDatastore(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected no upstream request for an invalid IP")
+	}, HTTPConfig{})
+
+	if _, err := ds.FindLocation(context.Background(), "not-an-ip"); !stderrors.Is(err, appErrors.ErrInvalidIP) {
+		t.Errorf("expected ErrInvalidIP, got %v", err)
+	}
+}
+
+func TestHTTPDataStore_Backoff(t *testing.T) {
+	ds := NewHTTPDataStore(HTTPConfig{Backoff: 100 * time.Millisecond})
+
+	for attempt, base := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 60: maxHTTPBackoff} {
+		for range 20 {
+			delay := ds.backoff(attempt)
+			if delay < base/2 || delay > base {
+				t.Errorf("attempt %d: expected delay in [%s, %s], got %s", attempt, base/2, base, delay)
+			}
+		}
+	}
+}
+
+func TestParseHTTPFields(t *testing.T) {
+	fields, err := ParseHTTPFields(" country = country_name , city=city.names.en ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fields["country"] != "country_name" || fields["city"] != "city.names.en" {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+
+	for _, spec := range []string{"city=city", "country", "country=a,country=b", "=x,country=y"} {
+		if _, err := ParseHTTPFields(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package datastores
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sort"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+// networkEntry is a single parsed dataset row: a CIDR prefix (or host
+// prefix for plain IPs) and the interned location it maps to
+type networkEntry struct {
+	prefix   netip.Prefix
+	location uint32 // ID in the index's locationTable
+	row      int    // 1-based source row, used in conflict errors
+}
+
+// noNetwork marks ranges that weren't derived from a CIDR entry
+const noNetwork = -1
+
+// ipRange is a contiguous span of addresses that resolves to one location.
+// bits is the prefix length of the dataset network the span was derived
+// from, or noNetwork.
+type ipRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location uint32
+	bits     int16
+}
+
+// network returns the dataset network the span was derived from
+func (r ipRange) network() netip.Prefix {
+	if r.bits == noNetwork {
+		return netip.Prefix{}
+	}
+	prefix, _ := r.start.Prefix(int(r.bits))
+	return prefix
+}
+
+// rangeIndex answers lookups with a binary search over sorted,
+// non-overlapping ranges. It is immutable once built.
+type rangeIndex struct {
+	ranges    []ipRange
+	locations *locationTable
+	records   int // dataset entries the ranges were built from
+	countries countryIndex
+}
+
+// newPrefixIndex builds an index where repeated prefixes resolve last-wins
+func newPrefixIndex(entries []networkEntry, locations *locationTable) *rangeIndex {
+	idx, _ := buildPrefixIndex(entries, locations, DuplicateLastWins, newReportBuilder(LoadModeLenient))
+	return idx
+}
+
+// buildPrefixIndex flattens possibly nested prefixes into disjoint ranges so
+// that each address maps to its most specific (longest) matching prefix.
+// Repeated prefixes are resolved by policy and counted in the report. A
+// nested prefix whose country differs from the one enclosing it is counted
+// as an overlap conflict, and under DuplicateError rejected as a conflict.
+// locations is frozen once the index is built.
+func buildPrefixIndex(entries []networkEntry, locations *locationTable, policy DuplicatePolicy, report *reportBuilder) (*rangeIndex, error) {
+	sorted := make([]networkEntry, len(entries))
+	copy(sorted, entries)
+
+	// Wider prefixes sort before the prefixes nested inside them
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].prefix, sorted[j].prefix
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+	sorted, err := resolveDuplicates(sorted, locations, policy, report)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &rangeIndex{ranges: make([]ipRange, 0, len(sorted)), locations: locations, records: len(sorted)}
+
+	var stack []networkEntry
+	var cursor netip.Addr
+
+	closeTop := func() {
+		top := stack[len(stack)-1]
+		last := utils.LastAddr(top.prefix)
+		idx.emit(cursor, last, top)
+		cursor = last.Next()
+		stack = stack[:len(stack)-1]
+	}
+
+	for _, entry := range sorted {
+		start := entry.prefix.Addr()
+
+		// Close every enclosing prefix that ends before this one starts
+		for len(stack) > 0 && utils.LastAddr(stack[len(stack)-1].prefix).Less(start) {
+			closeTop()
+		}
+
+		// A nested network pointing elsewhere is legitimate (the longest
+		// prefix wins) but worth surfacing, unless conflicts are errors
+		if len(stack) > 0 {
+			enclosing := stack[len(stack)-1]
+			outer, country := locations.country(enclosing.location), locations.country(entry.location)
+			if outer != country {
+				report.report.OverlapConflicts++
+				if policy == DuplicateError {
+					err := fmt.Errorf("conflicting entries for %s at row %d nested in %s at row %d: %s vs %s",
+						entry.prefix, entry.row, enclosing.prefix, enclosing.row, country, outer)
+					if err := report.reject(entry.row, skipConflict, err); err != nil {
+						return nil, err
+					}
+					idx.records--
+					continue
+				}
+			}
+		}
+
+		// Fill the gap between the previous segment and this prefix
+		if len(stack) > 0 && cursor.IsValid() && cursor.Less(start) {
+			idx.emit(cursor, start.Prev(), stack[len(stack)-1])
+		}
+
+		cursor = start
+		stack = append(stack, entry)
+	}
+
+	for len(stack) > 0 {
+		closeTop()
+	}
+
+	locations.freeze()
+	idx.ranges = slices.Clip(idx.ranges)
+	return idx, nil
+}
+
+// emit appends the span [start, end] unless it is empty
+func (idx *rangeIndex) emit(start, end netip.Addr, entry networkEntry) {
+	if !start.IsValid() || end.Less(start) {
+		return
+	}
+	idx.ranges = append(idx.ranges, ipRange{
+		start:    start,
+		end:      end,
+		location: entry.location,
+		bits:     int16(entry.prefix.Bits()),
+	})
+}
+
+// loadIndex runs build and validates the index it returns before publish
+// swaps it in, so a failed load leaves the previously loaded data serving.
+// Loads are recorded in tracker and logged under source.
+func loadIndex(source string, mode LoadMode, tracker *loadTracker, build func(*reportBuilder) (*rangeIndex, error), publish func(*rangeIndex)) error {
+	report := newReportBuilder(mode)
+	index, err := build(report)
+	if err == nil {
+		err = index.validate()
+	}
+	if err != nil {
+		tracker.recordFailure(err, &report.report)
+		return err
+	}
+
+	publish(index)
+
+	loadReport := report.finish(index)
+	logReport(source, loadReport)
+	tracker.recordSuccess(index.records, loadReport)
+	return nil
+}
+
+// validate checks a freshly built index before it is published
+func (idx *rangeIndex) validate() error {
+	if idx.records == 0 {
+		return errors.ErrEmptyDataset
+	}
+	for i, r := range idx.ranges {
+		if r.end.Less(r.start) {
+			return fmt.Errorf("corrupt index: range %s-%s is inverted", r.start, r.end)
+		}
+		if i > 0 && !idx.ranges[i-1].end.Less(r.start) {
+			return fmt.Errorf("corrupt index: range %s-%s overlaps its predecessor", r.start, r.end)
+		}
+	}
+	return nil
+}
+
+// find returns the location of addr. The index is immutable once built and
+// location returns a fresh copy, so no lock is needed and the result is
+// the caller's to modify.
+func (idx *rangeIndex) find(addr netip.Addr) (*models.Location, error) {
+	match, exists := idx.lookup(addr)
+	if !exists {
+		return nil, errors.ErrIPNotFound
+	}
+	location := idx.locations.location(match.location)
+	location.IP = addr.String()
+	return location, nil
+}
+
+// lookup finds the range containing addr
+func (idx *rangeIndex) lookup(addr netip.Addr) (ipRange, bool) {
+	i := sort.Search(len(idx.ranges), func(i int) bool {
+		return addr.Less(idx.ranges[i].start)
+	})
+	if i == 0 {
+		return ipRange{}, false
+	}
+
+	r := idx.ranges[i-1]
+	if r.end.Less(addr) {
+		return ipRange{}, false
+	}
+	return r, true
+}
+
+// resolveDuplicates keeps one entry per prefix according to policy.
+// Repeats with the same country count as duplicates, different countries
+// as conflicts. The input must be sorted so repeats are adjacent and in
+// source order.
+func resolveDuplicates(sorted []networkEntry, locations *locationTable, policy DuplicatePolicy, report *reportBuilder) ([]networkEntry, error) {
+	out := sorted[:0]
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].prefix == sorted[i].prefix {
+			j++
+		}
+		group := sorted[i:j]
+
+		winner := group[0]
+		if policy == DuplicateLastWins {
+			winner = group[len(group)-1]
+		}
+
+		for _, entry := range group[1:] {
+			first, country := locations.country(group[0].location), locations.country(entry.location)
+			if country == first {
+				report.report.Duplicates++
+				continue
+			}
+			report.report.Conflicts++
+			if policy == DuplicateError {
+				err := fmt.Errorf("conflicting entries for %s at rows %d and %d: %s vs %s",
+					entry.prefix, group[0].row, entry.row, first, country)
+				if err := report.reject(entry.row, skipConflict, err); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		out = append(out, winner)
+		i = j
+	}
+	return out, nil
+}
@@ -0,0 +1,223 @@
+package datastores
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func buildTestIndex(t *testing.T, networks map[string]string) *rangeIndex {
+	t.Helper()
+
+	table := newLocationTable()
+	entries := make([]networkEntry, 0, len(networks))
+	for network, country := range networks {
+		entries = append(entries, networkEntry{
+			prefix:   netip.MustParsePrefix(network),
+			location: table.intern(country, "", nil),
+		})
+	}
+	return newPrefixIndex(entries, table)
+}
+
+func TestRangeIndex_LongestPrefixMatch(t *testing.T) {
+	idx := buildTestIndex(t, map[string]string{
+		"8.0.0.0/8":      "Wide",
+		"8.8.0.0/16":     "Middle",
+		"8.8.8.0/24":     "Narrow",
+		"8.8.8.8/32":     "Host",
+		"2001:db8::/32":  "DocV6",
+		"2001:db8::/48":  "DocV6Narrow",
+		"255.0.0.0/8":    "Top",
+		"255.255.0.0/16": "TopNarrow",
+	})
+
+	testCases := map[string]string{
+		"8.0.0.0":         "Wide",
+		"8.7.255.255":     "Wide",
+		"8.8.0.1":         "Middle",
+		"8.8.8.1":         "Narrow",
+		"8.8.8.8":         "Host",
+		"8.8.8.9":         "Narrow",
+		"8.8.9.0":         "Middle",
+		"8.9.0.0":         "Wide",
+		"8.255.255.255":   "Wide",
+		"2001:db8::1":     "DocV6Narrow",
+		"2001:db8:1::1":   "DocV6",
+		"255.254.0.0":     "Top",
+		"255.255.255.255": "TopNarrow",
+	}
+
+	for ip, expected := range testCases {
+		match, ok := idx.lookup(netip.MustParseAddr(ip))
+		if !ok {
+			t.Errorf("expected match for %s", ip)
+			continue
+		}
+		if idx.locations.country(match.location) != expected {
+			t.Errorf("expected %s for %s, got %s", expected, ip, idx.locations.country(match.location))
+		}
+	}
+}
+
+func TestRangeIndex_NoMatch(t *testing.T) {
+	idx := buildTestIndex(t, map[string]string{
+		"8.8.8.0/24":    "Narrow",
+		"2001:db8::/32": "DocV6",
+	})
+
+	for _, ip := range []string{"8.8.7.255", "8.8.9.0", "1.1.1.1", "2001:db9::1", "::1"} {
+		if _, ok := idx.lookup(netip.MustParseAddr(ip)); ok {
+			t.Errorf("expected no match for %s", ip)
+		}
+	}
+}
+
+func TestRangeIndex_ReportsMatchedNetwork(t *testing.T) {
+	idx := buildTestIndex(t, map[string]string{
+		"10.0.0.0/8":  "Wide",
+		"10.1.0.0/16": "Narrow",
+	})
+
+	match, ok := idx.lookup(netip.MustParseAddr("10.2.0.1"))
+	if !ok {
+		t.Fatal("expected match")
+	}
+	if match.network() != netip.MustParsePrefix("10.0.0.0/8") {
+		t.Errorf("expected network 10.0.0.0/8, got %s", match.network())
+	}
+}
+
+func TestRangeIndex_DuplicatePrefixLastWins(t *testing.T) {
+	table := newLocationTable()
+	idx := newPrefixIndex([]networkEntry{
+		{prefix: netip.MustParsePrefix("1.1.1.1/32"), location: table.intern("First", "", nil)},
+		{prefix: netip.MustParsePrefix("1.1.1.1/32"), location: table.intern("Second", "", nil)},
+	}, table)
+
+	match, ok := idx.lookup(netip.MustParseAddr("1.1.1.1"))
+	if !ok {
+		t.Fatal("expected match")
+	}
+	if idx.locations.country(match.location) != "Second" {
+		t.Errorf("expected last entry to win, got %s", idx.locations.country(match.location))
+	}
+}
+
+func TestRangeIndex_Empty(t *testing.T) {
+	idx := newPrefixIndex(nil, newLocationTable())
+	if _, ok := idx.lookup(netip.MustParseAddr("8.8.8.8")); ok {
+		t.Error("expected no match in empty index")
+	}
+}
+
+func TestBuildPrefixIndex_DuplicatePolicies(t *testing.T) {
+	// Building freezes the table, so every run interns into a fresh one
+	entries := func() ([]networkEntry, *locationTable) {
+		table := newLocationTable()
+		return []networkEntry{
+			{prefix: netip.MustParsePrefix("1.1.1.0/24"), location: table.intern("First", "", nil), row: 1},
+			{prefix: netip.MustParsePrefix("1.1.1.0/24"), location: table.intern("First", "", nil), row: 2},
+			{prefix: netip.MustParsePrefix("1.1.1.0/24"), location: table.intern("Second", "", nil), row: 3},
+		}, table
+	}
+
+	testCases := map[DuplicatePolicy]string{
+		DuplicateFirstWins: "First",
+		DuplicateLastWins:  "Second",
+	}
+
+	for policy, expected := range testCases {
+		report := newReportBuilder(LoadModeStrict)
+		entries, table := entries()
+		idx, err := buildPrefixIndex(entries, table, policy, report)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", policy, err)
+		}
+
+		match, _ := idx.lookup(netip.MustParseAddr("1.1.1.1"))
+		if idx.locations.country(match.location) != expected {
+			t.Errorf("%s: expected %s, got %s", policy, expected, idx.locations.country(match.location))
+		}
+		if report.report.Duplicates != 1 || report.report.Conflicts != 1 {
+			t.Errorf("%s: expected 1 duplicate and 1 conflict, got %+v", policy, report.report)
+		}
+	}
+}
+
+func TestBuildPrefixIndex_DuplicateError(t *testing.T) {
+	table := newLocationTable()
+	entries := []networkEntry{
+		{prefix: netip.MustParsePrefix("1.1.1.1/32"), location: table.intern("First", "", nil), row: 4},
+		{prefix: netip.MustParsePrefix("1.1.1.1/32"), location: table.intern("First", "", nil), row: 7},
+		{prefix: netip.MustParsePrefix("1.1.1.1/32"), location: table.intern("Second", "", nil), row: 9},
+	}
+
+	_, err := buildPrefixIndex(entries, table, DuplicateError, newReportBuilder(LoadModeStrict))
+	if err == nil {
+		t.Fatal("expected conflict error")
+	}
+	if !strings.Contains(err.Error(), "rows 4 and 9") {
+		t.Errorf("expected error to name rows 4 and 9, got: %v", err)
+	}
+
+	// Lenient mode keeps the first record and skips the conflicting one
+	report := newReportBuilder(LoadModeLenient)
+	idx, err := buildPrefixIndex(entries, table, DuplicateError, report)
+	if err != nil {
+		t.Fatalf("unexpected error in lenient mode: %v", err)
+	}
+	match, _ := idx.lookup(netip.MustParseAddr("1.1.1.1"))
+	if idx.locations.country(match.location) != "First" {
+		t.Errorf("expected first record to be kept, got %s", idx.locations.country(match.location))
+	}
+	if report.report.Skipped["conflict"] != 1 {
+		t.Errorf("expected 1 conflict skip, got %v", report.report.Skipped)
+	}
+}
+
+func TestBuildPrefixIndex_OverlapConflicts(t *testing.T) {
+	table := newLocationTable()
+	entries := []networkEntry{
+		{prefix: netip.MustParsePrefix("10.0.0.0/8"), location: table.intern("Wide", "", nil), row: 1},
+		{prefix: netip.MustParsePrefix("10.1.0.0/16"), location: table.intern("Wide", "", nil), row: 2},
+		{prefix: netip.MustParsePrefix("10.2.0.0/16"), location: table.intern("Other", "", nil), row: 3},
+	}
+
+	// Without the error policy the most specific network wins
+	report := newReportBuilder(LoadModeStrict)
+	idx, err := buildPrefixIndex(entries, table, DuplicateLastWins, report)
+	if err != nil {
+		t.Fatalf("nested networks must not fail a last-wins load: %v", err)
+	}
+	if report.report.OverlapConflicts != 1 {
+		t.Errorf("expected 1 overlap conflict, got %d", report.report.OverlapConflicts)
+	}
+	match, _ := idx.lookup(netip.MustParseAddr("10.2.0.1"))
+	if idx.locations.country(match.location) != "Other" {
+		t.Errorf("expected the nested network to win, got %s", idx.locations.country(match.location))
+	}
+
+	// The error policy rejects a nested network that changes country
+	_, err = buildPrefixIndex(entries, table, DuplicateError, newReportBuilder(LoadModeStrict))
+	if err == nil || !strings.Contains(err.Error(), "10.2.0.0/16 at row 3 nested in 10.0.0.0/8 at row 1") {
+		t.Fatalf("expected overlap conflict error naming both rows, got: %v", err)
+	}
+
+	// Lenient mode skips it, leaving the enclosing network to answer
+	report = newReportBuilder(LoadModeLenient)
+	idx, err = buildPrefixIndex(entries, table, DuplicateError, report)
+	if err != nil {
+		t.Fatalf("unexpected error in lenient mode: %v", err)
+	}
+	match, _ = idx.lookup(netip.MustParseAddr("10.2.0.1"))
+	if idx.locations.country(match.location) != "Wide" {
+		t.Errorf("expected the enclosing network to answer, got %s", idx.locations.country(match.location))
+	}
+	if report.report.Skipped["conflict"] != 1 || idx.records != 2 {
+		t.Errorf("expected 1 conflict skip and 2 records, got %v and %d", report.report.Skipped, idx.records)
+	}
+	if err := idx.validate(); err != nil {
+		t.Errorf("unexpected invalid index: %v", err)
+	}
+}
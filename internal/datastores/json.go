@@ -1,10 +1,12 @@
 package datastores
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
-	"os"
+	"io"
 	"sync"
 
 	"ip_country_project/internal/errors"
@@ -14,69 +16,207 @@ import (
 
 type JSONDataStore struct {
 	filePath string
-	data     map[string]*models.Location
+	index    *rangeIndex
 	mutex    sync.RWMutex
+	options  loadOptions
+	loadTracker
 }
 
-func NewJSONDataStore(filePath string) *JSONDataStore {
+func NewJSONDataStore(filePath string, opts ...Option) *JSONDataStore {
 	return &JSONDataStore{
 		filePath: filePath,
-		data:     make(map[string]*models.Location),
+		index:    newPrefixIndex(nil, newLocationTable()),
+		options:  applyOptions(opts),
 	}
 }
 
+// Load reads the JSON array or NDJSON file into a new index.
 func (j *JSONDataStore) Load(ctx context.Context) error {
-	file, err := os.Open(j.filePath)
+	return loadIndex(j.filePath, j.options.mode, &j.loadTracker, func(report *reportBuilder) (*rangeIndex, error) {
+		return j.buildIndex(ctx, report)
+	}, func(index *rangeIndex) {
+		j.mutex.Lock()
+		j.index = index
+		j.mutex.Unlock()
+	})
+}
+
+// buildIndex streams the file element by element into a fresh index
+// without touching the published one. Both a top-level array and NDJSON
+// (one object per line) are accepted; the first non-whitespace byte
+// decides which.
+func (j *JSONDataStore) buildIndex(ctx context.Context, report *reportBuilder) (*rangeIndex, error) {
+	file, err := openDataFile(j.filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open JSON file: %w", err)
+		return nil, fmt.Errorf("failed to open JSON file: %w", err)
 	}
 	defer file.Close()
 
-	var locations []models.Location
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&locations); err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
+	lines := &lineCounter{reader: file}
+	buffered := bufio.NewReader(lines)
+	array, err := isJSONArray(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(buffered)
+	if array {
+		// Consume the opening bracket so elements decode one at a time
+		if _, err := decoder.Token(); err != nil {
+			return nil, jsonSyntaxError(lines, decoder, err)
+		}
 	}
 
-	j.mutex.Lock()
-	defer j.mutex.Unlock()
+	locations := newLocationTable()
+	var entries []networkEntry
+	var raw json.RawMessage
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if array && !decoder.More() {
+			break
+		}
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF && !array {
+				break
+			}
+			return nil, jsonSyntaxError(lines, decoder, err)
+		}
+
+		// Decoding into a RawMessage first pins down where the element
+		// started, so errors point at its line rather than its end
+		line, _ := lines.position(decoder.InputOffset() - int64(len(raw)))
+		report.read()
 
-	for i, location := range locations {
-		if !utils.IsValidIP(location.IP) {
-			return fmt.Errorf("invalid IP address at index %d: %s", i, location.IP)
+		var location models.Location
+		if err := json.Unmarshal(raw, &location); err != nil {
+			if err := report.reject(line, skipInvalidFormat, fmt.Errorf("invalid JSON object at line %d: %w", line, err)); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		j.data[location.IP] = &models.Location{
-			IP:      location.IP,
-			City:    location.City,
-			Country: location.Country,
+		// The "ip" field holds either a single IP or a CIDR network
+		prefix, err := utils.ParseNetwork(location.IP)
+		if err != nil {
+			if err := report.reject(line, skipInvalidIP, fmt.Errorf("invalid IP address at line %d: %s", line, location.IP)); err != nil {
+				return nil, err
+			}
+			continue
 		}
+
+		entries = append(entries, networkEntry{
+			prefix:   prefix,
+			location: locations.intern(location.Country, location.City, location.Extra),
+			row:      line,
+		})
 	}
 
-	return nil
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return nil, jsonSyntaxError(lines, decoder, err)
+		}
+		// Anything after the closing bracket is a malformed file
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, jsonSyntaxError(lines, decoder, fmt.Errorf("unexpected data after top-level array"))
+		}
+	}
+
+	return buildPrefixIndex(entries, locations, j.options.duplicates, report)
+}
+
+// isJSONArray peeks past leading whitespace and reports whether the input
+// is a top-level array (true) or NDJSON (false). Nothing is consumed, so
+// decoder offsets still line up with the file.
+func isJSONArray(reader *bufio.Reader) (bool, error) {
+	for n := 1; ; n++ {
+		peeked, err := reader.Peek(n)
+		if len(peeked) < n {
+			if err == io.EOF {
+				return false, errors.ErrEmptyDataset
+			}
+			return false, fmt.Errorf("failed to read JSON: %w", err)
+		}
+
+		switch b := peeked[n-1]; b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true, nil
+		case '{':
+			return false, nil
+		default:
+			return false, fmt.Errorf("failed to parse JSON: expected an array or NDJSON objects, found %q", b)
+		}
+	}
+}
+
+// jsonSyntaxError locates a decoding error in the file. Syntax errors
+// carry the offset just past the offending byte; anything else happened
+// at the decoder's current position.
+func jsonSyntaxError(lines *lineCounter, decoder *json.Decoder, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	offset := decoder.InputOffset()
+	var syntaxErr *json.SyntaxError
+	if stderrors.As(err, &syntaxErr) {
+		offset = max(syntaxErr.Offset-1, 0)
+	}
+
+	line, column := lines.position(offset)
+	return fmt.Errorf("failed to parse JSON at line %d, column %d (offset %d): %w", line, column, offset, err)
 }
 
 func (j *JSONDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
-	if !utils.IsValidIP(ip) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
 		return nil, errors.ErrInvalidIP
 	}
 
 	j.mutex.RLock()
-	defer j.mutex.RUnlock()
-
-	location, exists := j.data[ip]
-	if !exists {
-		return nil, errors.ErrIPNotFound
-	}
+	index := j.index
+	j.mutex.RUnlock()
 
-	// Return a copy to avoid race conditions
-	return &models.Location{
-		IP:      location.IP,
-		City:    location.City,
-		Country: location.Country,
-	}, nil
+	return index.find(addr)
 }
 
 func (j *JSONDataStore) Close() error {
 	return nil
-}
\ No newline at end of file
+}
+
+// lineCounter tracks newlines in the bytes read through it so decoder
+// offsets can be reported as line and column. Positions must be queried
+// in increasing order; newlines before the last query are only counted,
+// which keeps memory bounded by the decoder's read-ahead.
+type lineCounter struct {
+	reader   io.Reader
+	read     int64
+	newlines []int64 // offsets of newlines at or after the last query
+	passed   int     // newlines before the last query
+	lastLine int64   // offset just past the last passed newline
+}
+
+func (l *lineCounter) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			l.newlines = append(l.newlines, l.read+int64(i))
+		}
+	}
+	l.read += int64(n)
+	return n, err
+}
+
+// position returns the 1-based line and column of a byte offset
+func (l *lineCounter) position(offset int64) (int, int) {
+	for len(l.newlines) > 0 && l.newlines[0] < offset {
+		l.lastLine = l.newlines[0] + 1
+		l.newlines = l.newlines[1:]
+		l.passed++
+	}
+	return l.passed + 1, int(offset-l.lastLine) + 1
+}
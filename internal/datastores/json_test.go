@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	appErrors "ip_country_project/internal/errors"
@@ -155,4 +156,174 @@ func TestJSONDataStore_Load_MissingFields(t *testing.T) {
 	if location.City != "Mountain View" {
 		t.Errorf("expected city 'Mountain View', got '%s'", location.City)
 	}
-}
\ No newline at end of file
+}
+
+func TestJSONDataStore_FindLocation_CIDR(t *testing.T) {
+	testData := `[
+		{"ip": "1.0.0.0/24", "city": "Research", "country": "Australia"},
+		{"ip": "2001:db8::/32", "city": "Documentation", "country": "Nowhere"}
+	]`
+	ds := setupTestJSONDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load JSON: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.0.0.1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Australia" {
+		t.Errorf("expected country 'Australia', got '%s'", location.Country)
+	}
+
+	location, err = ds.FindLocation(context.Background(), "2001:db8::1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Nowhere" {
+		t.Errorf("expected country 'Nowhere', got '%s'", location.Country)
+	}
+}
+
+func TestJSONDataStore_FindLocation_IPv6Canonical(t *testing.T) {
+	testData := `[
+		{"ip": "2001:DB8::8", "city": "Host", "country": "Nowhere"},
+		{"ip": "::ffff:8.8.8.8", "city": "Mountain View", "country": "United States"}
+	]`
+	ds := setupTestJSONDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load JSON: %v", err)
+	}
+
+	testCases := map[string]string{
+		"2001:db8::8":    "Host",
+		"2001:db8:0::8":  "Host",
+		"8.8.8.8":        "Mountain View",
+		"::ffff:8.8.8.8": "Mountain View",
+	}
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.City != expected {
+			t.Errorf("expected city '%s' for %s, got '%s'", expected, ip, location.City)
+		}
+	}
+}
+
+func TestJSONDataStore_Load_FailureKeepsPreviousData(t *testing.T) {
+	ds := setupTestJSONDatastore(t, `[{"ip": "8.8.8.8", "city": "Mountain View", "country": "United States"}]`)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load JSON: %v", err)
+	}
+
+	badData := `[
+		{"ip": "1.1.1.1", "city": "San Francisco", "country": "United States"},
+		{"ip": "invalid-ip", "city": "Nowhere", "country": "Nowhere"}
+	]`
+	if err := os.WriteFile(ds.filePath, []byte(badData), 0o644); err != nil {
+		t.Fatalf("failed to rewrite JSON: %v", err)
+	}
+	if err := ds.Load(context.Background()); err == nil {
+		t.Fatal("expected error loading JSON with invalid IP")
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); err != nil {
+		t.Errorf("expected previous data to keep serving, got error: %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "1.1.1.1"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected rows from failed load to be discarded, got: %v", err)
+	}
+	if ds.LoadStatus().LastError == "" {
+		t.Error("expected load status to expose the failure reason")
+	}
+}
+
+func TestJSONDataStore_Load_NDJSON(t *testing.T) {
+	testData := `{"ip": "8.8.8.8", "city": "Mountain View", "country": "United States"}
+{"ip": "1.1.1.0/24", "city": "Sydney", "country": "Australia"}
+
+{"ip": "2001:db8::/32", "country": "Nowhere"}
+`
+	ds := setupTestJSONDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load NDJSON: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.1.1.1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Australia" {
+		t.Errorf("expected 'Australia', got '%s'", location.Country)
+	}
+	if entries := ds.LoadStatus().Entries; entries != 3 {
+		t.Errorf("expected 3 entries, got %d", entries)
+	}
+}
+
+func TestJSONDataStore_Load_SyntaxErrorPosition(t *testing.T) {
+	tests := map[string]string{
+		"line 4, column 1": "[\n" +
+			`  {"ip": "8.8.8.8", "country": "United States"},` + "\n" +
+			`  {"ip": "1.1.1.1", "country": "Australia"` + "\n" +
+			"]\n",
+		"line 3, column 1": `{"ip": "8.8.8.8", "country": "United States"}` + "\n" +
+			`{"ip": "1.1.1.1", "country": "Australia"` + "\n" +
+			`{"ip": "9.9.9.9", "country": "Switzerland"}` + "\n",
+	}
+
+	for position, testData := range tests {
+		ds := setupTestJSONDatastore(t, testData)
+
+		err := ds.Load(context.Background())
+		if err == nil || !strings.Contains(err.Error(), position) {
+			t.Errorf("expected error at %s, got: %v", position, err)
+		}
+	}
+}
+
+func TestJSONDataStore_Load_LenientReportsLines(t *testing.T) {
+	testData := `[
+  {"ip": "8.8.8.8", "country": "United States"},
+  {"ip": "invalid-ip", "country": "Nowhere"},
+  {
+    "ip": 42,
+    "country": "Nowhere"
+  },
+  {"ip": "1.1.1.1", "country": "Australia"}
+]`
+	tmpFile := setupTestJSONDatastore(t, testData).filePath
+	ds := NewJSONDataStore(tmpFile, WithLoadMode(LoadModeLenient))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("expected lenient load to succeed, got: %v", err)
+	}
+
+	report := ds.LoadStatus().Report
+	if report.Accepted != 2 {
+		t.Errorf("expected 2 accepted, got %d", report.Accepted)
+	}
+	if report.Skipped[skipInvalidIP] != 1 || report.Skipped[skipInvalidFormat] != 1 {
+		t.Errorf("expected one invalid IP and one invalid object, got %v", report.Skipped)
+	}
+	// Rows are the lines where the offending objects start
+	if len(report.OffendingRows) != 2 || report.OffendingRows[0] != 3 || report.OffendingRows[1] != 4 {
+		t.Errorf("expected offending rows [3 4], got %v", report.OffendingRows)
+	}
+}
+
+func TestJSONDataStore_Load_Empty(t *testing.T) {
+	for _, testData := range []string{"", "  \n", "[]"} {
+		ds := setupTestJSONDatastore(t, testData)
+
+		if err := ds.Load(context.Background()); !errors.Is(err, appErrors.ErrEmptyDataset) {
+			t.Errorf("expected ErrEmptyDataset for %q, got: %v", testData, err)
+		}
+	}
+}
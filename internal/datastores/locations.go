@@ -0,0 +1,129 @@
+package datastores
+
+import (
+	"encoding/binary"
+	"maps"
+	"slices"
+
+	"ip_country_project/internal/models"
+)
+
+// locationTable interns the locations of a dataset. Every distinct string
+// is stored once and every distinct location is a small record of string
+// IDs, so ranges only carry a uint32 reference. A multi-million-row
+// dataset with a few thousand distinct cities holds a few thousand
+// strings rather than one copy per row.
+type locationTable struct {
+	strings   []string
+	locations []internedLocation
+	extras    []internedExtra
+
+	// Lookup maps used while loading; dropped by freeze
+	stringIDs   map[string]uint32
+	locationIDs map[locationKey]uint32
+}
+
+// internedLocation is a location as string IDs. Its extra columns are
+// extras[extraStart : extraStart+extraCount].
+type internedLocation struct {
+	country    uint32
+	city       uint32
+	extraStart uint32
+	extraCount uint32
+}
+
+type internedExtra struct {
+	name  uint32
+	value uint32
+}
+
+// locationKey identifies a location by content. extras packs the sorted
+// extra string IDs and is empty for plain country/city rows.
+type locationKey struct {
+	country uint32
+	city    uint32
+	extras  string
+}
+
+func newLocationTable() *locationTable {
+	return &locationTable{
+		stringIDs:   make(map[string]uint32),
+		locationIDs: make(map[locationKey]uint32),
+	}
+}
+
+// intern returns the ID of a location with the given content, adding it
+// if it hasn't been seen yet
+func (t *locationTable) intern(country, city string, extra map[string]string) uint32 {
+	key := locationKey{country: t.internString(country), city: t.internString(city)}
+
+	var pairs []internedExtra
+	if len(extra) > 0 {
+		names := slices.Sorted(maps.Keys(extra))
+		packed := make([]byte, 0, len(names)*8)
+		for _, name := range names {
+			pair := internedExtra{name: t.internString(name), value: t.internString(extra[name])}
+			pairs = append(pairs, pair)
+			packed = binary.LittleEndian.AppendUint32(packed, pair.name)
+			packed = binary.LittleEndian.AppendUint32(packed, pair.value)
+		}
+		key.extras = string(packed)
+	}
+
+	if id, ok := t.locationIDs[key]; ok {
+		return id
+	}
+
+	id := uint32(len(t.locations))
+	t.locations = append(t.locations, internedLocation{
+		country:    key.country,
+		city:       key.city,
+		extraStart: uint32(len(t.extras)),
+		extraCount: uint32(len(pairs)),
+	})
+	t.extras = append(t.extras, pairs...)
+	t.locationIDs[key] = id
+	return id
+}
+
+func (t *locationTable) internString(s string) uint32 {
+	if id, ok := t.stringIDs[s]; ok {
+		return id
+	}
+	id := uint32(len(t.strings))
+	t.strings = append(t.strings, s)
+	t.stringIDs[s] = id
+	return id
+}
+
+// freeze releases the build-time maps once loading is done. The table is
+// read-only afterwards.
+func (t *locationTable) freeze() {
+	t.stringIDs = nil
+	t.locationIDs = nil
+	t.strings = slices.Clip(t.strings)
+	t.locations = slices.Clip(t.locations)
+	t.extras = slices.Clip(t.extras)
+}
+
+// country returns the country name of location id
+func (t *locationTable) country(id uint32) string {
+	return t.strings[t.locations[id].country]
+}
+
+// location materializes location id. The result is a fresh copy the
+// caller may modify.
+func (t *locationTable) location(id uint32) *models.Location {
+	interned := t.locations[id]
+	location := &models.Location{
+		Country: t.strings[interned.country],
+		City:    t.strings[interned.city],
+	}
+	if interned.extraCount > 0 {
+		location.Extra = make(map[string]string, interned.extraCount)
+		for _, pair := range t.extras[interned.extraStart : interned.extraStart+interned.extraCount] {
+			location.Extra[t.strings[pair.name]] = t.strings[pair.value]
+		}
+	}
+	return location
+}
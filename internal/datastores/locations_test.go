@@ -0,0 +1,146 @@
+package datastores
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"ip_country_project/internal/models"
+)
+
+func TestLocationTable_Interning(t *testing.T) {
+	table := newLocationTable()
+
+	first := table.intern("United States", "Mountain View", nil)
+	second := table.intern("United States", "Mountain View", nil)
+	other := table.intern("United States", "San Francisco", nil)
+	if first != second {
+		t.Errorf("expected identical locations to share an ID, got %d and %d", first, second)
+	}
+	if first == other {
+		t.Error("expected different cities to get different IDs")
+	}
+
+	tagged := table.intern("United States", "Mountain View", map[string]string{"asn": "15169", "isp": "Google"})
+	reordered := table.intern("United States", "Mountain View", map[string]string{"isp": "Google", "asn": "15169"})
+	if tagged == first || tagged != reordered {
+		t.Errorf("expected extras to be part of the identity, got %d, %d and %d", first, tagged, reordered)
+	}
+
+	// "United States", "Mountain View", "San Francisco", "asn", "15169", "isp", "Google"
+	if len(table.strings) != 7 {
+		t.Errorf("expected 7 interned strings, got %d: %q", len(table.strings), table.strings)
+	}
+	if len(table.locations) != 3 {
+		t.Errorf("expected 3 distinct locations, got %d", len(table.locations))
+	}
+
+	table.freeze()
+	location := table.location(tagged)
+	if location.Country != "United States" || location.City != "Mountain View" || location.Extra["isp"] != "Google" {
+		t.Errorf("unexpected location: %+v", location)
+	}
+
+	// Callers get a copy and must not be able to corrupt the table
+	location.Extra["isp"] = "Changed"
+	if table.location(tagged).Extra["isp"] != "Google" {
+		t.Error("expected location to return a fresh copy")
+	}
+}
+
+// writeBenchmarkCSV writes rows distinct IPs spread over a realistic number
+// of countries and cities
+func writeBenchmarkCSV(b *testing.B, rows int) string {
+	b.Helper()
+
+	path := filepath.Join(b.TempDir(), "bench.csv")
+	var data strings.Builder
+	addr := netip.MustParseAddr("1.0.0.0")
+	for i := range rows {
+		fmt.Fprintf(&data, "%s,City %d,Country %d\n", addr, i%5000, i%250)
+		addr = addr.Next()
+	}
+	if err := os.WriteFile(path, []byte(data.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// loadLocationMap builds the per-entry map the CSV datastore used before
+// locations were interned, as the baseline for the memory benchmark
+func loadLocationMap(path string) (map[string]*models.Location, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]*models.Location, len(records))
+	for _, record := range records {
+		data[record[0]] = &models.Location{IP: record[0], City: record[1], Country: record[2]}
+	}
+	return data, nil
+}
+
+// retainedHeap reports how many heap bytes the value built by load keeps
+// alive once garbage from loading has been collected
+func retainedHeap(b *testing.B, load func() (any, error)) uint64 {
+	b.Helper()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	value, err := load()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(value)
+
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return after.HeapAlloc - before.HeapAlloc
+}
+
+// BenchmarkLocationStorage compares the heap retained by a loaded dataset
+// against a map of one *models.Location per entry. Run with
+// go test -run '^$' -bench LocationStorage ./internal/datastores
+func BenchmarkLocationStorage(b *testing.B) {
+	const rows = 200_000
+	path := writeBenchmarkCSV(b, rows)
+
+	b.Run("map", func(b *testing.B) {
+		var retained uint64
+		for b.Loop() {
+			retained = retainedHeap(b, func() (any, error) {
+				return loadLocationMap(path)
+			})
+		}
+		b.ReportMetric(float64(retained)/rows, "bytes/entry")
+	})
+
+	b.Run("interned", func(b *testing.B) {
+		var retained uint64
+		for b.Loop() {
+			retained = retainedHeap(b, func() (any, error) {
+				ds := NewCSVDataStore(path)
+				return ds, ds.Load(context.Background())
+			})
+		}
+		b.ReportMetric(float64(retained)/rows, "bytes/entry")
+	})
+}
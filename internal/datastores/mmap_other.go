@@ -0,0 +1,14 @@
+//go:build !unix
+
+package datastores
+
+import "os"
+
+// mapFile falls back to a single read where mmap isn't available
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
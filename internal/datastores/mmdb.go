@@ -0,0 +1,133 @@
+package datastores
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+// mmdbLanguage selects which entry of MaxMind "names" maps is used
+const mmdbLanguage = "en"
+
+// MMDBDataStore reads MaxMind GeoLite2/GeoIP2 .mmdb files directly,
+// without cgo or the libmaxminddb C library
+type MMDBDataStore struct {
+	filePath string
+	reader   *mmdbReader
+	mutex    sync.RWMutex
+	loadTracker
+}
+
+func NewMMDBDataStore(filePath string) *MMDBDataStore {
+	return &MMDBDataStore{
+		filePath: filePath,
+	}
+}
+
+// Load parses and validates the database before publishing it. On failure
+// the previously loaded database keeps serving.
+func (m *MMDBDataStore) Load(ctx context.Context) error {
+	reader, err := m.openReader()
+	if err != nil {
+		m.recordFailure(err, nil)
+		return err
+	}
+
+	m.mutex.Lock()
+	m.reader = reader
+	m.mutex.Unlock()
+
+	// MMDB files don't record a network count; report search tree nodes
+	m.recordSuccess(int(reader.metadata.NodeCount), nil)
+	return nil
+}
+
+func (m *MMDBDataStore) openReader() (*mmdbReader, error) {
+	// The whole database is read into memory; GeoLite2-City is ~70MB
+	buffer, err := os.ReadFile(m.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MMDB file: %w", err)
+	}
+
+	reader, err := newMMDBReader(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MMDB file: %w", err)
+	}
+	if reader.metadata.NodeCount == 0 {
+		return nil, errors.ErrEmptyDataset
+	}
+	return reader, nil
+}
+
+func (m *MMDBDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+
+	m.mutex.RLock()
+	reader := m.reader
+	m.mutex.RUnlock()
+
+	if reader == nil {
+		return nil, errors.ErrIPNotFound
+	}
+
+	record, _, found, err := reader.lookup(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MMDB record: %w", err)
+	}
+	if !found {
+		return nil, errors.ErrIPNotFound
+	}
+
+	location := mmdbLocation(record)
+	if location.Country == "" && location.City == "" {
+		return nil, errors.ErrIPNotFound
+	}
+	location.IP = addr.String()
+
+	return location, nil
+}
+
+func (m *MMDBDataStore) Close() error {
+	return nil
+}
+
+// mmdbLocation maps a GeoIP2 Country/City record onto models.Location.
+// registered_country is used when the record has no physical country,
+// e.g. for anycast networks.
+func mmdbLocation(record any) *models.Location {
+	fields, _ := record.(map[string]any)
+
+	country := mmdbName(fields["country"])
+	if country == "" {
+		country = mmdbName(fields["registered_country"])
+	}
+
+	return &models.Location{
+		Country: country,
+		City:    mmdbName(fields["city"]),
+	}
+}
+
+// mmdbName extracts the localized name from a GeoIP2 entity, falling back
+// to its ISO code when no name is present
+func mmdbName(entity any) string {
+	fields, ok := entity.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if names, ok := fields["names"].(map[string]any); ok {
+		if name, ok := names[mmdbLanguage].(string); ok && name != "" {
+			return name
+		}
+	}
+	code, _ := fields["iso_code"].(string)
+	return code
+}
@@ -0,0 +1,487 @@
+package datastores
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"sync"
+)
+
+// mmdbMetadataMarker precedes the metadata map at the end of every MMDB file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbDataSeparatorSize is the run of zero bytes between the search tree
+// and the data section
+const mmdbDataSeparatorSize = 16
+
+// mmdbMaxDepth bounds nested maps/arrays/pointers so a corrupt file can't
+// recurse forever
+const mmdbMaxDepth = 64
+
+// MMDB data section type numbers
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBoolean   = 14
+	mmdbFloat     = 15
+)
+
+// mmdbMetadata holds the metadata fields the reader needs
+type mmdbMetadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+	MajorVersion uint
+	BuildEpoch   uint
+}
+
+// mmdbReader parses the MaxMind DB binary format: a binary search tree
+// over address bits followed by a data section of typed values.
+// See https://maxmind.github.io/MaxMind-DB/ for the specification.
+type mmdbReader struct {
+	buffer    []byte
+	metadata  mmdbMetadata
+	tree      []byte
+	data      []byte
+	ipv4Start uint
+
+	// flat is the tree flattened for network queries, built on first use
+	flatOnce sync.Once
+	flat     *rangeIndex
+	flatErr  error
+}
+
+func newMMDBReader(buffer []byte) (*mmdbReader, error) {
+	markerAt := bytes.LastIndex(buffer, mmdbMetadataMarker)
+	if markerAt < 0 {
+		return nil, fmt.Errorf("metadata marker not found")
+	}
+
+	metaStart := markerAt + len(mmdbMetadataMarker)
+	raw, _, err := (&mmdbDecoder{buffer: buffer[metaStart:]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("metadata is not a map")
+	}
+
+	metadata := mmdbMetadata{
+		NodeCount:    mmdbUint(fields["node_count"]),
+		RecordSize:   mmdbUint(fields["record_size"]),
+		IPVersion:    mmdbUint(fields["ip_version"]),
+		MajorVersion: mmdbUint(fields["binary_format_major_version"]),
+		BuildEpoch:   mmdbUint(fields["build_epoch"]),
+	}
+	metadata.DatabaseType, _ = fields["database_type"].(string)
+
+	if metadata.MajorVersion != 2 {
+		return nil, fmt.Errorf("unsupported binary format version %d", metadata.MajorVersion)
+	}
+	if metadata.RecordSize != 24 && metadata.RecordSize != 28 && metadata.RecordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", metadata.RecordSize)
+	}
+	if metadata.IPVersion != 4 && metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", metadata.IPVersion)
+	}
+
+	treeSize := metadata.NodeCount * metadata.RecordSize / 4
+	dataStart := treeSize + mmdbDataSeparatorSize
+	if dataStart > uint(markerAt) {
+		return nil, fmt.Errorf("search tree of %d nodes exceeds file size", metadata.NodeCount)
+	}
+
+	r := &mmdbReader{
+		buffer:   buffer,
+		metadata: metadata,
+		tree:     buffer[:treeSize],
+		data:     buffer[dataStart:markerAt],
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 trees
+	if metadata.IPVersion == 6 {
+		node := uint(0)
+		for depth := 0; depth < 96 && node < metadata.NodeCount; depth++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// lookup walks the search tree and returns the decoded record for addr along
+// with the prefix length of the matched network
+func (r *mmdbReader) lookup(addr netip.Addr) (any, int, bool, error) {
+	var bits []byte
+	var node uint
+
+	if addr.Is4() {
+		if r.metadata.IPVersion == 6 {
+			node = r.ipv4Start
+		}
+		b := addr.As4()
+		bits = b[:]
+	} else {
+		if r.metadata.IPVersion == 4 {
+			return nil, 0, false, nil
+		}
+		b := addr.As16()
+		bits = b[:]
+	}
+
+	// For IPv4 in an IPv6 tree, a record found above depth 96 covers the
+	// whole IPv4 space and the loop below never runs, giving a /0
+	bitCount := len(bits) * 8
+	prefixLen := 0
+	for ; prefixLen < bitCount && node < r.metadata.NodeCount; prefixLen++ {
+		bit := (bits[prefixLen/8] >> (7 - uint(prefixLen%8))) & 1
+		node = r.readRecord(node, uint(bit))
+	}
+
+	if node == r.metadata.NodeCount {
+		return nil, 0, false, nil
+	}
+	if node < r.metadata.NodeCount {
+		return nil, 0, false, fmt.Errorf("search tree ended without a record")
+	}
+
+	dataOffset := node - r.metadata.NodeCount - mmdbDataSeparatorSize
+	if dataOffset >= uint(len(r.data)) {
+		return nil, 0, false, fmt.Errorf("data pointer %d out of range", dataOffset)
+	}
+
+	value, _, err := (&mmdbDecoder{buffer: r.data}).decode(dataOffset, 0)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return value, prefixLen, true, nil
+}
+
+// noLocation marks data records that map to no usable location
+const noLocation = ^uint32(0)
+
+// flattened returns the search tree as an index, built on first use
+func (r *mmdbReader) flattened() (*rangeIndex, error) {
+	r.flatOnce.Do(func() {
+		r.flat, r.flatErr = r.index()
+	})
+	return r.flat, r.flatErr
+}
+
+// index walks the whole search tree and flattens it into a rangeIndex.
+// IPv4 networks in IPv6 trees are reported once, as IPv4, rather than
+// under each IPv6 alias of the IPv4 subtree.
+func (r *mmdbReader) index() (*rangeIndex, error) {
+	bitCount := 32
+	if r.metadata.IPVersion == 6 {
+		bitCount = 128
+	}
+
+	decoder := &mmdbDecoder{buffer: r.data}
+	locations := newLocationTable()
+	// Networks sharing a data record share its interned location
+	recordLocations := make(map[uint]uint32)
+	var entries []networkEntry
+
+	var walk func(node uint, path [16]byte, depth int) error
+	walk = func(node uint, path [16]byte, depth int) error {
+		if node == r.metadata.NodeCount {
+			return nil
+		}
+		if node > r.metadata.NodeCount {
+			dataOffset := node - r.metadata.NodeCount - mmdbDataSeparatorSize
+			id, ok := recordLocations[dataOffset]
+			if !ok {
+				if dataOffset >= uint(len(r.data)) {
+					return fmt.Errorf("data pointer %d out of range", dataOffset)
+				}
+				record, _, err := decoder.decode(dataOffset, 0)
+				if err != nil {
+					return err
+				}
+				location := mmdbLocation(record)
+				if location.Country == "" && location.City == "" {
+					// Skipped like FindLocation skips it
+					id = noLocation
+				} else {
+					id = locations.intern(location.Country, location.City, nil)
+				}
+				recordLocations[dataOffset] = id
+			}
+			if id != noLocation {
+				entries = append(entries, networkEntry{prefix: r.networkPrefix(path, depth), location: id})
+			}
+			return nil
+		}
+		if depth == bitCount {
+			return fmt.Errorf("search tree deeper than %d bits", bitCount)
+		}
+		if bitCount == 128 && node == r.ipv4Start && depth > 0 && !(depth == 96 && path == [16]byte{}) {
+			return nil
+		}
+
+		for side := uint(0); side < 2; side++ {
+			next := path
+			if side == 1 {
+				next[depth/8] |= 0x80 >> uint(depth%8)
+			}
+			if err := walk(r.readRecord(node, side), next, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(0, [16]byte{}, 0); err != nil {
+		return nil, fmt.Errorf("failed to walk search tree: %w", err)
+	}
+	return buildPrefixIndex(entries, locations, DuplicateLastWins, newReportBuilder(LoadModeLenient))
+}
+
+// networkPrefix converts a search tree path to a network, mapping ::/96
+// in IPv6 trees back to IPv4
+func (r *mmdbReader) networkPrefix(path [16]byte, depth int) netip.Prefix {
+	if r.metadata.IPVersion == 4 {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(path[:4])), depth)
+	}
+	if depth >= 96 && [12]byte(path[:12]) == [12]byte{} {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(path[12:])), depth-96)
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(path), depth)
+}
+
+// readRecord reads the left (0) or right (1) record of a tree node
+func (r *mmdbReader) readRecord(node, side uint) uint {
+	switch r.metadata.RecordSize {
+	case 24:
+		b := r.tree[node*6+side*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if side == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.tree[node*8+side*4:]))
+	}
+}
+
+// mmdbDecoder decodes values from an MMDB data section. Pointer offsets
+// are relative to the start of buffer.
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+// decode returns the value at offset and the offset just past it
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("maximum nesting depth exceeded")
+	}
+
+	typeNum, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == mmdbPointer {
+		target, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+
+	switch typeNum {
+	case mmdbMap:
+		result := make(map[string]any, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at offset %d is not a string", offset)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[keyString] = value
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbArray:
+		result := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbBoolean:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	payload, next, err := d.slice(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typeNum {
+	case mmdbString:
+		return string(payload), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var n uint64
+		for _, b := range payload {
+			n = n<<8 | uint64(b)
+		}
+		return n, next, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var n uint32
+		for _, b := range payload {
+			n = n<<8 | uint32(b)
+		}
+		if size == 4 {
+			return int64(int32(n)), next, nil
+		}
+		return int64(n), next, nil
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(payload), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown data type %d at offset %d", typeNum, offset)
+}
+
+// decodeControl reads a control byte (and any extended type and size bytes)
+func (d *mmdbDecoder) decodeControl(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buffer)) {
+		return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+	control := d.buffer[offset]
+	offset++
+
+	typeNum := int(control >> 5)
+	if typeNum == mmdbExtended {
+		if offset >= uint(len(d.buffer)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+		}
+		typeNum = 7 + int(d.buffer[offset])
+		offset++
+	}
+
+	// Pointers pack their own size bits; hand back the raw control bits
+	if typeNum == mmdbPointer {
+		return typeNum, uint(control & 0x1F), offset, nil
+	}
+
+	size := uint(control & 0x1F)
+	if size >= 29 {
+		extra := int(size) - 28
+		bytes, next, err := d.slice(offset, uint(extra))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var n uint
+		for _, b := range bytes {
+			n = n<<8 | uint(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+		offset = next
+	}
+
+	return typeNum, size, offset, nil
+}
+
+// decodePointer resolves a pointer's target offset from its size bits
+func (d *mmdbDecoder) decodePointer(bits uint, offset uint) (uint, uint, error) {
+	pointerSize := (bits >> 3) & 0x3
+	payload, next, err := d.slice(offset, pointerSize+1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var n uint
+	if pointerSize != 3 {
+		n = bits & 0x7
+	}
+	for _, b := range payload {
+		n = n<<8 | uint(b)
+	}
+
+	switch pointerSize {
+	case 1:
+		n += 2048
+	case 2:
+		n += 526336
+	}
+
+	return n, next, nil
+}
+
+func (d *mmdbDecoder) slice(offset, size uint) ([]byte, uint, error) {
+	end := offset + size
+	if end > uint(len(d.buffer)) || end < offset {
+		return nil, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+	return d.buffer[offset:end], end, nil
+}
+
+// mmdbUint converts a decoded unsigned integer to uint
+func mmdbUint(value any) uint {
+	n, _ := value.(uint64)
+	return uint(n)
+}
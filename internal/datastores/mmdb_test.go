@@ -0,0 +1,409 @@
+package datastores
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	appErrors "ip_country_project/internal/errors"
+)
+
+// testMMDBNetwork is one network to write into a generated test database
+type testMMDBNetwork struct {
+	network string
+	record  map[string]any
+}
+
+// buildTestMMDB writes a minimal but spec-compliant MMDB file. Records are
+// indexed as: -1 empty, >= 0 child node, <= -2 data entry -(2+i).
+func buildTestMMDB(t *testing.T, ipVersion, recordSize int, networks []testMMDBNetwork) []byte {
+	t.Helper()
+
+	nodes := [][2]int{{-1, -1}}
+	var data [][]byte
+
+	for i, n := range networks {
+		prefix := netip.MustParsePrefix(n.network)
+		addr := prefix.Addr()
+		bits := prefix.Bits()
+
+		var raw []byte
+		if ipVersion == 6 {
+			if addr.Is4() {
+				// IPv4 networks live under ::/96
+				b4 := addr.As4()
+				var b16 [16]byte
+				copy(b16[12:], b4[:])
+				addr = netip.AddrFrom16(b16)
+				bits += 96
+			}
+			b := addr.As16()
+			raw = b[:]
+		} else {
+			b := addr.As4()
+			raw = b[:]
+		}
+
+		data = append(data, encodeTestMMDB(t, n.record))
+		marker := -(2 + i)
+
+		node := 0
+		for depth := 0; depth < bits; depth++ {
+			bit := int(raw[depth/8]>>(7-uint(depth%8))) & 1
+			if depth == bits-1 {
+				nodes[node][bit] = marker
+				break
+			}
+			next := nodes[node][bit]
+			if next < 0 {
+				// Split an empty or data record into a new node, keeping any
+				// wider network's data on both sides
+				nodes = append(nodes, [2]int{next, next})
+				next = len(nodes) - 1
+				nodes[node][bit] = next
+			}
+			node = next
+		}
+	}
+
+	nodeCount := len(nodes)
+	offsets := make([]int, len(data))
+	var dataSection []byte
+	for i, d := range data {
+		offsets[i] = len(dataSection)
+		dataSection = append(dataSection, d...)
+	}
+
+	resolve := func(record int) uint32 {
+		switch {
+		case record == -1:
+			return uint32(nodeCount)
+		case record >= 0:
+			return uint32(record)
+		default:
+			return uint32(nodeCount + mmdbDataSeparatorSize + offsets[-record-2])
+		}
+	}
+
+	var tree []byte
+	for _, node := range nodes {
+		left, right := resolve(node[0]), resolve(node[1])
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left),
+				byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left),
+				byte((left>>20)&0xF0)|byte((right>>24)&0x0F),
+				byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, left)
+			tree = binary.BigEndian.AppendUint32(tree, right)
+		}
+	}
+
+	metadata := encodeTestMMDB(t, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(ipVersion),
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"database_type":               "Test-City",
+		"build_epoch":                 uint64(1700000000),
+		"languages":                   []any{"en"},
+	})
+
+	var file []byte
+	file = append(file, tree...)
+	file = append(file, make([]byte, mmdbDataSeparatorSize)...)
+	file = append(file, dataSection...)
+	file = append(file, mmdbMetadataMarker...)
+	file = append(file, metadata...)
+	return file
+}
+
+// encodeTestMMDB encodes the subset of MMDB types the tests need
+func encodeTestMMDB(t *testing.T, value any) []byte {
+	t.Helper()
+
+	control := func(typeNum, size int) []byte {
+		var out []byte
+		var extra []byte
+		switch {
+		case size < 29:
+		case size < 285:
+			extra = []byte{byte(size - 29)}
+			size = 29
+		default:
+			n := size - 285
+			extra = []byte{byte(n >> 8), byte(n)}
+			size = 30
+		}
+		if typeNum > 7 {
+			out = append(out, byte(size), byte(typeNum-7))
+		} else {
+			out = append(out, byte(typeNum<<5|size))
+		}
+		return append(out, extra...)
+	}
+	uintBytes := func(n uint64) []byte {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		return b
+	}
+
+	switch v := value.(type) {
+	case string:
+		return append(control(mmdbString, len(v)), v...)
+	case uint16:
+		b := uintBytes(uint64(v))
+		return append(control(mmdbUint16, len(b)), b...)
+	case uint32:
+		b := uintBytes(uint64(v))
+		return append(control(mmdbUint32, len(b)), b...)
+	case uint64:
+		b := uintBytes(v)
+		return append(control(mmdbUint64, len(b)), b...)
+	case bool:
+		if v {
+			return control(mmdbBoolean, 1)
+		}
+		return control(mmdbBoolean, 0)
+	case []any:
+		out := control(mmdbArray, len(v))
+		for _, item := range v {
+			out = append(out, encodeTestMMDB(t, item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := control(mmdbMap, len(v))
+		for _, k := range keys {
+			out = append(out, encodeTestMMDB(t, k)...)
+			out = append(out, encodeTestMMDB(t, v[k])...)
+		}
+		return out
+	}
+
+	t.Fatalf("unsupported test MMDB value %T", value)
+	return nil
+}
+
+func testCityRecord(city, country, isoCode string) map[string]any {
+	record := map[string]any{
+		"country": map[string]any{
+			"iso_code": isoCode,
+			"names":    map[string]any{"en": country, "de": country + "-de"},
+		},
+	}
+	if city != "" {
+		record["city"] = map[string]any{
+			"geoname_id": uint32(5375480),
+			"names":      map[string]any{"en": city},
+		}
+	}
+	return record
+}
+
+// Helper function to write a generated MMDB file and create a datastore
+func setupTestMMDBDatastore(t *testing.T, ipVersion, recordSize int, networks []testMMDBNetwork) *MMDBDataStore {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buildTestMMDB(t, ipVersion, recordSize, networks), 0o644); err != nil {
+		t.Fatalf("failed to write MMDB file: %v", err)
+	}
+
+	return NewMMDBDataStore(path)
+}
+
+func testMMDBNetworks() []testMMDBNetwork {
+	return []testMMDBNetwork{
+		{network: "8.8.8.0/24", record: testCityRecord("Mountain View", "United States", "US")},
+		{network: "1.0.0.0/24", record: testCityRecord("", "Australia", "AU")},
+		{network: "77.88.0.0/16", record: testCityRecord("Moscow", "Russia", "RU")},
+		{network: "2001:db8::/32", record: testCityRecord("Berlin", "Germany", "DE")},
+		{network: "9.9.9.0/24", record: map[string]any{
+			"registered_country": map[string]any{"iso_code": "CH"},
+		}},
+	}
+}
+
+func TestMMDBDataStore_FindLocation_Success(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		ds := setupTestMMDBDatastore(t, 6, recordSize, testMMDBNetworks())
+		if err := ds.Load(context.Background()); err != nil {
+			t.Fatalf("record size %d: failed to load MMDB: %v", recordSize, err)
+		}
+
+		testCases := map[string][2]string{
+			"8.8.8.8":     {"United States", "Mountain View"},
+			"1.0.0.1":     {"Australia", ""},
+			"77.88.8.8":   {"Russia", "Moscow"},
+			"2001:db8::1": {"Germany", "Berlin"},
+			"9.9.9.9":     {"CH", ""},
+			// IPv4-mapped queries resolve through the IPv4 subtree
+			"::ffff:8.8.8.8": {"United States", "Mountain View"},
+			"2001:DB8::1":    {"Germany", "Berlin"},
+		}
+
+		for ip, expected := range testCases {
+			location, err := ds.FindLocation(context.Background(), ip)
+			if err != nil {
+				t.Fatalf("record size %d: expected successful lookup for %s, got error: %v", recordSize, ip, err)
+			}
+			if location.Country != expected[0] || location.City != expected[1] {
+				t.Errorf("record size %d: expected %v for %s, got %s/%s", recordSize, expected, ip, location.Country, location.City)
+			}
+		}
+	}
+}
+
+func TestMMDBDataStore_FindLocation_IPv4Database(t *testing.T) {
+	networks := testMMDBNetworks()[:3]
+	ds := setupTestMMDBDatastore(t, 4, 24, networks)
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load MMDB: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "77.88.1.2")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Russia" {
+		t.Errorf("expected country 'Russia', got '%s'", location.Country)
+	}
+
+	_, err = ds.FindLocation(context.Background(), "2001:db8::1")
+	if !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound for IPv6 in IPv4 database, got %v", err)
+	}
+}
+
+func TestMMDBDataStore_FindLocation_NotFound(t *testing.T) {
+	ds := setupTestMMDBDatastore(t, 6, 24, testMMDBNetworks())
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load MMDB: %v", err)
+	}
+
+	for _, ip := range []string{"8.8.9.1", "192.0.2.1", "2001:db9::1"} {
+		_, err := ds.FindLocation(context.Background(), ip)
+		if !errors.Is(err, appErrors.ErrIPNotFound) {
+			t.Errorf("expected ErrIPNotFound for %s, got %v", ip, err)
+		}
+	}
+}
+
+func TestMMDBDataStore_FindLocation_InvalidIP(t *testing.T) {
+	ds := setupTestMMDBDatastore(t, 6, 24, testMMDBNetworks())
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load MMDB: %v", err)
+	}
+
+	_, err := ds.FindLocation(context.Background(), "invalid-ip")
+	if !errors.Is(err, appErrors.ErrInvalidIP) {
+		t.Errorf("expected ErrInvalidIP, got %v", err)
+	}
+}
+
+func TestMMDBDataStore_Load_InvalidFile(t *testing.T) {
+	ds := NewMMDBDataStore("nonexistent.mmdb")
+	if err := ds.Load(context.Background()); err == nil {
+		t.Error("expected error loading nonexistent file")
+	}
+
+	path := filepath.Join(t.TempDir(), "garbage.mmdb")
+	_ = os.WriteFile(path, []byte("not an mmdb file"), 0o644)
+	if err := NewMMDBDataStore(path).Load(context.Background()); err == nil {
+		t.Error("expected error loading file without metadata")
+	}
+}
+
+func TestMMDBReader_PrefixLength(t *testing.T) {
+	reader, err := newMMDBReader(buildTestMMDB(t, 6, 24, testMMDBNetworks()))
+	if err != nil {
+		t.Fatalf("failed to parse MMDB: %v", err)
+	}
+
+	testCases := map[string]int{
+		"8.8.8.8":     24,
+		"77.88.1.1":   16,
+		"2001:db8::1": 32,
+	}
+	for ip, expected := range testCases {
+		_, prefixLen, found, err := reader.lookup(netip.MustParseAddr(ip))
+		if err != nil || !found {
+			t.Fatalf("expected match for %s, got found=%v err=%v", ip, found, err)
+		}
+		if prefixLen != expected {
+			t.Errorf("expected prefix length %d for %s, got %d", expected, ip, prefixLen)
+		}
+	}
+}
+
+func TestMMDBDecoder_Pointers(t *testing.T) {
+	// A string at offset 0 and at each pointer size boundary
+	target := []byte{byte(mmdbString<<5 | 2), 'o', 'k'}
+	buffer := make([]byte, 526336+len(target))
+	copy(buffer, target)
+	copy(buffer[2048:], target)
+	copy(buffer[526336:], target)
+
+	pointers := map[string][]byte{
+		"size 0": {byte(mmdbPointer<<5 | 0<<3), 0x00},
+		"size 1": {byte(mmdbPointer<<5 | 1<<3), 0x00, 0x00},
+		"size 2": {byte(mmdbPointer<<5 | 2<<3), 0x00, 0x00, 0x00},
+		"size 3": {byte(mmdbPointer<<5 | 3<<3), 0x00, 0x00, 0x00, 0x00},
+	}
+
+	for name, pointer := range pointers {
+		d := &mmdbDecoder{buffer: append(append([]byte(nil), buffer...), pointer...)}
+		value, next, err := d.decode(uint(len(buffer)), 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if value != "ok" {
+			t.Errorf("%s: expected 'ok', got %v", name, value)
+		}
+		if next != uint(len(buffer)+len(pointer)) {
+			t.Errorf("%s: pointer did not advance past itself", name)
+		}
+	}
+}
+
+func TestMMDBDecoder_Types(t *testing.T) {
+	testCases := map[string]struct {
+		encoded  []byte
+		expected any
+	}{
+		"uint16":      {[]byte{byte(mmdbUint16<<5 | 2), 0x01, 0x02}, uint64(0x0102)},
+		"int32":       {[]byte{0x04, 0x01, 0xFF, 0xFF, 0xFF, 0xFE}, int64(-2)},
+		"true":        {[]byte{0x01, 0x07}, true},
+		"long string": {append([]byte{byte(mmdbString<<5 | 29), 1}, []byte("abcdefghijklmnopqrstuvwxyz1234")...), "abcdefghijklmnopqrstuvwxyz1234"},
+	}
+
+	for name, tc := range testCases {
+		value, _, err := (&mmdbDecoder{buffer: tc.encoded}).decode(0, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if value != tc.expected {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, value)
+		}
+	}
+
+	if _, _, err := (&mmdbDecoder{buffer: []byte{byte(mmdbString<<5 | 5), 'a'}}).decode(0, 0); err == nil {
+		t.Error("expected error for truncated string")
+	}
+}
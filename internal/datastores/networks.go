@@ -0,0 +1,363 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"sort"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+// NetworkFinder is implemented by datastores that can tell which dataset
+// record answers for an address and list the records within a network
+type NetworkFinder interface {
+	FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error)
+	// ListNetworks returns up to limit records answering for addresses in
+	// network, ordered by first address; truncated reports that there
+	// were more
+	ListNetworks(ctx context.Context, network netip.Prefix, limit int) (records []models.NetworkRecord, truncated bool, err error)
+}
+
+// networkIndex is what network queries need of an index, loaded or
+// compiled
+type networkIndex interface {
+	lookup(addr netip.Addr) (ipRange, bool)
+	rangeCount() int
+	rangeAt(i int) ipRange
+	location(id uint32) *models.Location
+}
+
+func (idx *rangeIndex) rangeCount() int {
+	return len(idx.ranges)
+}
+
+func (idx *rangeIndex) rangeAt(i int) ipRange {
+	return idx.ranges[i]
+}
+
+func (idx *rangeIndex) location(id uint32) *models.Location {
+	return idx.locations.location(id)
+}
+
+func (idx *compiledIndex) rangeCount() int {
+	return int(idx.header.rangeCount)
+}
+
+// findNetwork returns the record of the range containing ip
+func findNetwork(idx networkIndex, ip, source string) (*models.NetworkRecord, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+	match, exists := idx.lookup(addr)
+	if !exists {
+		return nil, errors.ErrIPNotFound
+	}
+
+	record := networkRecord(idx, match, source)
+	record.Location.IP = addr.String()
+	return &record, nil
+}
+
+// listNetworks collects the records of the ranges overlapping network. A
+// record split into several ranges by networks nested inside it is listed
+// once; one entirely covered by nested networks answers for no address
+// and isn't listed.
+func listNetworks(idx networkIndex, network netip.Prefix, limit int, source string) ([]models.NetworkRecord, bool) {
+	first, last := network.Masked().Addr(), utils.LastAddr(network)
+	count := idx.rangeCount()
+	i := sort.Search(count, func(i int) bool {
+		return !idx.rangeAt(i).end.Less(first)
+	})
+
+	var records []models.NetworkRecord
+	seen := make(map[netip.Prefix]bool)
+	for ; i < count; i++ {
+		r := idx.rangeAt(i)
+		if last.Less(r.start) {
+			break
+		}
+		if prefix := r.network(); prefix.IsValid() {
+			if seen[prefix] {
+				continue
+			}
+			seen[prefix] = true
+		}
+		if len(records) == limit {
+			return sortNetworkRecords(records), true
+		}
+		records = append(records, networkRecord(idx, r, source))
+	}
+	return sortNetworkRecords(records), false
+}
+
+// networkRecord describes the dataset record range r was derived from
+func networkRecord(idx networkIndex, r ipRange, source string) models.NetworkRecord {
+	record := models.NetworkRecord{
+		Start:    r.start.String(),
+		End:      r.end.String(),
+		Source:   source,
+		Location: idx.location(r.location),
+	}
+	if prefix := r.network(); prefix.IsValid() {
+		record.Network = prefix.String()
+		record.Start, record.End = prefix.Addr().String(), utils.LastAddr(prefix).String()
+	}
+	return record
+}
+
+// sortNetworkRecords orders records by first address, enclosing networks
+// before the networks nested inside them
+func sortNetworkRecords(records []models.NetworkRecord) []models.NetworkRecord {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, _ := netip.ParseAddr(records[i].Start)
+		b, _ := netip.ParseAddr(records[j].Start)
+		if c := a.Compare(b); c != 0 {
+			return c < 0
+		}
+		endA, _ := netip.ParseAddr(records[i].End)
+		endB, _ := netip.ParseAddr(records[j].End)
+		return endB.Less(endA)
+	})
+	return records
+}
+
+// datasetName names a file-backed dataset in network records
+func datasetName(filePath string) string {
+	return filepath.Base(filePath)
+}
+
+func (c *CSVDataStore) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	index, _ := c.snapshot()
+	return findNetwork(index, ip, datasetName(c.filePath))
+}
+
+func (c *CSVDataStore) ListNetworks(ctx context.Context, network netip.Prefix, limit int) ([]models.NetworkRecord, bool, error) {
+	index, _ := c.snapshot()
+	records, truncated := listNetworks(index, network, limit, datasetName(c.filePath))
+	return records, truncated, nil
+}
+
+func (j *JSONDataStore) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	index, _ := j.snapshot()
+	return findNetwork(index, ip, datasetName(j.filePath))
+}
+
+func (j *JSONDataStore) ListNetworks(ctx context.Context, network netip.Prefix, limit int) ([]models.NetworkRecord, bool, error) {
+	index, _ := j.snapshot()
+	records, truncated := listNetworks(index, network, limit, datasetName(j.filePath))
+	return records, truncated, nil
+}
+
+func (r *RangeDataStore) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	index, _ := r.snapshot()
+	return findNetwork(index, ip, datasetName(r.filePath))
+}
+
+func (r *RangeDataStore) ListNetworks(ctx context.Context, network netip.Prefix, limit int) ([]models.NetworkRecord, bool, error) {
+	index, _ := r.snapshot()
+	records, truncated := listNetworks(index, network, limit, datasetName(r.filePath))
+	return records, truncated, nil
+}
+
+// FindNetwork searches the mapped index, which stays mapped while the read
+// lock is held
+func (c *CompiledDataStore) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.index == nil {
+		if _, ok := utils.ParseAddr(ip); !ok {
+			return nil, errors.ErrInvalidIP
+		}
+		return nil, errors.ErrIPNotFound
+	}
+	return findNetwork(c.index, ip, datasetName(c.filePath))
+}
+
+func (c *CompiledDataStore) ListNetworks(ctx context.Context, network netip.Prefix, limit int) ([]models.NetworkRecord, bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.index == nil {
+		return nil, false, nil
+	}
+	records, truncated := listNetworks(c.index, network, limit, datasetName(c.filePath))
+	return records, truncated, nil
+}
+
+// FindNetwork reports the search tree network the address was found in
+func (m *MMDBDataStore) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+
+	m.mutex.RLock()
+	reader := m.reader
+	m.mutex.RUnlock()
+
+	if reader == nil {
+		return nil, errors.ErrIPNotFound
+	}
+	value, bits, found, err := reader.lookup(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MMDB record: %w", err)
+	}
+	if !found {
+		return nil, errors.ErrIPNotFound
+	}
+	location := mmdbLocation(value)
+	if location.Country == "" && location.City == "" {
+		return nil, errors.ErrIPNotFound
+	}
+	location.IP = addr.String()
+
+	prefix, _ := addr.Prefix(bits)
+	return &models.NetworkRecord{
+		Network:  prefix.String(),
+		Start:    prefix.Addr().String(),
+		End:      utils.LastAddr(prefix).String(),
+		Source:   datasetName(m.filePath),
+		Location: location,
+	}, nil
+}
+
+// ListNetworks flattens the search tree on first use; the flattened copy
+// is kept until the next reload
+func (m *MMDBDataStore) ListNetworks(ctx context.Context, network netip.Prefix, limit int) ([]models.NetworkRecord, bool, error) {
+	m.mutex.RLock()
+	reader := m.reader
+	m.mutex.RUnlock()
+
+	if reader == nil {
+		return nil, false, nil
+	}
+	index, err := reader.flattened()
+	if err != nil {
+		return nil, false, err
+	}
+	records, truncated := listNetworks(index, network, limit, datasetName(m.filePath))
+	return records, truncated, nil
+}
+
+// FindNetwork asks the layers in order, like FindLocation. A layer that
+// can't describe its networks still answers with its location.
+func (c *CompositeDataStore) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	for _, layer := range c.layers {
+		var record *models.NetworkRecord
+		var err error
+		if finder, ok := layer.Store.(NetworkFinder); ok {
+			record, err = finder.FindNetwork(ctx, ip)
+		} else {
+			var location *models.Location
+			location, err = layer.Store.FindLocation(ctx, ip)
+			record = &models.NetworkRecord{Location: location}
+		}
+		if stderrors.Is(err, errors.ErrIPNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		record.Source = layer.Name
+		record.Location.Source = layer.Name
+		return record, nil
+	}
+	return nil, errors.ErrIPNotFound
+}
+
+// ListNetworks lists the records of every layer that can list them. A
+// record whose addresses within network are all answered by higher layers
+// is overridden and isn't listed; one a higher layer only partly covers
+// still answers for the rest and is. Layers that can't list their
+// networks can't be seen to override anything.
+func (c *CompositeDataStore) ListNetworks(ctx context.Context, network netip.Prefix, limit int) ([]models.NetworkRecord, bool, error) {
+	var records []models.NetworkRecord
+	truncated, supported := false, false
+	var above []NetworkFinder
+	for _, layer := range c.layers {
+		finder, ok := layer.Store.(NetworkFinder)
+		if !ok {
+			continue
+		}
+		supported = true
+		layerRecords, layerTruncated, err := finder.ListNetworks(ctx, network, limit)
+		if err != nil {
+			return nil, false, fmt.Errorf("layer %s: %w", layer.Name, err)
+		}
+		for _, record := range layerRecords {
+			overridden, err := overridden(ctx, above, record, network)
+			if err != nil {
+				return nil, false, err
+			}
+			if overridden {
+				continue
+			}
+			record.Source = layer.Name
+			record.Location.Source = layer.Name
+			records = append(records, record)
+		}
+		truncated = truncated || layerTruncated
+		above = append(above, finder)
+	}
+	if !supported {
+		return nil, false, errors.ErrNetworksUnsupported
+	}
+
+	records = sortNetworkRecords(records)
+	if len(records) > limit {
+		records, truncated = records[:limit], true
+	}
+	return records, truncated, nil
+}
+
+// overridden reports whether the layers above answer for every address
+// of record within network. It walks the record from its first address,
+// skipping to the end of each higher record found, so it costs one lookup
+// per higher record covering it.
+func overridden(ctx context.Context, above []NetworkFinder, record models.NetworkRecord, network netip.Prefix) (bool, error) {
+	if len(above) == 0 {
+		return false, nil
+	}
+	addr, _ := netip.ParseAddr(record.Start)
+	end, _ := netip.ParseAddr(record.End)
+	if first := network.Masked().Addr(); addr.Less(first) {
+		addr = first
+	}
+	if last := utils.LastAddr(network); last.Less(end) {
+		end = last
+	}
+
+	for {
+		covered := false
+		for _, finder := range above {
+			higher, err := finder.FindNetwork(ctx, addr.String())
+			if stderrors.Is(err, errors.ErrIPNotFound) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			higherEnd, err := netip.ParseAddr(higher.End)
+			if err != nil {
+				// A nested layer that can't describe its networks
+				return false, nil
+			}
+			if !higherEnd.Less(end) {
+				return true, nil
+			}
+			addr = higherEnd.Next()
+			covered = true
+			break
+		}
+		if !covered {
+			return false, nil
+		}
+	}
+}
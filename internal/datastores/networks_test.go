@@ -0,0 +1,231 @@
+package datastores
+
+import (
+	"context"
+	stderrors "errors"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+const testNestedNetworks = "8.8.0.0/16,Anywhere,United States\n" +
+	"8.8.8.0/24,Mountain View,United States\n" +
+	"8.8.4.0/24,Frankfurt,Germany\n" +
+	"9.9.9.9,Zurich,Switzerland\n" +
+	"2001:db8::/32,Berlin,Germany\n"
+
+// networkSummary reduces records to "network start-end city" strings
+func networkSummary(records []models.NetworkRecord) []string {
+	summary := make([]string, len(records))
+	for i, record := range records {
+		summary[i] = record.Network + " " + record.Start + "-" + record.End + " " + record.Location.City
+	}
+	return summary
+}
+
+func expectNetworks(t *testing.T, records []models.NetworkRecord, expected ...string) {
+	t.Helper()
+	summary := networkSummary(records)
+	if len(summary) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %q", len(expected), len(summary), summary)
+	}
+	for i := range expected {
+		if summary[i] != expected[i] {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], summary[i])
+		}
+	}
+}
+
+func TestNetworkFinder_FindNetwork(t *testing.T) {
+	source := setupTestDatastore(t, testNestedNetworks)
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	finders := map[string]NetworkFinder{
+		"csv":      source,
+		"compiled": compileTestIndex(t, source),
+	}
+
+	for name, finder := range finders {
+		testCases := map[string]string{
+			"8.8.8.8":        "8.8.8.0/24 8.8.8.0-8.8.8.255 Mountain View",
+			"::ffff:8.8.5.1": "8.8.0.0/16 8.8.0.0-8.8.255.255 Anywhere",
+			"9.9.9.9":        "9.9.9.9/32 9.9.9.9-9.9.9.9 Zurich",
+			"2001:db8::1":    "2001:db8::/32 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff Berlin",
+		}
+		for ip, expected := range testCases {
+			record, err := finder.FindNetwork(context.Background(), ip)
+			if err != nil {
+				t.Fatalf("%s: unexpected error for %s: %v", name, ip, err)
+			}
+			if summary := networkSummary([]models.NetworkRecord{*record}); summary[0] != expected {
+				t.Errorf("%s: expected %q for %s, got %q", name, expected, ip, summary[0])
+			}
+			if record.Source != filepath.Base(source.filePath) && name == "csv" {
+				t.Errorf("%s: expected the data file as source, got %q", name, record.Source)
+			}
+		}
+
+		if _, err := finder.FindNetwork(context.Background(), "1.1.1.1"); !stderrors.Is(err, appErrors.ErrIPNotFound) {
+			t.Errorf("%s: expected ErrIPNotFound, got %v", name, err)
+		}
+		if _, err := finder.FindNetwork(context.Background(), "bogus"); !stderrors.Is(err, appErrors.ErrInvalidIP) {
+			t.Errorf("%s: expected ErrInvalidIP, got %v", name, err)
+		}
+	}
+}
+
+func TestNetworkFinder_ListNetworks(t *testing.T) {
+	source := setupTestDatastore(t, testNestedNetworks)
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	finders := map[string]NetworkFinder{
+		"csv":      source,
+		"compiled": compileTestIndex(t, source),
+	}
+
+	for name, finder := range finders {
+		list := func(cidr string, limit int) ([]models.NetworkRecord, bool) {
+			t.Helper()
+			records, truncated, err := finder.ListNetworks(context.Background(), netip.MustParsePrefix(cidr), limit)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			return records, truncated
+		}
+
+		// The /16 is split in three by its nested networks but listed once
+		records, truncated := list("8.0.0.0/7", 10)
+		expectNetworks(t, records,
+			"8.8.0.0/16 8.8.0.0-8.8.255.255 Anywhere",
+			"8.8.4.0/24 8.8.4.0-8.8.4.255 Frankfurt",
+			"8.8.8.0/24 8.8.8.0-8.8.8.255 Mountain View",
+			"9.9.9.9/32 9.9.9.9-9.9.9.9 Zurich",
+		)
+		if truncated {
+			t.Errorf("%s: expected a complete list", name)
+		}
+
+		// The /16 answers for no address inside a nested network
+		records, _ = list("8.8.8.128/25", 10)
+		expectNetworks(t, records, "8.8.8.0/24 8.8.8.0-8.8.8.255 Mountain View")
+
+		records, truncated = list("8.8.0.0/16", 2)
+		if len(records) != 2 || !truncated {
+			t.Errorf("%s: expected 2 records and truncation, got %d, %v", name, len(records), truncated)
+		}
+
+		if records, _ := list("10.0.0.0/8", 10); len(records) != 0 {
+			t.Errorf("%s: expected no records, got %q", name, networkSummary(records))
+		}
+		records, _ = list("::/0", 10)
+		expectNetworks(t, records, "2001:db8::/32 2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff Berlin")
+	}
+}
+
+func TestRangeDataStore_Networks(t *testing.T) {
+	ds := setupTestRangeDatastore(t, "1.0.0.0,1.0.0.255,Australia,Research\n8.8.8.0,8.8.8.200,United States,Mountain View\n")
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	// Arbitrary ranges have no network
+	record, err := ds.FindNetwork(context.Background(), "8.8.8.8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Network != "" || record.Start != "8.8.8.0" || record.End != "8.8.8.200" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+
+	records, _, err := ds.ListNetworks(context.Background(), netip.MustParsePrefix("0.0.0.0/0"), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectNetworks(t, records, " 1.0.0.0-1.0.0.255 Research", " 8.8.8.0-8.8.8.200 Mountain View")
+}
+
+func TestMMDBDataStore_Networks(t *testing.T) {
+	ds := setupTestMMDBDatastore(t, 6, 28, testMMDBNetworks())
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load MMDB: %v", err)
+	}
+
+	record, err := ds.FindNetwork(context.Background(), "77.88.8.8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Network != "77.88.0.0/16" || record.Location.Country != "Russia" || record.Source != "test.mmdb" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+
+	records, _, err := ds.ListNetworks(context.Background(), netip.MustParsePrefix("8.0.0.0/8"), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectNetworks(t, records, "8.8.8.0/24 8.8.8.0-8.8.8.255 Mountain View")
+}
+
+func TestCompositeDataStore_Networks(t *testing.T) {
+	overrides := setupTestDatastore(t, "8.8.8.8,Office,Germany\n")
+	vendor := setupTestDatastore(t, testNestedNetworks)
+	remote := &stubDataStore{location: &models.Location{Country: "Canada"}}
+	composite := NewCompositeDataStore(
+		Layer{Name: "overrides", Store: overrides},
+		Layer{Name: "vendor", Store: vendor},
+		Layer{Name: "remote", Store: remote},
+	)
+	if err := composite.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	testCases := map[string]string{
+		"8.8.8.8": "overrides 8.8.8.8/32",
+		"8.8.8.9": "vendor 8.8.8.0/24",
+		// Layers that can't describe their networks still answer
+		"1.1.1.1": "remote ",
+	}
+	for ip, expected := range testCases {
+		record, err := composite.FindNetwork(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", ip, err)
+		}
+		if got := record.Source + " " + record.Network; got != expected || record.Location.Source != record.Source {
+			t.Errorf("expected %q for %s, got %q (%+v)", expected, ip, got, record.Location)
+		}
+	}
+
+	records, truncated, err := composite.ListNetworks(context.Background(), netip.MustParsePrefix("8.8.8.0/24"), 10)
+	if err != nil || truncated {
+		t.Fatalf("unexpected result: %v, %v", truncated, err)
+	}
+	if len(records) != 2 || records[0].Source != "vendor" || records[1].Source != "overrides" {
+		t.Errorf("expected the vendor network before the override nested in it, got %+v", records)
+	}
+
+	// Overrides splitting 8.8.4.0/24 between them leave the vendor's record
+	// answering for nothing, so it isn't listed
+	overrides = setupTestDatastore(t, "8.8.8.8,Office,Germany\n8.8.4.0/25,Office,Germany\n8.8.4.128/25,Lab,Germany\n")
+	composite = NewCompositeDataStore(Layer{Name: "overrides", Store: overrides}, Layer{Name: "vendor", Store: vendor})
+	if err := composite.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	records, _, err = composite.ListNetworks(context.Background(), netip.MustParsePrefix("8.8.0.0/16"), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectNetworks(t, records,
+		"8.8.0.0/16 8.8.0.0-8.8.255.255 Anywhere",
+		"8.8.4.0/25 8.8.4.0-8.8.4.127 Office",
+		"8.8.4.128/25 8.8.4.128-8.8.4.255 Lab",
+		"8.8.8.0/24 8.8.8.0-8.8.8.255 Mountain View",
+		"8.8.8.8/32 8.8.8.8-8.8.8.8 Office")
+
+	if _, _, err := NewCompositeDataStore(Layer{Name: "remote", Store: remote}).ListNetworks(context.Background(), netip.MustParsePrefix("8.8.8.0/24"), 10); !stderrors.Is(err, appErrors.ErrNetworksUnsupported) {
+		t.Errorf("expected ErrNetworksUnsupported without a listable layer, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package datastores
+
+// LoadMode controls how loaders react to malformed rows
+type LoadMode string
+
+const (
+	// LoadModeStrict aborts the load on the first malformed row
+	LoadModeStrict LoadMode = "strict"
+	// LoadModeLenient skips malformed rows and records them in the load report
+	LoadModeLenient LoadMode = "lenient"
+)
+
+// DuplicatePolicy controls which record wins when the same network appears
+// more than once with different countries. Nested networks always resolve
+// to the most specific one, except that DuplicateError also rejects a
+// nested network whose country differs from the enclosing one.
+type DuplicatePolicy string
+
+const (
+	// DuplicateError fails the load (or skips the row in lenient mode) on
+	// repeated or nested networks with different countries
+	DuplicateError DuplicatePolicy = "error"
+	// DuplicateFirstWins keeps the earliest record in the file
+	DuplicateFirstWins DuplicatePolicy = "first-wins"
+	// DuplicateLastWins keeps the latest record in the file
+	DuplicateLastWins DuplicatePolicy = "last-wins"
+)
+
+// loadOptions holds settings shared by the file-backed datastores
+type loadOptions struct {
+	mode        LoadMode
+	duplicates  DuplicatePolicy
+	csvFormat   CSVFormat
+	rangeFormat RangeFormat
+}
+
+func defaultLoadOptions() loadOptions {
+	return loadOptions{
+		mode:        LoadModeStrict,
+		duplicates:  DuplicateLastWins,
+		rangeFormat: RangeFormatDefault,
+	}
+}
+
+// Option configures a file-backed datastore
+type Option func(*loadOptions)
+
+// WithLoadMode selects strict or lenient handling of malformed rows
+func WithLoadMode(mode LoadMode) Option {
+	return func(o *loadOptions) {
+		o.mode = mode
+	}
+}
+
+// WithDuplicatePolicy selects how repeated, conflicting records are resolved
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(o *loadOptions) {
+		o.duplicates = policy
+	}
+}
+
+// WithCSVFormat sets the header, delimiter, comment and column layout of
+// CSV data files
+func WithCSVFormat(format CSVFormat) Option {
+	return func(o *loadOptions) {
+		o.csvFormat = format
+	}
+}
+
+// WithRangeFormat sets the column layout of start/end range files
+func WithRangeFormat(format RangeFormat) Option {
+	return func(o *loadOptions) {
+		o.rangeFormat = format
+	}
+}
+
+func applyOptions(opts []Option) loadOptions {
+	options := defaultLoadOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
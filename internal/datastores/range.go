@@ -0,0 +1,263 @@
+package datastores
+
+import (
+	"context"
+	"encoding/csv"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+// RangeDataStore serves start/end IP interval datasets such as IP2Location
+// and DB-IP exports. By default each row is start_ip,end_ip,country with
+// an optional fourth city column; WithRangeFormat selects the vendors'
+// own layouts. Bounds may be written as addresses or as decimal integers.
+// Ranges must not overlap.
+type RangeDataStore struct {
+	filePath string
+	index    *rangeIndex
+	mutex    sync.RWMutex
+	options  loadOptions
+	loadTracker
+}
+
+func NewRangeDataStore(filePath string, opts ...Option) *RangeDataStore {
+	return &RangeDataStore{
+		filePath: filePath,
+		index:    newPrefixIndex(nil, newLocationTable()),
+		options:  applyOptions(opts),
+	}
+}
+
+// lineRange remembers where a range came from for overlap errors
+type lineRange struct {
+	ipRange
+	line int
+}
+
+// Load reads the range rows in the configured vendor layout into a new
+// index, rejecting overlapping ranges.
+func (r *RangeDataStore) Load(ctx context.Context) error {
+	return loadIndex(r.filePath, r.options.mode, &r.loadTracker, func(report *reportBuilder) (*rangeIndex, error) {
+		return r.buildIndex(ctx, report)
+	}, func(index *rangeIndex) {
+		r.mutex.Lock()
+		r.index = index
+		r.mutex.Unlock()
+	})
+}
+
+// buildIndex parses the whole file into a fresh index without touching
+// the published one
+func (r *RangeDataStore) buildIndex(ctx context.Context, report *reportBuilder) (*rangeIndex, error) {
+	file, err := openDataFile(r.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open range file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// Field counts are checked per row so lenient mode can skip bad rows
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	locations := newLocationTable()
+	var ranges []lineRange
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if stderrors.As(err, &parseErr) {
+			report.read()
+			if err := report.reject(parseErr.Line, skipInvalidFormat, fmt.Errorf("failed to read range file: %w", err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read range file: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		report.read()
+
+		row, err := parseRangeRow(r.options.rangeFormat, record)
+		if err != nil {
+			if err := report.reject(line, skipInvalidFormat, fmt.Errorf("invalid range format at line %d: %w", line, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if row.unassigned {
+			report.skip(skipUnassigned)
+			continue
+		}
+
+		start, err := parseRangeBound(record[0])
+		if err != nil {
+			if err := report.reject(line, skipInvalidIP, fmt.Errorf("invalid start IP at line %d: %s", line, record[0])); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		end, err := parseRangeBound(record[1])
+		if err != nil {
+			if err := report.reject(line, skipInvalidIP, fmt.Errorf("invalid end IP at line %d: %s", line, record[1])); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if start.Is4() != end.Is4() {
+			if err := report.reject(line, skipInvalidRange, fmt.Errorf("mixed address families at line %d: %s-%s", line, start, end)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if spansMappedBlock(start, end) {
+			if err := report.reject(line, skipInvalidRange, fmt.Errorf("range spans the IPv4-mapped block at line %d: %s-%s", line, start, end)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if end.Less(start) {
+			if err := report.reject(line, skipInvalidRange, fmt.Errorf("start IP after end IP at line %d: %s-%s", line, start, end)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		ranges = append(ranges, lineRange{
+			ipRange: ipRange{start: start, end: end, location: locations.intern(row.country, row.city, row.extra), bits: noNetwork},
+			line:    line,
+		})
+	}
+
+	return newIntervalIndex(ranges, locations, r.options.duplicates, report)
+}
+
+func (r *RangeDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+
+	r.mutex.RLock()
+	index := r.index
+	r.mutex.RUnlock()
+
+	return index.find(addr)
+}
+
+func (r *RangeDataStore) Close() error {
+	return nil
+}
+
+// newIntervalIndex sorts explicit ranges and rejects any overlap. Ranges
+// repeated with identical bounds are resolved by policy; any other overlap
+// is invalid data and is skipped in lenient mode.
+func newIntervalIndex(ranges []lineRange, locations *locationTable, policy DuplicatePolicy, report *reportBuilder) (*rangeIndex, error) {
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+
+	idx := &rangeIndex{ranges: make([]ipRange, 0, len(ranges)), locations: locations}
+	var prev *lineRange
+	for i := range ranges {
+		r := &ranges[i]
+		if prev != nil && prev.start == r.start && prev.end == r.end {
+			if err := resolveRepeatedRange(idx, prev, r, policy, report); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if prev != nil && !prev.end.Less(r.start) {
+			err := fmt.Errorf("overlapping ranges at lines %d and %d: %s-%s overlaps %s-%s",
+				prev.line, r.line, prev.start, prev.end, r.start, r.end)
+			if err := report.reject(r.line, skipOverlap, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		idx.ranges = append(idx.ranges, r.ipRange)
+		prev = r
+	}
+	idx.records = len(idx.ranges)
+
+	locations.freeze()
+	return idx, nil
+}
+
+// resolveRepeatedRange handles r repeating the bounds of prev, the range
+// most recently added to idx
+func resolveRepeatedRange(idx *rangeIndex, prev, r *lineRange, policy DuplicatePolicy, report *reportBuilder) error {
+	first, country := idx.locations.country(prev.location), idx.locations.country(r.location)
+	if first == country {
+		report.report.Duplicates++
+	} else {
+		report.report.Conflicts++
+		if policy == DuplicateError {
+			err := fmt.Errorf("conflicting ranges at lines %d and %d: %s-%s is %s vs %s",
+				prev.line, r.line, r.start, r.end, first, country)
+			return report.reject(r.line, skipConflict, err)
+		}
+	}
+
+	if policy == DuplicateLastWins {
+		idx.ranges[len(idx.ranges)-1] = r.ipRange
+	}
+	return nil
+}
+
+// parseRangeBound accepts a textual IP or a decimal integer. Integers that
+// fit in 32 bits are IPv4; wider ones are IPv6, with IPv4-mapped values
+// (IP2Location's IPv6 files encode IPv4 as ::ffff:a.b.c.d) unwrapped to
+// the IPv4 address they map, the same as textual bounds.
+func parseRangeBound(value string) (netip.Addr, error) {
+	trimmed := strings.TrimSpace(value)
+	if addr, ok := utils.ParseAddr(trimmed); ok {
+		return addr, nil
+	}
+
+	n, ok := new(big.Int).SetString(trimmed, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return netip.Addr{}, fmt.Errorf("invalid range bound %q", value)
+	}
+
+	if n.BitLen() <= 32 {
+		var b [4]byte
+		n.FillBytes(b[:])
+		return netip.AddrFrom4(b), nil
+	}
+
+	var b [16]byte
+	n.FillBytes(b[:])
+	return netip.AddrFrom16(b).Unmap(), nil
+}
+
+// spansMappedBlock reports whether an IPv6 range encloses ::ffff:0:0/96.
+// Lookups unwrap those addresses to IPv4, so the range can't be stored
+// as a single IPv6 interval without silently dropping that part of it.
+func spansMappedBlock(start, end netip.Addr) bool {
+	return start.Is6() && end.Is6() && start.Less(mappedBlockStart) && mappedBlockEnd.Less(end)
+}
+
+var (
+	mappedBlockStart = netip.MustParseAddr("::ffff:0.0.0.0")
+	mappedBlockEnd   = netip.MustParseAddr("::ffff:255.255.255.255")
+)
@@ -0,0 +1,83 @@
+package datastores
+
+import "fmt"
+
+// RangeFormat selects the column layout of start/end range files
+type RangeFormat string
+
+const (
+	// RangeFormatDefault is start,end,country with an optional city
+	RangeFormatDefault RangeFormat = "default"
+	// RangeFormatIP2Location is from,to,country_code,country_name (DB1),
+	// followed by region,city and more columns in DB3 and up
+	RangeFormatIP2Location RangeFormat = "ip2location"
+	// RangeFormatDBIP is start,end,country_code (country lite) or
+	// start,end,continent,country_code,stateprov,city,... (city lite)
+	RangeFormatDBIP RangeFormat = "dbip"
+)
+
+// rangeRow is the location a range row maps to
+type rangeRow struct {
+	country string
+	city    string
+	extra   map[string]string
+	// unassigned marks the vendor's placeholder rows for address space
+	// without a country, which are left out of the index
+	unassigned bool
+}
+
+// parseRangeRow reads the location columns of record, which starts with
+// the two bounds, according to format
+func parseRangeRow(format RangeFormat, record []string) (rangeRow, error) {
+	switch format {
+	case RangeFormatIP2Location:
+		if len(record) != 4 && len(record) < 6 {
+			return rangeRow{}, fmt.Errorf("expected 4 fields, or 6 or more, got %d", len(record))
+		}
+		// IP2Location writes "-" for unknown values
+		row := rangeRow{
+			country:    vendorValue(record[3], "-"),
+			extra:      map[string]string{"country_code": vendorValue(record[2], "-")},
+			unassigned: record[2] == "-",
+		}
+		if len(record) >= 6 {
+			row.extra["region"] = vendorValue(record[4], "-")
+			row.city = vendorValue(record[5], "-")
+		}
+		return row, nil
+
+	case RangeFormatDBIP:
+		// DB-IP writes ZZ for unassigned space
+		switch {
+		case len(record) == 3:
+			return rangeRow{country: record[2], unassigned: record[2] == "ZZ"}, nil
+		case len(record) >= 6:
+			return rangeRow{
+				country:    record[3],
+				city:       record[5],
+				extra:      map[string]string{"continent": record[2], "region": record[4]},
+				unassigned: record[3] == "ZZ",
+			}, nil
+		}
+		return rangeRow{}, fmt.Errorf("expected 3 fields, or 6 or more, got %d", len(record))
+
+	default:
+		if len(record) != 3 && len(record) != 4 {
+			return rangeRow{}, fmt.Errorf("expected 3 or 4 fields, got %d", len(record))
+		}
+		row := rangeRow{country: record[2]}
+		if len(record) == 4 {
+			row.city = record[3]
+		}
+		return row, nil
+	}
+}
+
+// vendorValue returns value, or "" when it is the vendor's placeholder
+// for an unknown value
+func vendorValue(value, unknown string) string {
+	if value == unknown {
+		return ""
+	}
+	return value
+}
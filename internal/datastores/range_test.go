@@ -0,0 +1,339 @@
+package datastores
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	appErrors "ip_country_project/internal/errors"
+)
+
+// Helper function to create test range file and datastore
+func setupTestRangeDatastore(t *testing.T, data string) *RangeDataStore {
+	t.Helper()
+
+	tmpFile, err := os.CreateTemp("", "test_*.csv")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+
+	_, _ = tmpFile.WriteString(data)
+	_ = tmpFile.Close()
+
+	ds := NewRangeDataStore(tmpFile.Name())
+
+	t.Cleanup(func() {
+		_ = os.Remove(tmpFile.Name())
+	})
+
+	return ds
+}
+
+func TestRangeDataStore_FindLocation_Success(t *testing.T) {
+	testData := "1.0.0.0,1.0.0.255,Australia,Research\n" +
+		"8.8.8.0,8.8.8.200,United States,Mountain View\n" +
+		"2001:db8::,2001:db8::ffff,Nowhere\n"
+	ds := setupTestRangeDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	testCases := map[string]string{
+		"1.0.0.0":       "Australia",
+		"1.0.0.128":     "Australia",
+		"1.0.0.255":     "Australia",
+		"8.8.8.8":       "United States",
+		"8.8.8.200":     "United States",
+		"2001:db8::abc": "Nowhere",
+	}
+
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.Country != expected {
+			t.Errorf("expected country '%s' for %s, got '%s'", expected, ip, location.Country)
+		}
+	}
+
+	location, _ := ds.FindLocation(context.Background(), "1.0.0.1")
+	if location.City != "Research" {
+		t.Errorf("expected city 'Research', got '%s'", location.City)
+	}
+}
+
+func TestRangeDataStore_FindLocation_IPv6(t *testing.T) {
+	testData := "::ffff:1.0.0.0,::ffff:1.0.0.255,Australia\n" +
+		"2001:DB8::,2001:DB8::FFFF,Nowhere\n" +
+		"2001:db8:1::,2001:db8:1:ffff:ffff:ffff:ffff:ffff,Somewhere\n"
+	ds := setupTestRangeDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	testCases := map[string]string{
+		"1.0.0.1":           "Australia",
+		"::ffff:1.0.0.255":  "Australia",
+		"2001:db8::abcd":    "Nowhere",
+		"2001:DB8:1:2:3::4": "Somewhere",
+	}
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.Country != expected {
+			t.Errorf("expected country '%s' for %s, got '%s'", expected, ip, location.Country)
+		}
+	}
+
+	if _, err := ds.FindLocation(context.Background(), "2001:db8::1:0"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound between ranges, got %v", err)
+	}
+}
+
+func TestRangeDataStore_FindLocation_NotFound(t *testing.T) {
+	testData := "1.0.0.0,1.0.0.255,Australia\n8.8.8.0,8.8.8.200,United States\n"
+	ds := setupTestRangeDatastore(t, testData)
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	for _, ip := range []string{"0.255.255.255", "1.0.1.0", "8.8.8.201", "2001:db8::1"} {
+		_, err := ds.FindLocation(context.Background(), ip)
+		if !errors.Is(err, appErrors.ErrIPNotFound) {
+			t.Errorf("expected ErrIPNotFound for %s, got %v", ip, err)
+		}
+	}
+}
+
+func TestRangeDataStore_FindLocation_InvalidIP(t *testing.T) {
+	ds := setupTestRangeDatastore(t, "1.0.0.0,1.0.0.255,Australia\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	_, err := ds.FindLocation(context.Background(), "invalid-ip")
+	if !errors.Is(err, appErrors.ErrInvalidIP) {
+		t.Errorf("expected ErrInvalidIP, got %v", err)
+	}
+}
+
+func TestRangeDataStore_Load_DecimalBounds(t *testing.T) {
+	// 16777216 = 1.0.0.0, 16777471 = 1.0.0.255
+	ds := setupTestRangeDatastore(t, `"16777216","16777471","AU","Brisbane"`+"\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.0.0.42")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "AU" {
+		t.Errorf("expected country 'AU', got '%s'", location.Country)
+	}
+}
+
+func TestRangeDataStore_Load_DecimalMappedBounds(t *testing.T) {
+	// IP2Location's IPv6 files encode 1.0.0.0-1.0.0.255 as ::ffff:1.0.0.0-::ffff:1.0.0.255
+	ds := setupTestRangeDatastore(t, `"281470698520576","281470698520831","AU","Brisbane"`+"\n")
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	for _, ip := range []string{"1.0.0.42", "::ffff:1.0.0.42"} {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("expected successful lookup for %s, got error: %v", ip, err)
+		}
+		if location.Country != "AU" {
+			t.Errorf("expected country 'AU' for %s, got '%s'", ip, location.Country)
+		}
+	}
+}
+
+func TestRangeDataStore_Load_Overlap(t *testing.T) {
+	testData := "1.0.0.0,1.0.0.255,Australia\n2.0.0.0,2.0.0.255,France\n1.0.0.128,1.0.1.0,Japan\n"
+	ds := setupTestRangeDatastore(t, testData)
+
+	err := ds.Load(context.Background())
+	if err == nil {
+		t.Fatal("expected error loading overlapping ranges")
+	}
+	if !strings.Contains(err.Error(), "lines 1 and 3") {
+		t.Errorf("expected error to name lines 1 and 3, got: %v", err)
+	}
+}
+
+func TestRangeDataStore_Load_InvalidRows(t *testing.T) {
+	testCases := map[string]string{
+		"start after end": "1.0.0.255,1.0.0.0,Australia\n",
+		"mixed families":  "1.0.0.0,2001:db8::,Australia\n",
+		"bad start":       "invalid,1.0.0.0,Australia\n",
+		"too few fields":  "1.0.0.0,1.0.0.255\n",
+
+		// ::fffe:ffff:ffff to ::ffff:1.0.0.255
+		"crosses mapped block": "281470681743359,281470698520831,Australia\n",
+		"spans mapped block":   "::1,::1:0:0:0,Australia\n",
+	}
+
+	for name, testData := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ds := setupTestRangeDatastore(t, testData)
+			if err := ds.Load(context.Background()); err == nil {
+				t.Errorf("expected error for %s", name)
+			}
+		})
+	}
+}
+
+func TestRangeDataStore_Load_InvalidRowLine(t *testing.T) {
+	// The quoted city spans two lines, so the bad row is on line 3
+	testData := "1.0.0.0,1.0.0.255,Australia,\"South\nBrisbane\"\n2.0.0.0,invalid,France\n"
+	ds := setupTestRangeDatastore(t, testData)
+
+	err := ds.Load(context.Background())
+	if err == nil {
+		t.Fatal("expected error for the invalid row")
+	}
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected error to name line 3, got: %v", err)
+	}
+}
+
+func TestRangeDataStore_Load_LenientSkipsOverlap(t *testing.T) {
+	testData := "1.0.0.0,1.0.0.255,Australia\n1.0.0.128,1.0.1.0,Japan\n2.0.0.0,2.0.0.255,France\n"
+	tmpFile := setupTestRangeDatastore(t, testData).filePath
+	ds := NewRangeDataStore(tmpFile, WithLoadMode(LoadModeLenient))
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("expected lenient load to succeed, got: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.0.0.200")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Australia" {
+		t.Errorf("expected first range to be kept, got '%s'", location.Country)
+	}
+
+	report := ds.LoadStatus().Report
+	if report.Accepted != 2 || report.Skipped["overlap"] != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestRangeDataStore_Load_RepeatedRanges(t *testing.T) {
+	testData := "1.0.0.0,1.0.0.255,Australia\n1.0.0.0,1.0.0.255,Australia\n1.0.0.0,1.0.0.255,Japan\n"
+
+	ds := setupTestRangeDatastore(t, testData)
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("expected default last-wins policy to accept repeats, got: %v", err)
+	}
+	location, _ := ds.FindLocation(context.Background(), "1.0.0.1")
+	if location.Country != "Japan" {
+		t.Errorf("expected last row to win, got '%s'", location.Country)
+	}
+	report := ds.LoadStatus().Report
+	if report.Duplicates != 1 || report.Conflicts != 1 {
+		t.Errorf("expected 1 duplicate and 1 conflict, got %+v", report)
+	}
+
+	strict := NewRangeDataStore(ds.filePath, WithDuplicatePolicy(DuplicateError))
+	err := strict.Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "lines 1 and 3") {
+		t.Errorf("expected conflict error naming lines 1 and 3, got: %v", err)
+	}
+}
+
+func TestRangeDataStore_Load_IP2Location(t *testing.T) {
+	ds := NewRangeDataStore("../../testdata/sample_ip2location_db1.csv", WithRangeFormat(RangeFormatIP2Location))
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.0.1.1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "China" || location.City != "" || location.Extra["country_code"] != "CN" {
+		t.Errorf("expected China (CN) without a city, got %+v", location)
+	}
+
+	// The placeholder row for unassigned space is left out
+	if _, err := ds.FindLocation(context.Background(), "0.1.2.3"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound for unassigned space, got %v", err)
+	}
+	report := ds.LoadStatus().Report
+	if report.Accepted != 4 || report.Skipped[skipUnassigned] != 1 {
+		t.Errorf("expected 4 accepted rows and 1 unassigned, got %+v", report)
+	}
+
+	// DB3 and up add region and city
+	ds = setupTestRangeDatastore(t, `"16777216","16777471","AU","Australia","Queensland","Brisbane"`+"\n"+
+		`"16777472","16777727","AU","Australia","-","-"`+"\n")
+	ds.options = applyOptions([]Option{WithRangeFormat(RangeFormatIP2Location)})
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+	location, err = ds.FindLocation(context.Background(), "1.0.0.1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "Australia" || location.City != "Brisbane" || location.Extra["region"] != "Queensland" {
+		t.Errorf("expected Brisbane, Queensland, Australia, got %+v", location)
+	}
+	if location, _ := ds.FindLocation(context.Background(), "1.0.1.1"); location == nil || location.City != "" || location.Extra["region"] != "" {
+		t.Errorf("expected unknown region and city to be empty, got %+v", location)
+	}
+}
+
+func TestRangeDataStore_Load_DBIP(t *testing.T) {
+	testData := "1.0.0.0,1.0.0.255,OC,AU,Queensland,South Brisbane,-27.4748,153.017\n" +
+		"1.0.1.0,1.0.3.255,AS,CN,Fujian,Fuzhou,26.0614,119.306\n" +
+		"1.0.4.0,1.0.7.255,ZZ,ZZ,,,0,0\n"
+	ds := setupTestRangeDatastore(t, testData)
+	ds.options = applyOptions([]Option{WithRangeFormat(RangeFormatDBIP)})
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+
+	location, err := ds.FindLocation(context.Background(), "1.0.2.1")
+	if err != nil {
+		t.Fatalf("expected successful lookup, got error: %v", err)
+	}
+	if location.Country != "CN" || location.City != "Fuzhou" || location.Extra["region"] != "Fujian" || location.Extra["continent"] != "AS" {
+		t.Errorf("expected Fuzhou, Fujian, CN, got %+v", location)
+	}
+	if _, err := ds.FindLocation(context.Background(), "1.0.5.1"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound for unassigned space, got %v", err)
+	}
+
+	// The country lite file has the code alone
+	ds = setupTestRangeDatastore(t, "1.0.0.0,1.0.0.255,AU\n")
+	ds.options = applyOptions([]Option{WithRangeFormat(RangeFormatDBIP)})
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load ranges: %v", err)
+	}
+	if location, err := ds.FindLocation(context.Background(), "1.0.0.1"); err != nil || location.Country != "AU" {
+		t.Errorf("expected AU, got %+v, %v", location, err)
+	}
+
+	// Other field counts are malformed
+	ds = setupTestRangeDatastore(t, "1.0.0.0,1.0.0.255,OC,AU\n")
+	ds.options = applyOptions([]Option{WithRangeFormat(RangeFormatDBIP)})
+	if err := ds.Load(context.Background()); err == nil {
+		t.Error("expected an error for a 4-field DB-IP row")
+	}
+}
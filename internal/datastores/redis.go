@@ -0,0 +1,363 @@
+package datastores
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/redis"
+	"ip_country_project/internal/utils"
+)
+
+// Keys of the Redis datastore, relative to its prefix:
+//
+//	ip:<addr>        hash of country, city and extra fields for a single
+//	                 address, maintained by hand; checked before ranges
+//	current          generation of the imported dataset being served
+//	generation       counter new generations are allocated from
+//	<gen>:ranges:4   sorted sets of the imported IPv4 and IPv6 ranges,
+//	<gen>:ranges:6   all scored 0, with "<end>:<start>:<location JSON>"
+//	                 members and addresses as fixed-width hex
+//	<gen>:records    number of dataset entries the ranges came from
+//
+// Ranges are disjoint and members begin with their last address, so the
+// first member at or after an address in lexicographic order is the only
+// range that can contain it: one ZRANGEBYLEX per lookup.
+const (
+	DefaultRedisPrefix = "ipcountry:"
+
+	// redisImportBatch is how many ranges each ZADD carries, and
+	// redisPipelineDepth how many commands are sent per round trip
+	redisImportBatch   = 500
+	redisPipelineDepth = 16
+
+	// redisGracePeriod keeps a replaced generation readable for lookups
+	// that started before the switch
+	redisGracePeriod = time.Minute
+)
+
+// RedisDataStore looks addresses up in Redis, in exact-address hashes
+// first and then in the ranges written by ImportRedis. Every lookup is a
+// single pipelined round trip; a newly imported generation is picked up
+// by the first lookup that sees it.
+type RedisDataStore struct {
+	client *redis.Client
+	prefix string
+
+	mutex      sync.RWMutex
+	generation string // "" until a dataset has been imported
+	loadTracker
+}
+
+// NewRedisDataStore serves the keys under prefix. The datastore owns
+// client and closes it on Close.
+func NewRedisDataStore(client *redis.Client, prefix string) *RedisDataStore {
+	return &RedisDataStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Load checks that Redis is reachable and records which generation is
+// current. A Redis without an imported dataset still serves exact-address
+// keys.
+func (r *RedisDataStore) Load(ctx context.Context) error {
+	entries, generation, err := r.currentStatus(ctx)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errors.ErrUpstream, err)
+		r.recordFailure(err, nil)
+		return err
+	}
+
+	r.setGeneration(generation)
+	r.recordSuccess(entries, nil)
+	return nil
+}
+
+func (r *RedisDataStore) currentStatus(ctx context.Context) (int, string, error) {
+	reply, err := r.client.Do(ctx, "GET", r.prefix+"current")
+	if err != nil {
+		return 0, "", err
+	}
+	generation, _ := reply.(string)
+	if generation == "" {
+		return 0, "", nil
+	}
+
+	reply, err = r.client.Do(ctx, "GET", redisGenerationKeys(r.prefix, generation)[2])
+	if err != nil {
+		return 0, "", err
+	}
+	records, _ := reply.(string)
+	entries, _ := strconv.Atoi(records)
+	return entries, generation, nil
+}
+
+func (r *RedisDataStore) FindLocation(ctx context.Context, ip string) (*models.Location, error) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+
+	// Optimistically query the ranges of the generation seen last
+	generation := r.currentGeneration()
+	commands := [][]string{
+		{"HGETALL", r.prefix + "ip:" + addr.String()},
+		{"GET", r.prefix + "current"},
+	}
+	if generation != "" {
+		commands = append(commands, r.rangeQuery(generation, addr))
+	}
+	replies, err := pipeline(ctx, r.client, commands...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrUpstream, err)
+	}
+
+	location := hashLocation(replies[0])
+	if location == nil {
+		current, _ := replies[1].(string)
+		var member any
+		switch {
+		case current == "":
+		case current == generation:
+			member = replies[2]
+		default:
+			// A new dataset was imported since the last lookup
+			r.setGeneration(current)
+			member, err = r.client.Do(ctx, r.rangeQuery(current, addr)...)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errors.ErrUpstream, err)
+			}
+		}
+		if location, err = rangeLocation(member, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	location.IP = addr.String()
+	return location, nil
+}
+
+// rangeQuery finds the first range ending at or after addr
+func (r *RedisDataStore) rangeQuery(generation string, addr netip.Addr) []string {
+	family, key := addrKey(addr)
+	return []string{"ZRANGEBYLEX", redisRangesKey(r.prefix, generation, family), "[" + key, "+", "LIMIT", "0", "1"}
+}
+
+func redisRangesKey(prefix, generation string, family int) string {
+	return prefix + generation + ":ranges:" + strconv.Itoa(family)
+}
+
+// redisGenerationKeys lists the IPv4 ranges, IPv6 ranges and records keys
+// of a generation
+func redisGenerationKeys(prefix, generation string) []string {
+	return []string{redisRangesKey(prefix, generation, 4), redisRangesKey(prefix, generation, 6), prefix + generation + ":records"}
+}
+
+func (r *RedisDataStore) currentGeneration() string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.generation
+}
+
+func (r *RedisDataStore) setGeneration(generation string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.generation = generation
+}
+
+// Close releases every pooled Redis connection
+func (r *RedisDataStore) Close() error {
+	return r.client.Close()
+}
+
+// ImportRedis writes the data loaded in source to Redis as a new
+// generation under prefix, switches lookups over to it and returns the
+// number of dataset entries imported. The replaced generation expires
+// after a grace period; a failed import deletes what it wrote and leaves
+// the current generation serving.
+func ImportRedis(ctx context.Context, client *redis.Client, prefix string, source DataStore) (int, error) {
+	s, ok := source.(indexSource)
+	if !ok {
+		return 0, fmt.Errorf("datastore %T cannot be imported", source)
+	}
+	idx, err := s.snapshot()
+	if err != nil {
+		return 0, err
+	}
+	if idx.records == 0 {
+		return 0, errors.ErrEmptyDataset
+	}
+
+	reply, err := client.Do(ctx, "INCR", prefix+"generation")
+	if err != nil {
+		return 0, err
+	}
+	generation := strconv.FormatInt(reply.(int64), 10)
+	keys := redisGenerationKeys(prefix, generation)
+
+	if err := writeRanges(ctx, client, keys[0], keys[1], idx); err != nil {
+		// Best effort: the generation was never made current
+		_, _ = client.Do(context.WithoutCancel(ctx), append([]string{"DEL"}, keys...)...)
+		return 0, err
+	}
+
+	replies, err := pipeline(ctx, client,
+		[]string{"SET", keys[2], strconv.Itoa(idx.records)},
+		[]string{"GET", prefix + "current"},
+		[]string{"SET", prefix + "current", generation},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if previous, _ := replies[1].(string); previous != "" {
+		seconds := strconv.Itoa(int(redisGracePeriod.Seconds()))
+		var expires [][]string
+		for _, key := range redisGenerationKeys(prefix, previous) {
+			expires = append(expires, []string{"EXPIRE", key, seconds})
+		}
+		if _, err := pipeline(ctx, client, expires...); err != nil {
+			return 0, fmt.Errorf("imported generation %s but failed to expire generation %s: %w", generation, previous, err)
+		}
+	}
+	return idx.records, nil
+}
+
+// writeRanges adds the ranges of idx to the IPv4 and IPv6 sorted sets in
+// pipelined ZADD batches
+func writeRanges(ctx context.Context, client *redis.Client, key4, key6 string, idx *rangeIndex) error {
+	keys := map[int]string{4: key4, 6: key6}
+	var pending [][]string
+	flush := func() error {
+		_, err := pipeline(ctx, client, pending...)
+		pending = pending[:0]
+		return err
+	}
+
+	// Most locations cover many ranges; encode each once
+	encoded := make(map[uint32]string)
+	batches := make(map[int][]string)
+	for _, r := range idx.ranges {
+		family, start := addrKey(r.start)
+		_, end := addrKey(r.end)
+
+		location, ok := encoded[r.location]
+		if !ok {
+			data, err := json.Marshal(idx.locations.location(r.location))
+			if err != nil {
+				return err
+			}
+			location = string(data)
+			encoded[r.location] = location
+		}
+
+		if batches[family] == nil {
+			batches[family] = []string{"ZADD", keys[family]}
+		}
+		batches[family] = append(batches[family], "0", end+":"+start+":"+location)
+		if len(batches[family]) < 2+2*redisImportBatch {
+			continue
+		}
+		pending = append(pending, batches[family])
+		batches[family] = nil
+		if len(pending) == redisPipelineDepth {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, family := range []int{4, 6} {
+		if batches[family] != nil {
+			pending = append(pending, batches[family])
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return flush()
+}
+
+// pipeline runs commands and turns the first error reply into an error
+func pipeline(ctx context.Context, client *redis.Client, commands ...[]string) ([]any, error) {
+	replies, err := client.Pipeline(ctx, commands...)
+	if err != nil {
+		return nil, err
+	}
+	for i, reply := range replies {
+		if replyErr, ok := reply.(redis.Error); ok {
+			return nil, fmt.Errorf("%s: %w", commands[i][0], replyErr)
+		}
+	}
+	return replies, nil
+}
+
+// addrKey encodes addr as fixed-width hex, which sorts like the address
+func addrKey(addr netip.Addr) (int, string) {
+	if addr.Is4() {
+		bytes := addr.As4()
+		return 4, hex.EncodeToString(bytes[:])
+	}
+	bytes := addr.As16()
+	return 6, hex.EncodeToString(bytes[:])
+}
+
+// hashLocation reads an exact-address hash; nil means there is none
+func hashLocation(reply any) *models.Location {
+	fields, _ := reply.([]any)
+	location := &models.Location{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		field, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+		switch field {
+		case fieldCountry:
+			location.Country = value
+		case fieldCity:
+			location.City = value
+		default:
+			if location.Extra == nil {
+				location.Extra = make(map[string]string)
+			}
+			location.Extra[field] = value
+		}
+	}
+	if location.Country == "" {
+		return nil
+	}
+	return location
+}
+
+// rangeLocation decodes a ZRANGEBYLEX reply, checking that the range
+// found actually starts at or before addr
+func rangeLocation(reply any, addr netip.Addr) (*models.Location, error) {
+	members, _ := reply.([]any)
+	if len(members) == 0 {
+		return nil, errors.ErrIPNotFound
+	}
+	member, _ := members[0].(string)
+
+	_, key := addrKey(addr)
+	end, rest, _ := strings.Cut(member, ":")
+	start, data, ok := strings.Cut(rest, ":")
+	if !ok || len(start) != len(key) || len(end) != len(key) {
+		return nil, fmt.Errorf("%w: malformed range %q", errors.ErrUpstream, member)
+	}
+	if start > key {
+		return nil, errors.ErrIPNotFound
+	}
+
+	location := &models.Location{}
+	if err := json.Unmarshal([]byte(data), location); err != nil {
+		return nil, fmt.Errorf("%w: malformed range %q: %v", errors.ErrUpstream, member, err)
+	}
+	return location, nil
+}
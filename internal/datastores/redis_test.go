@@ -0,0 +1,257 @@
+package datastores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/redis"
+	"ip_country_project/internal/redis/redistest"
+)
+
+const testRedisPrefix = "test:"
+
+func newTestRedisClient(t *testing.T, server *redistest.Server) *redis.Client {
+	t.Helper()
+
+	opts, err := redis.ParseURL(server.URL())
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	client := redis.NewClient(opts)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// importTestCSV loads CSV data and imports it into server
+func importTestCSV(t *testing.T, server *redistest.Server, data string) *CSVDataStore {
+	t.Helper()
+
+	source := setupTestDatastore(t, data)
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	if _, err := ImportRedis(context.Background(), newTestRedisClient(t, server), testRedisPrefix, source); err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	return source
+}
+
+func setupTestRedisDatastore(t *testing.T, server *redistest.Server) *RedisDataStore {
+	t.Helper()
+
+	ds := NewRedisDataStore(newTestRedisClient(t, server), testRedisPrefix)
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	return ds
+}
+
+func TestRedisDataStore_MatchesSource(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	source := setupTestDatastore(t, "8.8.8.0/24,Mountain View,United States\n"+
+		"8.8.8.8,Anycast,United States\n"+
+		"1.1.1.0/24,Sydney,Australia\n"+
+		"2001:db8::/32,,Nowhere\n"+
+		"2001:db8:1::/48,Berlin,Germany\n")
+	if err := source.Load(context.Background()); err != nil {
+		t.Fatalf("failed to load CSV: %v", err)
+	}
+	entries, err := ImportRedis(context.Background(), newTestRedisClient(t, server), testRedisPrefix, source)
+	if err != nil || entries != 5 {
+		t.Fatalf("expected 5 entries imported, got %d, %v", entries, err)
+	}
+
+	ds := setupTestRedisDatastore(t, server)
+	for _, ip := range []string{"8.8.8.0", "8.8.8.7", "8.8.8.8", "8.8.8.9", "8.8.8.255", "8.8.9.0", "1.1.1.1", "0.0.0.0",
+		"255.255.255.255", "2001:db8::1", "2001:db8:1::1", "2001:db8:2::", "2001:db9::1", "::ffff:1.1.1.1"} {
+		expected, expectedErr := source.FindLocation(context.Background(), ip)
+		got, err := ds.FindLocation(context.Background(), ip)
+
+		if !errors.Is(err, expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", ip, expectedErr, err)
+			continue
+		}
+		if expectedErr != nil {
+			continue
+		}
+		if got.IP != expected.IP || got.Country != expected.Country || got.City != expected.City {
+			t.Errorf("%s: expected %+v, got %+v", ip, expected, got)
+		}
+	}
+
+	if entries := ds.LoadStatus().Entries; entries != 5 {
+		t.Errorf("expected 5 entries, got %d", entries)
+	}
+}
+
+func TestRedisDataStore_ExactAddressKeys(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	importTestCSV(t, server, "8.8.8.0/24,Mountain View,United States\n")
+
+	client := newTestRedisClient(t, server)
+	_, err := client.Pipeline(context.Background(),
+		[]string{"HSET", testRedisPrefix + "ip:8.8.8.8", "country", "Canada", "city", "Toronto", "office", "HQ"},
+		[]string{"HSET", testRedisPrefix + "ip:2001:db8::1", "country", "Germany"},
+	)
+	if err != nil {
+		t.Fatalf("failed to write exact keys: %v", err)
+	}
+
+	ds := setupTestRedisDatastore(t, server)
+	testCases := map[string]string{
+		"8.8.8.8":        "Canada",
+		"::ffff:8.8.8.8": "Canada",
+		"8.8.8.9":        "United States",
+		"2001:DB8:0::1":  "Germany",
+	}
+	for ip, expected := range testCases {
+		location, err := ds.FindLocation(context.Background(), ip)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", ip, err)
+		}
+		if location.Country != expected {
+			t.Errorf("%s: expected %s, got %s", ip, expected, location.Country)
+		}
+	}
+
+	location, _ := ds.FindLocation(context.Background(), "8.8.8.8")
+	if location.City != "Toronto" || location.Extra["office"] != "HQ" {
+		t.Errorf("expected hash fields to be returned, got %+v", location)
+	}
+}
+
+func TestRedisDataStore_WithoutImport(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	ds := setupTestRedisDatastore(t, server)
+
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound, got %v", err)
+	}
+	if _, err := ds.FindLocation(context.Background(), "not-an-ip"); !errors.Is(err, appErrors.ErrInvalidIP) {
+		t.Errorf("expected ErrInvalidIP, got %v", err)
+	}
+
+	// A dataset imported after Load is picked up without reloading
+	importTestCSV(t, server, "8.8.8.8,Mountain View,United States\n")
+	location, err := ds.FindLocation(context.Background(), "8.8.8.8")
+	if err != nil || location.Country != "United States" {
+		t.Errorf("expected the imported dataset to serve, got %+v, %v", location, err)
+	}
+}
+
+func TestRedisDataStore_Reimport(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	importTestCSV(t, server, "8.8.8.8,Mountain View,United States\n")
+	ds := setupTestRedisDatastore(t, server)
+
+	if location, err := ds.FindLocation(context.Background(), "8.8.8.8"); err != nil || location.City != "Mountain View" {
+		t.Fatalf("unexpected lookup result: %+v, %v", location, err)
+	}
+
+	importTestCSV(t, server, "8.8.8.8,Anycast,United States\n1.1.1.1,Sydney,Australia\n")
+	if location, err := ds.FindLocation(context.Background(), "8.8.8.8"); err != nil || location.City != "Anycast" {
+		t.Errorf("expected the new generation to serve, got %+v, %v", location, err)
+	}
+
+	// The fake server expires keys immediately, so only the new
+	// generation's keys remain
+	for _, key := range server.Keys() {
+		if strings.HasPrefix(key, testRedisPrefix+"1:") {
+			t.Errorf("expected generation 1 to expire, found %s", key)
+		}
+	}
+	expected := []string{"test:2:ranges:4", "test:2:records", "test:current", "test:generation"}
+	if keys := server.Keys(); !slices.Equal(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	if err := ds.Load(context.Background()); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if entries := ds.LoadStatus().Entries; entries != 2 {
+		t.Errorf("expected 2 entries, got %d", entries)
+	}
+}
+
+func TestImportRedis_Batches(t *testing.T) {
+	server := redistest.NewServer(t, "")
+
+	var data strings.Builder
+	for i := range 2000 {
+		fmt.Fprintf(&data, "10.%d.%d.0/24,City %d,Country %d\n", i/256, i%256, i%7, i%3)
+	}
+	importTestCSV(t, server, data.String())
+
+	ds := setupTestRedisDatastore(t, server)
+	commands := server.Commands()
+	location, err := ds.FindLocation(context.Background(), "10.7.207.42")
+	if err != nil || location.City != "City 4" || location.Country != "Country 1" {
+		t.Errorf("unexpected lookup result: %+v, %v", location, err)
+	}
+	if served := server.Commands() - commands; served != 3 {
+		t.Errorf("expected one pipelined round trip of 3 commands, got %d commands", served)
+	}
+
+	reply, err := newTestRedisClient(t, server).Do(context.Background(), "ZCARD", testRedisPrefix+"1:ranges:4")
+	if err != nil || reply != int64(2000) {
+		t.Errorf("expected 2000 ranges, got %v, %v", reply, err)
+	}
+}
+
+func TestImportRedis_Rejects(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	client := newTestRedisClient(t, server)
+
+	empty := setupTestDatastore(t, "")
+	if _, err := ImportRedis(context.Background(), client, testRedisPrefix, empty); !errors.Is(err, appErrors.ErrEmptyDataset) {
+		t.Errorf("expected ErrEmptyDataset, got %v", err)
+	}
+	if _, err := ImportRedis(context.Background(), client, testRedisPrefix, NewHTTPDataStore(HTTPConfig{})); err == nil {
+		t.Error("expected an error importing from an HTTP datastore")
+	}
+}
+
+func TestRedisDataStore_Unavailable(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	importTestCSV(t, server, "8.8.8.8,Mountain View,United States\n")
+	ds := setupTestRedisDatastore(t, server)
+
+	server.Close()
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrUpstream) {
+		t.Errorf("expected ErrUpstream, got %v", err)
+	}
+	if err := ds.Load(context.Background()); !errors.Is(err, appErrors.ErrUpstream) {
+		t.Errorf("expected ErrUpstream, got %v", err)
+	}
+	if status := ds.LoadStatus(); status.LastError == "" || status.Entries != 1 {
+		t.Errorf("expected a failed load to keep the entry count, got %+v", status)
+	}
+}
+
+func TestRedisDataStore_Close(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	ds := setupTestRedisDatastore(t, server)
+
+	if _, err := ds.FindLocation(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Fatalf("expected ErrIPNotFound, got %v", err)
+	}
+	if server.OpenConnections() != 1 {
+		t.Fatalf("expected one pooled connection, got %d", server.OpenConnections())
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	for range 100 {
+		if server.OpenConnections() == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("expected Close to release the connection, %d still open", server.OpenConnections())
+}
@@ -0,0 +1,83 @@
+package datastores
+
+import (
+	"log"
+
+	"ip_country_project/internal/models"
+)
+
+// maxOffendingRows caps how many bad row numbers a load report keeps
+const maxOffendingRows = 10
+
+// Skip reasons recorded in load reports
+const (
+	skipInvalidFormat = "invalid_format"
+	skipInvalidIP     = "invalid_ip"
+	skipInvalidRange  = "invalid_range"
+	skipOverlap       = "overlap"
+	skipConflict      = "conflict"
+	skipUnassigned    = "unassigned"
+)
+
+// reportBuilder collects row outcomes while a file is parsed and decides,
+// based on the load mode, whether a bad row aborts the load
+type reportBuilder struct {
+	mode   LoadMode
+	report models.LoadReport
+}
+
+func newReportBuilder(mode LoadMode) *reportBuilder {
+	return &reportBuilder{
+		mode:   mode,
+		report: models.LoadReport{Mode: string(mode)},
+	}
+}
+
+// read counts a row taken from the source
+func (b *reportBuilder) read() {
+	b.report.RowsRead++
+}
+
+// reject records a bad row. In strict mode it returns err so the caller
+// aborts; in lenient mode it returns nil and the caller skips the row.
+func (b *reportBuilder) reject(row int, reason string, err error) error {
+	if b.report.Skipped == nil {
+		b.report.Skipped = make(map[string]int)
+	}
+	b.report.Skipped[reason]++
+	if len(b.report.OffendingRows) < maxOffendingRows {
+		b.report.OffendingRows = append(b.report.OffendingRows, row)
+	}
+
+	if b.mode == LoadModeLenient {
+		return nil
+	}
+	return err
+}
+
+// skip records a row deliberately left out, such as a vendor's
+// placeholder for unassigned space. It never aborts the load.
+func (b *reportBuilder) skip(reason string) {
+	if b.report.Skipped == nil {
+		b.report.Skipped = make(map[string]int)
+	}
+	b.report.Skipped[reason]++
+}
+
+// finish fills in the accepted count from the built index
+func (b *reportBuilder) finish(index *rangeIndex) *models.LoadReport {
+	b.report.Accepted = index.records
+	return &b.report
+}
+
+func logReport(source string, report *models.LoadReport) {
+	skipped := 0
+	for _, n := range report.Skipped {
+		skipped += n
+	}
+	log.Printf("Loaded %s (%s): %d rows read, %d accepted, %d skipped, %d duplicates, %d conflicts, %d overlap conflicts",
+		source, report.Mode, report.RowsRead, report.Accepted, skipped, report.Duplicates, report.Conflicts, report.OverlapConflicts)
+	if skipped > 0 {
+		log.Printf("Skipped rows by reason: %v (first offending rows: %v)", report.Skipped, report.OffendingRows)
+	}
+}
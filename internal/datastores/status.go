@@ -0,0 +1,48 @@
+package datastores
+
+import (
+	"sync"
+	"time"
+
+	"ip_country_project/internal/models"
+)
+
+// StatusReporter is implemented by datastores that track load outcomes
+type StatusReporter interface {
+	LoadStatus() models.LoadStatus
+}
+
+// loadTracker records load outcomes; embed it to implement StatusReporter
+type loadTracker struct {
+	statusMutex sync.RWMutex
+	status      models.LoadStatus
+}
+
+func (t *loadTracker) recordSuccess(entries int, report *models.LoadReport) {
+	t.statusMutex.Lock()
+	defer t.statusMutex.Unlock()
+
+	now := time.Now()
+	t.status.Entries = entries
+	t.status.LastAttempt = now
+	t.status.LastSuccess = now
+	t.status.LastError = ""
+	t.status.Report = report
+}
+
+// recordFailure keeps the entry count of the data still being served
+func (t *loadTracker) recordFailure(err error, report *models.LoadReport) {
+	t.statusMutex.Lock()
+	defer t.statusMutex.Unlock()
+
+	t.status.LastAttempt = time.Now()
+	t.status.LastError = err.Error()
+	t.status.Report = report
+}
+
+func (t *loadTracker) LoadStatus() models.LoadStatus {
+	t.statusMutex.RLock()
+	defer t.statusMutex.RUnlock()
+
+	return t.status
+}
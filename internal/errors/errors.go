@@ -7,6 +7,18 @@ var (
 	ErrIPNotFound               = errors.New("IP address not found")
 	ErrInvalidIP                = errors.New("invalid IP address format")
 	ErrUnsupportedDatastoreType = errors.New("unsupported datastore type")
+	ErrEmptyDataset             = errors.New("dataset contains no entries")
+	ErrUpstream                 = errors.New("upstream datastore request failed")
+	ErrCircuitOpen              = errors.New("datastore temporarily unavailable")
+	ErrNetworksUnsupported      = errors.New("datastore does not support network queries")
+	ErrCountryNotFound          = errors.New("country not found")
+	ErrCityNotFound             = errors.New("city not found in country")
+	ErrPartialLoad              = errors.New("some datastore layers failed to load")
+)
+
+// ErrNonPublicIP Lookup errors
+var (
+	ErrNonPublicIP = errors.New("IP address is not publicly routable")
 )
 
 // ErrRateLimited Rate limiter errors
@@ -19,9 +31,23 @@ var (
 	ErrMissingIPParam   = errors.New("missing ip parameter")
 	ErrMethodNotAllowed = errors.New("method not allowed")
 	ErrInternalServer   = errors.New("internal server error")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrInvalidBatch     = errors.New("request body must be a JSON array of IP addresses")
+	ErrBatchTooLarge    = errors.New("batch exceeds the maximum size")
+	ErrUnknownClient    = errors.New("could not determine the client address")
+	ErrInvalidNetwork   = errors.New("invalid network, expected CIDR notation")
+	ErrMissingCIDRParam = errors.New("missing cidr parameter")
+	ErrInvalidCursor    = errors.New("invalid cursor, expected the next field of a previous page")
+)
+
+// ErrStreamTooLong Bulk stream errors
+var (
+	ErrStreamTooLong     = errors.New("stream exceeds the maximum")
+	ErrInvalidStreamLine = errors.New("line must be an IP address, a JSON string or a JSON object with an ip field")
 )
 
 // ErrAppInit Application errors
 var (
-	ErrAppInit = errors.New("failed to initialize application")
+	ErrAppInit      = errors.New("failed to initialize application")
+	ErrReloadFailed = errors.New("datastore reload failed")
 )
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/services"
+)
+
+type AdminHandler struct {
+	reloads *services.ReloadService
+	token   string
+}
+
+func NewAdminHandler(reloads *services.ReloadService, token string) *AdminHandler {
+	return &AdminHandler{
+		reloads: reloads,
+		token:   token,
+	}
+}
+
+func (h *AdminHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !bearerAuthorized(r, h.token) {
+		h.writeError(w, appErrors.ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// The cause names files and raw parse errors; the reload service logs
+	// it, and the caller only learns that the reload failed
+	if err := h.reloads.Reload(r.Context()); err != nil {
+		h.writeError(w, appErrors.ErrReloadFailed.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "reloaded"})
+}
+
+// bearerAuthorized checks the request's bearer token against token in
+// constant time
+func bearerAuthorized(r *http.Request, token string) bool {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+func (h *AdminHandler) writeError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/services"
+	"ip_country_project/internal/utils"
+)
+
+const (
+	DefaultBatchMaxSize = 100
+	// batchWorkers bounds the lookups of one batch running at once
+	batchWorkers = 8
+	// batchBytesPerIP bounds the request body; an IPv6 address with
+	// quoting and generous whitespace fits comfortably
+	batchBytesPerIP = 128
+)
+
+// BatchLimiter charges the lookups of a batch against the rate limit
+type BatchLimiter interface {
+	AllowN(n int) bool
+	// AllowMore charges n further tokens to a request admitted by AllowN(1)
+	AllowMore(n int) bool
+}
+
+type BatchHandler struct {
+	service *services.LocationService
+	limiter BatchLimiter
+	maxSize int
+}
+
+// NewBatchHandler creates a handler for batches of up to maxSize
+// addresses. The handler charges limiter for every lookup of a batch, so
+// the route must not also sit behind the rate limiting middleware.
+func NewBatchHandler(service *services.LocationService, limiter BatchLimiter, maxSize int) *BatchHandler {
+	if maxSize <= 0 {
+		maxSize = DefaultBatchMaxSize
+	}
+	return &BatchHandler{
+		service: service,
+		limiter: limiter,
+		maxSize: maxSize,
+	}
+}
+
+func (h *BatchHandler) FindCountries(w http.ResponseWriter, r *http.Request) {
+	// One token is charged before the body is read, so requests refused
+	// before their size is known still count against the limit
+	if !h.limiter.AllowN(1) {
+		h.writeError(w, appErrors.ErrRateLimited.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ips []string
+	body := http.MaxBytesReader(w, r.Body, int64(h.maxSize)*batchBytesPerIP+1024)
+	if err := json.NewDecoder(body).Decode(&ips); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.writeError(w, h.tooLarge(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.writeError(w, appErrors.ErrInvalidBatch.Error(), http.StatusBadRequest)
+		return
+	}
+	if ips == nil {
+		h.writeError(w, appErrors.ErrInvalidBatch.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(ips) > h.maxSize {
+		h.writeError(w, h.tooLarge(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// The rest of the batch is charged once its size is known; an empty
+	// batch costs just the one token
+	if len(ips) > 1 && !h.limiter.AllowMore(len(ips)-1) {
+		h.writeError(w, appErrors.ErrRateLimited.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	results := h.lookup(r, ips)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+// lookup answers every address, in order, with a few lookups in flight
+func (h *BatchHandler) lookup(r *http.Request, ips []string) []models.BatchResult {
+	results := make([]models.BatchResult, len(ips))
+	indexes := make(chan int, len(ips))
+	for i := range ips {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(ips)) {
+		wg.Add(1)
+		utils.Go(func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = lookupResult(r.Context(), h.service, ips[i])
+			}
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// lookupResult looks up one address of a batch or stream
+func lookupResult(ctx context.Context, service *services.LocationService, ip string) models.BatchResult {
+	location, err := service.FindCountry(ctx, ip)
+	if err != nil {
+		statusCode, response := errorResponse(err)
+		return models.BatchResult{IP: ip, Status: statusCode, ErrorResponse: &response}
+	}
+	return models.BatchResult{IP: ip, Status: http.StatusOK, Location: location}
+}
+
+func (h *BatchHandler) tooLarge() string {
+	return fmt.Sprintf("%s of %d addresses", appErrors.ErrBatchTooLarge.Error(), h.maxSize)
+}
+
+func (h *BatchHandler) writeError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ip_country_project/internal/datastores"
+	"ip_country_project/internal/models"
+)
+
+type HealthHandler struct {
+	datastore   datastores.DataStore
+	detailToken string
+}
+
+// HealthHandlerOption configures a HealthHandler
+type HealthHandlerOption func(*HealthHandler)
+
+// WithDetailToken shows load errors and reports to requests bearing token;
+// without it they are never shown
+func WithDetailToken(token string) HealthHandlerOption {
+	return func(h *HealthHandler) {
+		h.detailToken = token
+	}
+}
+
+func NewHealthHandler(datastore datastores.DataStore, opts ...HealthHandlerOption) *HealthHandler {
+	h := &HealthHandler{
+		datastore: datastore,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Health reports liveness plus the datastore's load status when available.
+// A failed reload doesn't make the service unhealthy because the previous
+// dataset keeps serving; the failure reason is logged, and shown to
+// requests bearing the detail token. Likewise a tripped circuit breaker
+// only reports the service as "degraded".
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	response := models.HealthResponse{Status: "ok"}
+	if reporter, ok := h.datastore.(datastores.StatusReporter); ok {
+		status := reporter.LoadStatus()
+		if h.detailToken == "" || !bearerAuthorized(r, h.detailToken) {
+			status = publicStatus(status)
+		}
+		response.Datastore = &status
+		if breakerTripped(status) {
+			response.Status = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// breakerTripped reports whether any circuit breaker, of the datastore or
+// one of its layers, isn't closed
+func breakerTripped(status models.LoadStatus) bool {
+	if status.Breaker != nil && status.Breaker.State != string(datastores.BreakerClosed) {
+		return true
+	}
+	for _, layer := range status.Layers {
+		if breakerTripped(layer.LoadStatus) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicStatus strips the load errors and reports, which name files and
+// echo raw data, from status and its layers
+func publicStatus(status models.LoadStatus) models.LoadStatus {
+	status.LastError, status.Report = "", nil
+	if status.Layers != nil {
+		layers := make([]models.LayerStatus, len(status.Layers))
+		for i, layer := range status.Layers {
+			layers[i] = models.LayerStatus{Name: layer.Name, LoadStatus: publicStatus(layer.LoadStatus)}
+		}
+		status.Layers = layers
+	}
+	return status
+}
@@ -6,18 +6,36 @@ import (
 	"net/http"
 
 	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/middleware"
 	"ip_country_project/internal/models"
 	"ip_country_project/internal/services"
 )
 
 type LocationHandler struct {
-	service *services.LocationService
+	service  *services.LocationService
+	clientIP *middleware.ClientIPResolver
 }
 
-func NewLocationHandler(service *services.LocationService) *LocationHandler {
-	return &LocationHandler{
-		service: service,
+// LocationHandlerOption configures a LocationHandler
+type LocationHandlerOption func(*LocationHandler)
+
+// WithClientIPResolver sets how the caller is found for lookups without
+// an address; by default it is the connection's address
+func WithClientIPResolver(resolver *middleware.ClientIPResolver) LocationHandlerOption {
+	return func(h *LocationHandler) {
+		h.clientIP = resolver
+	}
+}
+
+func NewLocationHandler(service *services.LocationService, opts ...LocationHandlerOption) *LocationHandler {
+	h := &LocationHandler{
+		service:  service,
+		clientIP: middleware.NewClientIPResolver(nil),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 func (h *LocationHandler) FindCountry(w http.ResponseWriter, r *http.Request) {
@@ -28,13 +46,40 @@ func (h *LocationHandler) FindCountry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get IP parameter from query string
-	ip := r.URL.Query().Get("ip")
+	// Get IP parameter from query string; without one, locate the caller
+	query := r.URL.Query()
+	if !query.Has("ip") {
+		h.FindCaller(w, r)
+		return
+	}
+	ip := query.Get("ip")
 	if ip == "" {
 		h.writeError(w, appErrors.ErrMissingIPParam.Error(), http.StatusBadRequest)
 		return
 	}
 
+	h.find(w, r, ip)
+}
+
+// FindCaller locates the address the request comes from
+func (h *LocationHandler) FindCaller(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	addr, err := h.clientIP.ClientIP(r)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.find(w, r, addr.String())
+}
+
+func (h *LocationHandler) find(w http.ResponseWriter, r *http.Request, ip string) {
 	// Call service with request context
 	location, err := h.service.FindCountry(r.Context(), ip)
 	if err != nil {
@@ -49,22 +94,65 @@ func (h *LocationHandler) FindCountry(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *LocationHandler) handleServiceError(w http.ResponseWriter, err error) {
+	statusCode, response := errorResponse(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errorResponse maps a lookup error to its status code and response
+func errorResponse(err error) (int, models.ErrorResponse) {
 	if errors.Is(err, appErrors.ErrInvalidIP) {
-		h.writeError(w, appErrors.ErrInvalidIP.Error(), http.StatusBadRequest)
-		return
+		return http.StatusBadRequest, models.ErrorResponse{Error: appErrors.ErrInvalidIP.Error()}
+	}
+
+	if errors.Is(err, appErrors.ErrInvalidNetwork) {
+		return http.StatusBadRequest, models.ErrorResponse{Error: appErrors.ErrInvalidNetwork.Error()}
 	}
-	
+
+	if errors.Is(err, appErrors.ErrInvalidCursor) {
+		return http.StatusBadRequest, models.ErrorResponse{Error: appErrors.ErrInvalidCursor.Error()}
+	}
+
+	var nonPublic *services.NonPublicAddressError
+	if errors.As(err, &nonPublic) {
+		return http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error:        appErrors.ErrNonPublicIP.Error(),
+			AddressClass: string(nonPublic.Class),
+			Network:      nonPublic.Network.String(),
+		}
+	}
+
 	if errors.Is(err, appErrors.ErrIPNotFound) {
-		h.writeError(w, appErrors.ErrIPNotFound.Error(), http.StatusNotFound)
-		return
+		return http.StatusNotFound, models.ErrorResponse{Error: appErrors.ErrIPNotFound.Error()}
+	}
+
+	if errors.Is(err, appErrors.ErrCountryNotFound) {
+		return http.StatusNotFound, models.ErrorResponse{Error: appErrors.ErrCountryNotFound.Error()}
+	}
+
+	if errors.Is(err, appErrors.ErrCityNotFound) {
+		return http.StatusNotFound, models.ErrorResponse{Error: appErrors.ErrCityNotFound.Error()}
+	}
+
+	if errors.Is(err, appErrors.ErrUpstream) {
+		return http.StatusBadGateway, models.ErrorResponse{Error: appErrors.ErrUpstream.Error()}
+	}
+
+	if errors.Is(err, appErrors.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable, models.ErrorResponse{Error: appErrors.ErrCircuitOpen.Error()}
+	}
+
+	if errors.Is(err, appErrors.ErrNetworksUnsupported) {
+		return http.StatusNotImplemented, models.ErrorResponse{Error: appErrors.ErrNetworksUnsupported.Error()}
 	}
 
 	// All other errors are internal server errors
-	h.writeError(w, appErrors.ErrInternalServer.Error(), http.StatusInternalServerError)
+	return http.StatusInternalServerError, models.ErrorResponse{Error: appErrors.ErrInternalServer.Error()}
 }
 
 func (h *LocationHandler) writeError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
-}
\ No newline at end of file
+}
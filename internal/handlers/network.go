@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/services"
+)
+
+const (
+	// DefaultNetworkLimit is how many records a network query lists
+	// unless asked for fewer or more
+	DefaultNetworkLimit = 1000
+	maxNetworkLimit     = 10000
+)
+
+type NetworkHandler struct {
+	service *services.LocationService
+}
+
+func NewNetworkHandler(service *services.LocationService) *NetworkHandler {
+	return &NetworkHandler{
+		service: service,
+	}
+}
+
+// FindNetwork answers which dataset record ?ip= matched
+func (h *NetworkHandler) FindNetwork(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		h.writeError(w, appErrors.ErrMissingIPParam.Error(), http.StatusBadRequest)
+		return
+	}
+
+	record, err := h.service.FindNetwork(r.Context(), ip)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+	h.writeJSON(w, record)
+}
+
+// ListNetworks lists the dataset records within ?cidr=, up to ?limit=
+func (h *NetworkHandler) ListNetworks(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	cidr := query.Get("cidr")
+	if cidr == "" {
+		h.writeError(w, appErrors.ErrMissingCIDRParam.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseLimit(query.Get("limit"))
+	if !ok {
+		h.writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxNetworkLimit), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.service.ListNetworks(r.Context(), cidr, limit)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+	h.writeJSON(w, list)
+}
+
+// CountryNetworks lists the networks of the country in the path, and
+// ?city=, a page of up to ?limit= at a time from ?cursor=
+func (h *NetworkHandler) CountryNetworks(w http.ResponseWriter, r *http.Request) {
+	// Only allow GET requests
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, ok := parseLimit(query.Get("limit"))
+	if !ok {
+		h.writeError(w, fmt.Sprintf("limit must be between 1 and %d", maxNetworkLimit), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.CountryNetworks(r.Context(), r.PathValue("country"), query.Get("city"), query.Get("cursor"), limit)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+	h.writeJSON(w, page)
+}
+
+// parseLimit reads an optional ?limit=, defaulting to DefaultNetworkLimit
+func parseLimit(value string) (int, bool) {
+	if value == "" {
+		return DefaultNetworkLimit, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxNetworkLimit {
+		return 0, false
+	}
+	return limit, true
+}
+
+func (h *NetworkHandler) handleServiceError(w http.ResponseWriter, err error) {
+	statusCode, response := errorResponse(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *NetworkHandler) writeJSON(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *NetworkHandler) writeError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/services"
+	"ip_country_project/internal/utils"
+)
+
+const (
+	DefaultStreamMaxLines = 1_000_000
+	// streamMaxLineBytes bounds one input line, and with it the memory a
+	// stream holds
+	streamMaxLineBytes = 64 * 1024
+	// streamWindow bounds the lookups of one stream running at once;
+	// results are still written in input order
+	streamWindow = 8
+	// streamIdleTimeout replaces the server's read and write timeouts,
+	// which would cut long streams short, with a deadline that moves
+	// forward as long as the client keeps up
+	streamIdleTimeout = 30 * time.Second
+)
+
+type StreamHandler struct {
+	service  *services.LocationService
+	limiter  StreamLimiter
+	maxLines int
+}
+
+// StreamLimiter is the rate limit a stream is paced by
+type StreamLimiter interface {
+	BatchLimiter
+	// Wait takes a token, blocking until one is free or ctx is done
+	Wait(ctx context.Context) error
+}
+
+// NewStreamHandler creates a handler for streams of up to maxLines
+// addresses. The handler charges limiter a token per line, so the route
+// must not also sit behind the rate limiting middleware.
+func NewStreamHandler(service *services.LocationService, limiter StreamLimiter, maxLines int) *StreamHandler {
+	if maxLines <= 0 {
+		maxLines = DefaultStreamMaxLines
+	}
+	return &StreamHandler{
+		service:  service,
+		limiter:  limiter,
+		maxLines: maxLines,
+	}
+}
+
+// FindCountries reads one address per line, either bare, as a JSON string
+// or as a JSON object with an "ip" field, and writes one models.BatchResult
+// line per input line, in order, as lookups complete. Lines past the rate
+// limit are read as tokens free up rather than refused. A stream cut short
+// by the line cap or an unreadable line ends with a result line without
+// an address describing why.
+func (h *StreamHandler) FindCountries(w http.ResponseWriter, r *http.Request) {
+	// The first line is charged before anything else, so a caller that is
+	// already over the limit gets a plain 429
+	if !h.limiter.AllowN(1) {
+		h.writeError(w, appErrors.ErrRateLimited.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	// Only allow POST requests
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.writeError(w, appErrors.ErrMethodNotAllowed.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	// Results are written while the body is still being read
+	_ = controller.EnableFullDuplex()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	pending := make(chan chan models.BatchResult, streamWindow)
+	readDone := make(chan struct{})
+	utils.Go(func() {
+		defer close(readDone)
+		defer close(pending)
+		h.read(ctx, controller, r.Body, pending)
+	})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	for result := range pending {
+		line, ok := <-result
+		if !ok {
+			// The lookup panicked
+			line = models.BatchResult{Status: http.StatusInternalServerError, ErrorResponse: &models.ErrorResponse{Error: appErrors.ErrInternalServer.Error()}}
+		}
+		_ = controller.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+		err := encoder.Encode(line)
+		// Flush whenever the results written so far are all there is, so
+		// a client sending a line at a time gets its answer right away
+		if err == nil && len(pending) == 0 {
+			if err = out.Flush(); err == nil {
+				err = controller.Flush()
+			}
+		}
+		if err != nil {
+			// The client is gone; stop reading and looking up
+			cancel()
+			break
+		}
+	}
+	cancel()
+	<-readDone
+}
+
+// read parses the body line by line and queues a lookup for each line
+// until the body ends, a line can't be read or ctx is cancelled. Every
+// line after the first waits for a token from the limiter.
+func (h *StreamHandler) read(ctx context.Context, controller *http.ResponseController, body io.Reader, pending chan<- chan models.BatchResult) {
+	reader := bufio.NewReaderSize(body, streamMaxLineBytes)
+	for lines := 0; ; lines++ {
+		if reader.Buffered() == 0 {
+			_ = controller.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+		}
+		line, err := reader.ReadSlice('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			return
+		}
+
+		result := make(chan models.BatchResult, 1)
+		last := err != nil
+		switch {
+		case err != nil && !errors.Is(err, io.EOF):
+			if ctx.Err() != nil {
+				return
+			}
+			message := "failed to read request body"
+			if errors.Is(err, bufio.ErrBufferFull) {
+				message = fmt.Sprintf("line %d exceeds %d bytes", lines+1, streamMaxLineBytes)
+			}
+			result <- models.BatchResult{Status: http.StatusBadRequest, ErrorResponse: &models.ErrorResponse{Error: message}}
+		case lines == h.maxLines:
+			message := fmt.Sprintf("%s of %d lines", appErrors.ErrStreamTooLong.Error(), h.maxLines)
+			result <- models.BatchResult{Status: http.StatusRequestEntityTooLarge, ErrorResponse: &models.ErrorResponse{Error: message}}
+			last = true
+		default:
+			if lines > 0 {
+				if h.limiter.Wait(ctx) != nil {
+					return
+				}
+				// Time spent waiting for the rate limit doesn't count
+				// against the client's idle deadline
+				_ = controller.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+			}
+			ip, parseErr := parseStreamLine(line)
+			if parseErr != nil {
+				result <- models.BatchResult{IP: ip, Status: http.StatusBadRequest, ErrorResponse: &models.ErrorResponse{Error: appErrors.ErrInvalidStreamLine.Error()}}
+				break
+			}
+			utils.Go(func() {
+				defer close(result)
+				result <- lookupResult(ctx, h.service, ip)
+			})
+		}
+
+		select {
+		case pending <- result:
+		case <-ctx.Done():
+			return
+		}
+		if last {
+			return
+		}
+	}
+}
+
+// parseStreamLine returns the address on a line: bare, a JSON string or a
+// JSON object with an "ip" field. The address is copied out of line,
+// which the next read reuses.
+func parseStreamLine(line []byte) (string, error) {
+	line = bytes.TrimSpace(line)
+	switch {
+	case len(line) > 0 && line[0] == '{':
+		var record struct {
+			IP string `json:"ip"`
+		}
+		err := json.Unmarshal(line, &record)
+		return record.IP, err
+	case len(line) > 0 && line[0] == '"':
+		var ip string
+		err := json.Unmarshal(line, &ip)
+		return ip, err
+	default:
+		return string(line), nil
+	}
+}
+
+func (h *StreamHandler) writeError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"ip_country_project/internal/errors"
+)
+
+// ClientIPResolver finds the address of the client making a request.
+// Forwarding headers are only believed when the connection comes from a
+// trusted proxy, and only back to the first hop that isn't one, so a
+// client can't claim an address by sending the headers itself.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver creates a resolver trusting proxies in the given
+// networks; with none, the connection's address is always the client's
+func NewClientIPResolver(trusted []netip.Prefix) *ClientIPResolver {
+	return &ClientIPResolver{trusted: trusted}
+}
+
+// ClientIP returns the client's address. Behind a trusted proxy it is
+// taken from Forwarded (RFC 7239), X-Forwarded-For or X-Real-IP, the first
+// one present, walking the hops from the nearest: the first untrusted hop
+// is the client. If the chain reaches an unknown or obfuscated hop, the
+// trusted proxy that reported it is the best address known.
+func (c *ClientIPResolver) ClientIP(r *http.Request) (netip.Addr, error) {
+	peer, ok := parseHost(r.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, errors.ErrUnknownClient
+	}
+	if !c.isTrusted(peer) {
+		return peer, nil
+	}
+
+	var hops []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwardedFor(values)
+	} else if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	} else if value := r.Header.Get("X-Real-IP"); value != "" {
+		hops = []string{strings.TrimSpace(value)}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHost(hops[i])
+		if !ok {
+			break
+		}
+		client = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+	return client, nil
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, network := range c.trusted {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHost parses an address with or without a port, IPv6 optionally in
+// brackets as in RemoteAddr and Forwarded
+func parseHost(host string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(host); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	addr, err := netip.ParseAddr(host)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// forwardedFor returns the for= node of each element of Forwarded
+// headers, in order; elements without one yield "" so the hop still counts
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			node := ""
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					node = strings.Trim(strings.TrimSpace(value), `"`)
+				}
+			}
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+// splitQuoted splits value at sep outside of quoted strings
+func splitQuoted(value string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
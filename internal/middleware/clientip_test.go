@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIPResolver_ClientIP(t *testing.T) {
+	resolver := NewClientIPResolver([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	})
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"direct IPv6", "[2001:db8::7]:51234", nil, "2001:db8::7"},
+		{"mapped", "[::ffff:203.0.113.7]:51234", nil, "203.0.113.7"},
+		{"untrusted peer ignores headers", "203.0.113.7:51234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"trusted peer without headers", "10.0.0.2:51234", nil, "10.0.0.2"},
+		{"x-forwarded-for", "10.0.0.2:51234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop before the client", "10.0.0.2:51234", map[string]string{"X-Forwarded-For": "192.0.2.66, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"every hop trusted", "10.0.0.2:51234", map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"}, "10.0.0.4"},
+		{"garbage hop", "10.0.0.2:51234", map[string]string{"X-Forwarded-For": "198.51.100.1, bogus, 10.0.0.3"}, "10.0.0.3"},
+		{"x-real-ip", "10.0.0.2:51234", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"forwarded", "10.0.0.2:51234", map[string]string{"Forwarded": `for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"forwarded quoted separators", "10.0.0.2:51234", map[string]string{"Forwarded": `for=198.51.100.1;host="a,b;c", for=10.0.0.3`}, "198.51.100.1"},
+		{"forwarded obfuscated", "10.0.0.2:51234", map[string]string{"Forwarded": `for=198.51.100.1, for=_hidden, for=10.0.0.3`}, "10.0.0.3"},
+		{"forwarded without for", "10.0.0.2:51234", map[string]string{"Forwarded": `proto=https`}, "10.0.0.2"},
+		{"forwarded takes precedence", "10.0.0.2:51234", map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "192.0.2.66"}, "198.51.100.1"},
+		{"trusted IPv6 proxy", "[2001:db8:ffff::1]:443", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/me", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+
+			addr, err := resolver.ClientIP(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if addr.String() != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, addr)
+			}
+		})
+	}
+}
+
+func TestClientIPResolver_UnknownPeer(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/me", nil)
+	req.RemoteAddr = "@"
+	if _, err := NewClientIPResolver(nil).ClientIP(req); err == nil {
+		t.Error("expected an error for an unparseable RemoteAddr")
+	}
+}
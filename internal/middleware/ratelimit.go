@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"sync"
@@ -31,9 +32,69 @@ func NewRateLimiter(rps float64) *RateLimiter {
 
 // Allow checks if a request should be allowed based on token bucket algorithm
 func (l *RateLimiter) Allow() bool {
+	return l.AllowN(1)
+}
+
+// AllowN checks if n requests' worth of tokens can be taken at once, as
+// for a batch of lookups. A batch larger than the bucket is allowed once
+// the bucket is full and leaves it in debt, so it is still charged in full.
+func (l *RateLimiter) AllowN(n int) bool {
+	return l.take(max(min(float64(n), l.capacity), 1), n)
+}
+
+// AllowMore charges n further tokens to a request already admitted by
+// Allow, once its full size is known. It needs the tokens AllowN(n+1)
+// would have, less the one already taken, so a request larger than the
+// bucket is still allowed when the bucket was full.
+func (l *RateLimiter) AllowMore(n int) bool {
+	return l.take(max(min(float64(n+1), l.capacity), 1)-1, n)
+}
+
+// take charges n tokens if at least needed are available
+func (l *RateLimiter) take(needed float64, n int) bool {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
+	l.refill()
+
+	// Check if we have tokens available
+	if l.tokens >= needed {
+		l.tokens -= float64(n)
+		return true
+	}
+
+	return false
+}
+
+// Wait takes a token, blocking until one is free, or returns ctx's error
+// once ctx is done. It paces a long-running request, such as a stream,
+// to the rate limit instead of failing it.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mutex.Lock()
+		l.refill()
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mutex.Unlock()
+			return nil
+		}
+		// Sleep until the bucket has refilled to a whole token
+		delay := time.Duration((1 - l.tokens) / l.refillRate * float64(time.Second))
+		l.mutex.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// refill adds the tokens earned since the last refill. The caller holds
+// l.mutex.
+func (l *RateLimiter) refill() {
 	now := time.Now()
 	elapsed := now.Sub(l.lastRefill).Seconds()
 
@@ -46,14 +107,6 @@ func (l *RateLimiter) Allow() bool {
 		}
 		l.lastRefill = now
 	}
-
-	// Check if we have tokens available
-	if l.tokens >= 1 {
-		l.tokens -= 1
-		return true
-	}
-
-	return false
 }
 
 // Middleware returns an HTTP middleware that enforces rate limiting
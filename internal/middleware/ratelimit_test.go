@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -107,4 +108,76 @@ func TestRateLimiter_ConcurrentAccess(t *testing.T) {
 	}
 	
 	// If we get here without race detector issues, test passes
-}
\ No newline at end of file
+}
+
+func TestRateLimiter_AllowN(t *testing.T) {
+	rl := NewRateLimiter(10)
+
+	if !rl.AllowN(6) {
+		t.Fatal("batch within available tokens should be allowed")
+	}
+	if rl.AllowN(5) {
+		t.Fatal("batch beyond remaining tokens should be denied")
+	}
+	if !rl.AllowN(4) {
+		t.Fatal("batch using the remaining tokens should be allowed")
+	}
+	if rl.Allow() {
+		t.Fatal("request after exhausting tokens should be denied")
+	}
+}
+
+func TestRateLimiter_AllowN_LargerThanBucket(t *testing.T) {
+	rl := NewRateLimiter(10)
+
+	// A batch beyond capacity needs a full bucket and is charged in full
+	if !rl.AllowN(15) {
+		t.Fatal("oversized batch should be allowed with a full bucket")
+	}
+	rl.mutex.Lock()
+	tokens := rl.tokens
+	rl.mutex.Unlock()
+	if tokens > -4.9 {
+		t.Fatalf("expected the bucket to be in debt by the excess, got %f tokens", tokens)
+	}
+	if rl.Allow() {
+		t.Fatal("request while in debt should be denied")
+	}
+}
+
+func TestRateLimiter_AllowMore(t *testing.T) {
+	rl := NewRateLimiter(10)
+
+	// Admitted with one token, a request larger than the bucket is still
+	// allowed since the bucket was full
+	if !rl.AllowN(1) {
+		t.Fatal("first token should be allowed")
+	}
+	if !rl.AllowMore(14) {
+		t.Fatal("rest of an oversized request should be allowed with a full bucket")
+	}
+	if rl.AllowN(1) || rl.AllowMore(1) {
+		t.Fatal("request while in debt should be denied")
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	rl := NewRateLimiter(20)
+	rl.AllowN(20)
+
+	// An empty bucket makes Wait block for a refill instead of failing
+	start := time.Now()
+	if err := rl.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected Wait to block for a refill, returned after %v", elapsed)
+	}
+
+	// A cancelled context ends the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rl.Wait(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -1,11 +1,111 @@
 package models
 
+import "time"
+
 type Location struct {
 	IP      string `json:"ip,omitempty"`
 	Country string `json:"country"`
 	City    string `json:"city"`
+	// Extra holds additional dataset columns mapped by configuration
+	Extra map[string]string `json:"extra,omitempty"`
+	// Source names the layer that answered when datastores are composed
+	Source string `json:"source,omitempty"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
-}
\ No newline at end of file
+	// AddressClass and Network describe why a special-purpose address
+	// can't be located, e.g. "private" and "10.0.0.0/8"
+	AddressClass string `json:"address_class,omitempty"`
+	Network      string `json:"network,omitempty"`
+}
+
+// NetworkRecord is the dataset record an address matched: the network it
+// was given as, the first and last address it covers, the dataset it
+// comes from (the data file, or the layer of a composite datastore) and
+// its location. Network is empty for records given as arbitrary ranges.
+type NetworkRecord struct {
+	Network  string    `json:"network,omitempty"`
+	Start    string    `json:"start,omitempty"`
+	End      string    `json:"end,omitempty"`
+	Source   string    `json:"source"`
+	Location *Location `json:"location"`
+}
+
+// NetworkList is the dataset records answering for addresses in Network.
+// Truncated is set when there were more than were listed.
+type NetworkList struct {
+	Network   string          `json:"network"`
+	Records   []NetworkRecord `json:"records"`
+	Truncated bool            `json:"truncated"`
+}
+
+// CountryNetworks is a page of the addresses a dataset locates in Country,
+// and City when set, as the fewest networks covering them. Next is the
+// cursor of the following page, empty on the last one.
+type CountryNetworks struct {
+	Country  string   `json:"country"`
+	City     string   `json:"city,omitempty"`
+	Networks []string `json:"networks"`
+	Next     string   `json:"next,omitempty"`
+}
+
+// BatchResult is the answer for one address of a batch lookup: its
+// location, or the error and status a single lookup would have answered
+type BatchResult struct {
+	IP       string    `json:"ip"`
+	Status   int       `json:"status"`
+	Location *Location `json:"location,omitempty"`
+	*ErrorResponse
+}
+
+// LoadStatus describes the outcome of a datastore's most recent loads
+type LoadStatus struct {
+	Entries     int       `json:"entries"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	// Report describes the most recent load attempt, successful or not
+	Report *LoadReport `json:"report,omitempty"`
+	// Layers holds the status of each layer of a composite datastore
+	Layers []LayerStatus `json:"layers,omitempty"`
+	// Breaker describes the circuit breaker guarding a remote datastore
+	Breaker *BreakerStatus `json:"breaker,omitempty"`
+}
+
+// LayerStatus is the load status of one named layer
+type LayerStatus struct {
+	Name string `json:"name"`
+	LoadStatus
+}
+
+// BreakerStatus is the state of a circuit breaker: "closed", "open" or
+// "half-open". OpenedAt is set while it isn't closed.
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	// Trips counts how many times the breaker has opened
+	Trips int `json:"trips"`
+}
+
+// LoadReport summarizes how the rows of a data file were handled.
+// Duplicates repeat a network with the same country, Conflicts repeat it
+// with a different one, and OverlapConflicts count nested networks whose
+// country differs from the enclosing network. OffendingRows holds the
+// first few bad row numbers (1-based).
+type LoadReport struct {
+	Mode             string         `json:"mode"`
+	RowsRead         int            `json:"rows_read"`
+	Accepted         int            `json:"accepted"`
+	Skipped          map[string]int `json:"skipped,omitempty"`
+	Duplicates       int            `json:"duplicates"`
+	Conflicts        int            `json:"conflicts"`
+	OverlapConflicts int            `json:"overlap_conflicts"`
+	OffendingRows    []int          `json:"offending_rows,omitempty"`
+}
+
+type HealthResponse struct {
+	Status    string      `json:"status"`
+	Datastore *LoadStatus `json:"datastore,omitempty"`
+}
@@ -0,0 +1,264 @@
+// Package redis is a minimal Redis client speaking RESP2 directly: a
+// bounded connection pool, single commands and pipelines. It covers what
+// the Redis datastore needs and nothing more.
+package redis
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolSize = 10
+	defaultTimeout  = 3 * time.Second
+)
+
+// ErrClosed is returned by commands issued after Close
+var ErrClosed = stderrors.New("redis: client closed")
+
+// Options configures a Client
+type Options struct {
+	Addr     string // host:port
+	Password string
+	DB       int
+	// PoolSize caps the number of open connections; commands wait for a
+	// free one when all are busy
+	PoolSize int
+	// Timeout bounds dialing and each command when the context has no
+	// deadline
+	Timeout time.Duration
+}
+
+// ParseURL parses redis://[:password@]host[:port][/db]
+func ParseURL(rawURL string) (Options, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return Options{}, err
+	}
+	if parsed.Scheme != "redis" || parsed.Host == "" {
+		return Options{}, fmt.Errorf("%q is not a redis://host[:port][/db] URL", rawURL)
+	}
+
+	opts := Options{Addr: parsed.Host}
+	if parsed.Port() == "" {
+		opts.Addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		opts.Password, _ = parsed.User.Password()
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil || opts.DB < 0 {
+			return Options{}, fmt.Errorf("invalid database %q", db)
+		}
+	}
+	return opts, nil
+}
+
+// Client is safe for concurrent use. Connections are dialed lazily.
+type Client struct {
+	opts  Options
+	idle  chan *conn
+	slots chan struct{} // one token per open connection
+	done  chan struct{} // closed by Close
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func NewClient(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Client{
+		opts:  opts,
+		idle:  make(chan *conn, opts.PoolSize),
+		slots: make(chan struct{}, opts.PoolSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Do runs a single command. An error reply is returned as an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	replies, err := c.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := replies[0].(Error); ok {
+		return nil, replyErr
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends all commands in one write and reads their replies in
+// order. Error replies are returned in place as Error values; the error
+// result is for connection and protocol failures only.
+func (c *Client) Pipeline(ctx context.Context, commands ...[]string) ([]any, error) {
+	// Bound waiting for a connection, dialing and the exchange itself
+	ctx, cancel := context.WithDeadline(ctx, c.deadline(ctx))
+	defer cancel()
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := c.roundTrip(ctx, cn, commands)
+	// A failed exchange leaves unread replies behind; never reuse it
+	c.put(cn, err != nil)
+	return replies, err
+}
+
+func (c *Client) roundTrip(ctx context.Context, cn *conn, commands [][]string) ([]any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	for _, args := range commands {
+		if err := writeCommand(cn.writer, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]any, len(commands))
+	for i := range commands {
+		reply, err := readReply(cn.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+func (c *Client) deadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(c.opts.Timeout)
+}
+
+// get returns an idle connection, dials a new one while under PoolSize,
+// or waits for one to be returned
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case <-c.done:
+		return nil, ErrClosed
+	default:
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	case c.slots <- struct{}{}:
+		cn, err := c.dial(ctx)
+		if err != nil {
+			<-c.slots
+			return nil, err
+		}
+		return cn, nil
+	case <-c.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put returns a connection to the pool, or closes it if it is broken or
+// the client has been closed
+func (c *Client) put(cn *conn, broken bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if broken || c.closed {
+		_ = cn.Close()
+		<-c.slots
+		return
+	}
+	c.idle <- cn
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: c.opts.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: netConn, reader: bufio.NewReader(netConn), writer: bufio.NewWriter(netConn)}
+
+	var setup [][]string
+	if c.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", c.opts.Password})
+	}
+	if c.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	if len(setup) > 0 {
+		replies, err := c.roundTrip(ctx, cn, setup)
+		if err == nil {
+			for _, reply := range replies {
+				if replyErr, ok := reply.(Error); ok {
+					err = replyErr
+					break
+				}
+			}
+		}
+		if err != nil {
+			_ = cn.Close()
+			return nil, fmt.Errorf("redis: connection setup failed: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+// Close closes idle connections and makes busy ones close when their
+// command finishes. Later commands fail with ErrClosed.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+
+	var errs []error
+	for {
+		select {
+		case cn := <-c.idle:
+			if err := cn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			<-c.slots
+		default:
+			return stderrors.Join(errs...)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ip_country_project/internal/redis/redistest"
+)
+
+func newTestClient(t *testing.T, server *redistest.Server, poolSize int) *Client {
+	t.Helper()
+
+	opts, err := ParseURL(server.URL())
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	opts.PoolSize = poolSize
+	client := NewClient(opts)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// waitFor polls condition until it holds or a second has passed
+func waitFor(t *testing.T, condition func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+func TestClient_Do(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	client := newTestClient(t, server, 2)
+	ctx := context.Background()
+
+	if reply, err := client.Do(ctx, "SET", "greeting", "hello\r\nworld"); err != nil || reply != "OK" {
+		t.Fatalf("expected OK, got %v, %v", reply, err)
+	}
+	if reply, err := client.Do(ctx, "GET", "greeting"); err != nil || reply != "hello\r\nworld" {
+		t.Errorf("expected binary-safe bulk string, got %q, %v", reply, err)
+	}
+	if reply, err := client.Do(ctx, "GET", "missing"); err != nil || reply != nil {
+		t.Errorf("expected nil for a missing key, got %v, %v", reply, err)
+	}
+	if reply, err := client.Do(ctx, "INCR", "counter"); err != nil || reply != int64(1) {
+		t.Errorf("expected integer 1, got %v, %v", reply, err)
+	}
+
+	_, err := client.Do(ctx, "HGET", "greeting", "field")
+	var replyErr Error
+	if !stderrors.As(err, &replyErr) || !strings.HasPrefix(string(replyErr), "WRONGTYPE") {
+		t.Errorf("expected WRONGTYPE error reply, got %v", err)
+	}
+
+	// Error replies leave the connection usable
+	if reply, err := client.Do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Errorf("expected PONG after an error reply, got %v, %v", reply, err)
+	}
+	if server.AcceptedConnections() != 1 {
+		t.Errorf("expected sequential commands to share one connection, got %d", server.AcceptedConnections())
+	}
+}
+
+func TestClient_Pipeline(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	client := newTestClient(t, server, 1)
+
+	replies, err := client.Pipeline(context.Background(),
+		[]string{"HSET", "location", "country", "Germany", "city", "Berlin"},
+		[]string{"HGETALL", "location"},
+		[]string{"NOSUCHCOMMAND"},
+		[]string{"HLEN", "location"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected pipeline error: %v", err)
+	}
+
+	if replies[0] != int64(2) {
+		t.Errorf("expected 2 fields added, got %v", replies[0])
+	}
+	fields, ok := replies[1].([]any)
+	if !ok || len(fields) != 4 || fields[0] != "city" || fields[1] != "Berlin" {
+		t.Errorf("unexpected HGETALL reply: %v", replies[1])
+	}
+	if _, ok := replies[2].(Error); !ok {
+		t.Errorf("expected an error reply in place, got %v", replies[2])
+	}
+	if replies[3] != int64(2) {
+		t.Errorf("expected commands after an error to run, got %v", replies[3])
+	}
+}
+
+func TestClient_PoolSize(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	client := newTestClient(t, server, 3)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Do(context.Background(), "PING"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted := server.AcceptedConnections(); accepted > 3 {
+		t.Errorf("expected at most 3 connections, got %d", accepted)
+	}
+}
+
+func TestClient_CloseReleasesConnections(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	client := newTestClient(t, server, 4)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.Do(context.Background(), "PING")
+		}()
+	}
+	wg.Wait()
+
+	if server.OpenConnections() == 0 {
+		t.Fatal("expected pooled connections to stay open")
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if !waitFor(t, func() bool { return server.OpenConnections() == 0 }) {
+		t.Errorf("expected Close to release every connection, %d still open", server.OpenConnections())
+	}
+
+	if _, err := client.Do(context.Background(), "PING"); !stderrors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestClient_Auth(t *testing.T) {
+	server := redistest.NewServer(t, "s3cret")
+
+	client := newTestClient(t, server, 1)
+	if reply, err := client.Do(context.Background(), "PING"); err != nil || reply != "PONG" {
+		t.Errorf("expected authenticated PING, got %v, %v", reply, err)
+	}
+
+	wrong := NewClient(Options{Addr: server.Addr(), Password: "wrong"})
+	defer wrong.Close()
+	if _, err := wrong.Do(context.Background(), "PING"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("expected authentication failure, got %v", err)
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := redistest.NewServer(t, "")
+	client := newTestClient(t, server, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Do(ctx, "PING"); err == nil {
+		t.Error("expected a cancelled context to fail the command")
+	}
+
+	// The failed attempt must not leak its pool slot
+	if reply, err := client.Do(context.Background(), "PING"); err != nil || reply != "PONG" {
+		t.Errorf("expected PONG, got %v, %v", reply, err)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	input := "+OK\r\n-ERR bad\r\n:-42\r\n$5\r\nhello\r\n$-1\r\n*2\r\n$1\r\na\r\n:1\r\n*-1\r\n*0\r\n"
+	reader := bufio.NewReader(strings.NewReader(input))
+
+	expected := []any{"OK", Error("ERR bad"), int64(-42), "hello", nil}
+	for i, want := range expected {
+		reply, err := readReply(reader)
+		if err != nil || reply != want {
+			t.Errorf("reply %d: expected %v, got %v, %v", i, want, reply, err)
+		}
+	}
+	if reply, err := readReply(reader); err != nil || len(reply.([]any)) != 2 {
+		t.Errorf("expected a two-element array, got %v, %v", reply, err)
+	}
+	if reply, err := readReply(reader); err != nil || reply != nil {
+		t.Errorf("expected nil array, got %v, %v", reply, err)
+	}
+	if reply, err := readReply(reader); err != nil || len(reply.([]any)) != 0 {
+		t.Errorf("expected empty array, got %v, %v", reply, err)
+	}
+
+	for _, bad := range []string{"?x\r\n", "$3\r\nabcd\r\n", ":1\n", "$-2\r\n"} {
+		if _, err := readReply(bufio.NewReader(strings.NewReader(bad))); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	opts, err := ParseURL("redis://:pw@cache.internal/2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Addr != "cache.internal:6379" || opts.Password != "pw" || opts.DB != 2 {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+
+	for _, bad := range []string{"http://host", "redis://", "redis://host/x", "redis://host/-1"} {
+		if _, err := ParseURL(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+// Package redistest provides an in-process Redis stand-in for tests. It
+// speaks RESP2 and implements the handful of string, hash and sorted-set
+// commands the service uses, keeping everything in memory.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Server is a fake Redis server listening on a loopback port
+type Server struct {
+	listener net.Listener
+	password string
+
+	mutex  sync.Mutex
+	values map[string]any // string, map[string]string or *sortedSet
+	conns  map[net.Conn]bool
+
+	open     atomic.Int32
+	accepted atomic.Int32
+	commands atomic.Int32
+	wg       sync.WaitGroup
+}
+
+// sortedSet only supports members sharing a score, ordered
+// lexicographically, which is how the datastore uses sorted sets
+type sortedSet struct {
+	members []string
+}
+
+// NewServer starts a server and stops it when the test ends. A non-empty
+// password makes the server require AUTH.
+func NewServer(t testing.TB, password string) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &Server{listener: listener, password: password, values: make(map[string]any), conns: make(map[net.Conn]bool)}
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr is the host:port the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL is a redis:// URL for the server
+func (s *Server) URL() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.Addr()
+	}
+	return "redis://" + s.Addr()
+}
+
+// OpenConnections is the number of client connections currently open
+func (s *Server) OpenConnections() int {
+	return int(s.open.Load())
+}
+
+// AcceptedConnections is the number of connections accepted so far
+func (s *Server) AcceptedConnections() int {
+	return int(s.accepted.Load())
+}
+
+// Commands is the number of commands served so far
+func (s *Server) Commands() int {
+	return int(s.commands.Load())
+}
+
+// Keys lists the stored keys in sorted order
+func (s *Server) Keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Close stops the server and drops every open connection
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.mutex.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.accepted.Add(1)
+		s.open.Add(1)
+		s.mutex.Lock()
+		s.conns[conn] = true
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		_ = conn.Close()
+		s.open.Add(-1)
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.commands.Add(1)
+
+		var reply any
+		switch {
+		case strings.EqualFold(args[0], "AUTH"):
+			authenticated = len(args) == 2 && args[1] == s.password
+			reply = okOrError(authenticated, "WRONGPASS invalid password")
+		case !authenticated:
+			reply = replyError("NOAUTH Authentication required.")
+		default:
+			reply = s.execute(args)
+		}
+
+		writeReply(writer, reply)
+		// Flush once the client's pipelined commands are all answered
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+type replyError string
+
+type simpleString string
+
+func okOrError(ok bool, message string) any {
+	if ok {
+		return simpleString("OK")
+	}
+	return replyError(message)
+}
+
+func wrongType() any {
+	return replyError("WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func (s *Server) execute(args []string) any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	command := strings.ToUpper(args[0])
+	arity := map[string]int{
+		"PING": 1, "SELECT": 2, "GET": 2, "SET": 3, "INCR": 2, "EXPIRE": 3,
+		"HGET": 3, "HGETALL": 2, "HLEN": 2, "ZCARD": 2,
+	}
+	if n, ok := arity[command]; ok && len(args) != n {
+		return replyError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(command)))
+	}
+
+	switch command {
+	case "PING":
+		return simpleString("PONG")
+	case "SELECT":
+		return simpleString("OK")
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return nil
+		}
+		str, ok := value.(string)
+		if !ok {
+			return wrongType()
+		}
+		return str
+	case "SET":
+		s.values[args[1]] = args[2]
+		return simpleString("OK")
+	case "INCR":
+		current, _ := s.values[args[1]].(string)
+		n, _ := strconv.ParseInt(current, 10, 64)
+		n++
+		s.values[args[1]] = strconv.FormatInt(n, 10)
+		return n
+	case "DEL":
+		deleted := int64(0)
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				delete(s.values, key)
+				deleted++
+			}
+		}
+		return deleted
+	case "EXPIRE":
+		// Expiry is immediate: tests only need the key to go away
+		if _, ok := s.values[args[1]]; !ok {
+			return int64(0)
+		}
+		delete(s.values, args[1])
+		return int64(1)
+	case "HSET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return replyError("ERR wrong number of arguments for 'hset' command")
+		}
+		hash, err := s.hash(args[1], true)
+		if err != nil {
+			return err
+		}
+		added := int64(0)
+		for i := 2; i < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		hash, err := s.hash(args[1], false)
+		if err != nil {
+			return err
+		}
+		value, ok := hash[args[2]]
+		if !ok {
+			return nil
+		}
+		return value
+	case "HGETALL":
+		hash, err := s.hash(args[1], false)
+		if err != nil {
+			return err
+		}
+		fields := make([]string, 0, len(hash))
+		for field := range hash {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		reply := make([]any, 0, 2*len(hash))
+		for _, field := range fields {
+			reply = append(reply, field, hash[field])
+		}
+		return reply
+	case "HLEN":
+		hash, err := s.hash(args[1], false)
+		if err != nil {
+			return err
+		}
+		return int64(len(hash))
+	case "ZADD":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return replyError("ERR wrong number of arguments for 'zadd' command")
+		}
+		set, err := s.sortedSet(args[1], true)
+		if err != nil {
+			return err
+		}
+		added := int64(0)
+		for i := 2; i < len(args); i += 2 {
+			if args[i] != "0" {
+				return replyError("ERR redistest only supports score 0")
+			}
+			position, found := slices.BinarySearch(set.members, args[i+1])
+			if !found {
+				set.members = slices.Insert(set.members, position, args[i+1])
+				added++
+			}
+		}
+		return added
+	case "ZCARD":
+		set, err := s.sortedSet(args[1], false)
+		if err != nil {
+			return err
+		}
+		return int64(len(set.members))
+	case "ZRANGEBYLEX":
+		return s.rangeByLex(args)
+	default:
+		return replyError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+func (s *Server) hash(key string, create bool) (map[string]string, any) {
+	value, ok := s.values[key]
+	if !ok {
+		hash := make(map[string]string)
+		if create {
+			s.values[key] = hash
+		}
+		return hash, nil
+	}
+	hash, ok := value.(map[string]string)
+	if !ok {
+		return nil, wrongType()
+	}
+	return hash, nil
+}
+
+func (s *Server) sortedSet(key string, create bool) (*sortedSet, any) {
+	value, ok := s.values[key]
+	if !ok {
+		set := &sortedSet{}
+		if create {
+			s.values[key] = set
+		}
+		return set, nil
+	}
+	set, ok := value.(*sortedSet)
+	if !ok {
+		return nil, wrongType()
+	}
+	return set, nil
+}
+
+// rangeByLex implements ZRANGEBYLEX key min max [LIMIT offset count]
+func (s *Server) rangeByLex(args []string) any {
+	if len(args) != 4 && len(args) != 7 {
+		return replyError("ERR syntax error")
+	}
+	set, err := s.sortedSet(args[1], false)
+	if err != nil {
+		return err
+	}
+
+	offset, count := 0, -1
+	if len(args) == 7 {
+		if !strings.EqualFold(args[4], "LIMIT") {
+			return replyError("ERR syntax error")
+		}
+		var convErr error
+		if offset, convErr = strconv.Atoi(args[5]); convErr != nil {
+			return replyError("ERR value is not an integer or out of range")
+		}
+		if count, convErr = strconv.Atoi(args[6]); convErr != nil {
+			return replyError("ERR value is not an integer or out of range")
+		}
+	}
+
+	reply := []any{}
+	for _, member := range set.members {
+		if !aboveMin(member, args[2]) || !belowMax(member, args[3]) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if count == 0 {
+			break
+		}
+		reply = append(reply, member)
+		count--
+	}
+	return reply
+}
+
+func aboveMin(member, bound string) bool {
+	switch {
+	case bound == "-":
+		return true
+	case bound == "+":
+		return false
+	case strings.HasPrefix(bound, "["):
+		return member >= bound[1:]
+	default:
+		return member > bound[1:]
+	}
+}
+
+func belowMax(member, bound string) bool {
+	switch {
+	case bound == "+":
+		return true
+	case bound == "-":
+		return false
+	case strings.HasPrefix(bound, "["):
+		return member <= bound[1:]
+	default:
+		return member < bound[1:]
+	}
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid array length %q", line)
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected bulk string, got %q", line)
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:length])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case simpleString:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case replyError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxBulkLength is the largest bulk string Redis itself accepts
+const maxBulkLength = 512 << 20
+
+// Error is an error reply from the server. Pipelines return it in place
+// of the failed command's reply; it doesn't break the connection.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// writeCommand encodes a command as a RESP array of bulk strings
+func writeCommand(w *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply decodes one RESP2 reply: string for simple and bulk strings,
+// int64 for integers, nil for null bulk strings and arrays, []any for
+// arrays and Error for error replies
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redis: empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < -1 || length > maxBulkLength {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if length == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return nil, fmt.Errorf("redis: bulk string not terminated by CRLF")
+		}
+		return string(buf[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < -1 {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if count == -1 {
+			return nil, nil
+		}
+		items := make([]any, 0, min(count, 1024))
+		for range count {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+	}
+}
+
+// readLine reads a CRLF-terminated line without the terminator
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	stderrors "errors"
+	"maps"
+	"sync"
+	"time"
+
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+const (
+	defaultCacheTTL         = 5 * time.Minute
+	defaultCacheNegativeTTL = 30 * time.Second
+)
+
+// errLookupPanicked is what callers sharing a lookup get when it panics
+var errLookupPanicked = stderrors.New("shared datastore lookup panicked")
+
+// CacheConfig sizes the lookup cache of a LocationService; zero TTLs take
+// defaults
+type CacheConfig struct {
+	// Size is the most addresses kept; the least recently used go first
+	Size int
+	// TTL is how long a found location is served from the cache
+	TTL time.Duration
+	// NegativeTTL is how long a not-found answer is; keep it short so
+	// that newly added networks show up quickly
+	NegativeTTL time.Duration
+}
+
+// lookupCache is a bounded LRU cache of datastore answers with per-entry
+// expiry. Concurrent misses for the same address share one lookup.
+type lookupCache struct {
+	config CacheConfig
+	now    func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	calls   map[string]*cacheCall
+	// generation changes on every purge; lookups that started before it
+	// don't store their answer
+	generation uint64
+}
+
+type cacheEntry struct {
+	ip       string
+	location *models.Location // nil for a not-found answer
+	expires  time.Time
+}
+
+// cacheCall is a datastore lookup in flight, shared by concurrent misses
+type cacheCall struct {
+	done     chan struct{}
+	location *models.Location
+	err      error
+}
+
+func newLookupCache(config CacheConfig) *lookupCache {
+	if config.TTL <= 0 {
+		config.TTL = defaultCacheTTL
+	}
+	if config.NegativeTTL <= 0 {
+		config.NegativeTTL = defaultCacheNegativeTTL
+	}
+	return &lookupCache{
+		config:  config,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		calls:   make(map[string]*cacheCall),
+	}
+}
+
+// find answers from the cache or, on a miss, from lookup. Only locations
+// and errors.ErrIPNotFound are cached. The returned location is the
+// caller's to modify.
+func (c *lookupCache) find(ctx context.Context, ip string, lookup func(context.Context) (*models.Location, error)) (*models.Location, error) {
+	for {
+		c.mutex.Lock()
+		if location, found, ok := c.get(ip); ok {
+			c.mutex.Unlock()
+			if !found {
+				return nil, errors.ErrIPNotFound
+			}
+			return copyLocation(location), nil
+		}
+
+		call, shared := c.calls[ip]
+		if !shared {
+			call = &cacheCall{done: make(chan struct{})}
+			c.calls[ip] = call
+			generation := c.generation
+			c.mutex.Unlock()
+
+			// Completing in a defer releases the waiters and the calls
+			// entry even if lookup panics
+			call.err = errLookupPanicked
+			defer c.complete(ip, call, generation)
+			call.location, call.err = lookup(ctx)
+			return copyLocation(call.location), call.err
+		}
+		c.mutex.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// The lookup we joined was cut short by its own caller; this one
+		// may still have time to try
+		if isContextError(call.err) && ctx.Err() == nil {
+			continue
+		}
+		return copyLocation(call.location), call.err
+	}
+}
+
+// get returns a live entry; found is false for a cached not-found answer
+func (c *lookupCache) get(ip string) (location *models.Location, found, ok bool) {
+	element, ok := c.entries[ip]
+	if !ok {
+		return nil, false, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, ip)
+		return nil, false, false
+	}
+	c.order.MoveToFront(element)
+	return entry.location, entry.location != nil, true
+}
+
+// complete publishes a finished lookup to its waiters and caches it
+func (c *lookupCache) complete(ip string, call *cacheCall, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	close(call.done)
+
+	if c.generation != generation {
+		// Purged while in flight: the answer may predate the reload, and
+		// the call was already dropped from calls
+		return
+	}
+	delete(c.calls, ip)
+
+	var ttl time.Duration
+	switch {
+	case call.err == nil:
+		ttl = c.config.TTL
+	case stderrors.Is(call.err, errors.ErrIPNotFound):
+		ttl = c.config.NegativeTTL
+	default:
+		return
+	}
+	c.put(ip, call.location, c.now().Add(ttl))
+}
+
+func (c *lookupCache) put(ip string, location *models.Location, expires time.Time) {
+	if element, ok := c.entries[ip]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.location, entry.expires = location, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[ip] = c.order.PushFront(&cacheEntry{ip: ip, location: location, expires: expires})
+	for c.order.Len() > c.config.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).ip)
+	}
+}
+
+// purge drops every entry and detaches lookups in flight, so nothing
+// loaded before the purge is served after it
+func (c *lookupCache) purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.calls = make(map[string]*cacheCall)
+}
+
+func copyLocation(location *models.Location) *models.Location {
+	if location == nil {
+		return nil
+	}
+	copied := *location
+	copied.Extra = maps.Clone(location.Extra)
+	return &copied
+}
+
+func isContextError(err error) bool {
+	return stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appErrors "ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+)
+
+// countingDataStore knows 8.8.8.8 and counts the lookups reaching it
+func countingDataStore(lookups *atomic.Int32) *mockDataStore {
+	return &mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			lookups.Add(1)
+			if ip == "8.8.8.8" {
+				return &models.Location{IP: ip, Country: "United States", Extra: map[string]string{"asn": "15169"}}, nil
+			}
+			return nil, appErrors.ErrIPNotFound
+		},
+	}
+}
+
+func (c *lookupCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// setupCachedService returns a service with a cache on a controllable clock
+func setupCachedService(datastore *mockDataStore, config CacheConfig) (*LocationService, *time.Time) {
+	service := NewLocationService(datastore, WithCache(config))
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	service.cache.now = func() time.Time { return clock }
+	return service, &clock
+}
+
+func TestLocationService_Cache_Hits(t *testing.T) {
+	var lookups atomic.Int32
+	service, _ := setupCachedService(countingDataStore(&lookups), CacheConfig{Size: 10})
+
+	for range 3 {
+		location, err := service.FindCountry(context.Background(), "8.8.8.8")
+		if err != nil || location.Country != "United States" {
+			t.Fatalf("unexpected result: %+v, %v", location, err)
+		}
+		// Callers get their own copy
+		location.Country = "modified"
+		location.Extra["asn"] = "modified"
+	}
+	// Equivalent spellings share an entry
+	if _, err := service.FindCountry(context.Background(), "::ffff:8.8.8.8"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	location, _ := service.FindCountry(context.Background(), "8.8.8.8")
+	if location.Country != "United States" || location.Extra["asn"] != "15169" {
+		t.Errorf("expected cached entry to be unaffected by callers, got %+v", location)
+	}
+	if lookups.Load() != 1 {
+		t.Errorf("expected 1 datastore lookup, got %d", lookups.Load())
+	}
+}
+
+func TestLocationService_Cache_Expiry(t *testing.T) {
+	var lookups atomic.Int32
+	service, clock := setupCachedService(countingDataStore(&lookups), CacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: 10 * time.Second})
+
+	lookup := func(ip string) {
+		t.Helper()
+		_, _ = service.FindCountry(context.Background(), ip)
+	}
+
+	lookup("8.8.8.8")
+	lookup("9.9.9.9")
+	if _, err := service.FindCountry(context.Background(), "9.9.9.9"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Fatalf("expected a cached ErrIPNotFound, got %v", err)
+	}
+	if lookups.Load() != 2 {
+		t.Fatalf("expected 2 datastore lookups, got %d", lookups.Load())
+	}
+
+	// Not-found answers expire first
+	*clock = clock.Add(10 * time.Second)
+	lookup("8.8.8.8")
+	lookup("9.9.9.9")
+	if lookups.Load() != 3 {
+		t.Errorf("expected only the negative entry to expire, got %d lookups", lookups.Load())
+	}
+
+	*clock = clock.Add(50 * time.Second)
+	lookup("8.8.8.8")
+	if lookups.Load() != 4 {
+		t.Errorf("expected the positive entry to expire, got %d lookups", lookups.Load())
+	}
+}
+
+func TestLocationService_Cache_Eviction(t *testing.T) {
+	var lookups atomic.Int32
+	service, _ := setupCachedService(countingDataStore(&lookups), CacheConfig{Size: 2})
+
+	for _, ip := range []string{"1.0.0.1", "1.0.0.2", "1.0.0.1", "1.0.0.3"} {
+		_, _ = service.FindCountry(context.Background(), ip)
+	}
+	if service.cache.len() != 2 {
+		t.Errorf("expected the cache to stay at 2 entries, got %d", service.cache.len())
+	}
+
+	// 1.0.0.2 was least recently used when 1.0.0.3 arrived
+	lookups.Store(0)
+	_, _ = service.FindCountry(context.Background(), "1.0.0.1")
+	_, _ = service.FindCountry(context.Background(), "1.0.0.3")
+	if lookups.Load() != 0 {
+		t.Errorf("expected recently used entries to be kept, got %d lookups", lookups.Load())
+	}
+	_, _ = service.FindCountry(context.Background(), "1.0.0.2")
+	if lookups.Load() != 1 {
+		t.Errorf("expected the least recently used entry to be evicted, got %d lookups", lookups.Load())
+	}
+}
+
+func TestLocationService_Cache_ErrorsNotCached(t *testing.T) {
+	var lookups atomic.Int32
+	service, _ := setupCachedService(&mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			lookups.Add(1)
+			return nil, appErrors.ErrUpstream
+		},
+	}, CacheConfig{Size: 10})
+
+	for range 2 {
+		if _, err := service.FindCountry(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrUpstream) {
+			t.Fatalf("expected ErrUpstream, got %v", err)
+		}
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("expected datastore errors not to be cached, got %d lookups", lookups.Load())
+	}
+}
+
+func TestLocationService_Cache_CollapsesConcurrentMisses(t *testing.T) {
+	var lookups atomic.Int32
+	release := make(chan struct{})
+	service, _ := setupCachedService(&mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			lookups.Add(1)
+			<-release
+			return &models.Location{IP: ip, Country: "Australia"}, nil
+		},
+	}, CacheConfig{Size: 10})
+
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			location, err := service.FindCountry(context.Background(), "1.1.1.1")
+			if err == nil && location.Country != "Australia" {
+				err = fmt.Errorf("unexpected location %+v", location)
+			}
+			errs <- err
+		}()
+	}
+
+	// Let every caller queue up behind the first lookup
+	for lookups.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if lookups.Load() != 1 {
+		t.Errorf("expected concurrent misses to share 1 lookup, got %d", lookups.Load())
+	}
+}
+
+func TestLocationService_Cache_CancelledLeader(t *testing.T) {
+	var lookups atomic.Int32
+	started := make(chan struct{}, 2)
+	service, _ := setupCachedService(&mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			if lookups.Add(1) == 1 {
+				started <- struct{}{}
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &models.Location{IP: ip, Country: "Australia"}, nil
+		},
+	}, CacheConfig{Size: 10})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err := service.FindCountry(ctx, "1.1.1.1")
+		leaderDone <- err
+	}()
+	<-started
+
+	followerDone := make(chan error)
+	go func() {
+		location, err := service.FindCountry(context.Background(), "1.1.1.1")
+		if err == nil && location.Country != "Australia" {
+			err = fmt.Errorf("unexpected location %+v", location)
+		}
+		followerDone <- err
+	}()
+	// Give the other caller time to join the first lookup
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled caller to fail, got %v", err)
+	}
+	if err := <-followerDone; err != nil {
+		t.Errorf("expected the other caller to retry the lookup, got %v", err)
+	}
+}
+
+func TestLocationService_Cache_InvalidatedOnReload(t *testing.T) {
+	country := "United States"
+	datastore := &mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			return &models.Location{IP: ip, Country: country}, nil
+		},
+	}
+	service, _ := setupCachedService(datastore, CacheConfig{Size: 10})
+	reloads := NewReloadService(datastore)
+	reloads.OnReload(service.InvalidateCache)
+
+	_, _ = service.FindCountry(context.Background(), "8.8.8.8")
+	country = "Canada"
+	if location, _ := service.FindCountry(context.Background(), "8.8.8.8"); location.Country != "United States" {
+		t.Fatalf("expected the cached answer before reloading, got %s", location.Country)
+	}
+
+	if err := reloads.Reload(context.Background()); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if location, _ := service.FindCountry(context.Background(), "8.8.8.8"); location.Country != "Canada" {
+		t.Errorf("expected fresh data after reloading, got %s", location.Country)
+	}
+}
+
+func TestLocationService_Cache_PurgeDuringLookup(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var lookups atomic.Int32
+	service, _ := setupCachedService(&mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			if lookups.Add(1) == 1 {
+				close(started)
+				<-release
+				return &models.Location{IP: ip, Country: "Stale"}, nil
+			}
+			return &models.Location{IP: ip, Country: "Fresh"}, nil
+		},
+	}, CacheConfig{Size: 10})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = service.FindCountry(context.Background(), "8.8.8.8")
+	}()
+	<-started
+	service.InvalidateCache()
+	close(release)
+	<-done
+
+	// The answer loaded before the purge must not be cached
+	if location, _ := service.FindCountry(context.Background(), "8.8.8.8"); location.Country != "Fresh" {
+		t.Errorf("expected a fresh lookup after the purge, got %s", location.Country)
+	}
+}
+
+func TestLocationService_Cache_PanickedLookup(t *testing.T) {
+	cache := newLookupCache(CacheConfig{Size: 10})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the lookup's panic to propagate")
+			}
+		}()
+		_, _ = cache.find(context.Background(), "1.1.1.1", func(ctx context.Context) (*models.Location, error) {
+			panic("datastore bug")
+		})
+	}()
+
+	// The panicked call no longer blocks later lookups of the address
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.find(context.Background(), "1.1.1.1", func(ctx context.Context) (*models.Location, error) {
+			return &models.Location{IP: "1.1.1.1", Country: "Australia"}, nil
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup blocked behind the panicked call")
+	}
+}
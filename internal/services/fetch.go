@@ -0,0 +1,267 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ip_country_project/internal/utils"
+)
+
+const defaultFetchTimeout = 5 * time.Minute
+
+// FetchConfig describes where a data file is downloaded from
+type FetchConfig struct {
+	// URL is the data file to download
+	URL string
+	// ChecksumURL serves the file's SHA-256 as hex, optionally followed
+	// by a file name as sha256sum prints it; defaults to URL + ".sha256"
+	ChecksumURL string
+	// FilePath is where the last good copy is kept. Validators for
+	// conditional requests are kept next to it in FilePath + ".fetch.json".
+	FilePath string
+	// Timeout bounds each download
+	Timeout time.Duration
+	// Validate, if set, checks a verified download before it replaces
+	// FilePath, e.g. by loading it
+	Validate func(ctx context.Context, path string) error
+	Client   *http.Client
+}
+
+// fetchState is what the previous successful download is remembered by
+type fetchState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+// FetchService keeps a local data file in sync with a URL. Downloads are
+// conditional, verified against a SHA-256 sidecar and validated before
+// atomically replacing the local copy, so the file on disk is always the
+// last good version and can serve a cold start while the URL is down.
+type FetchService struct {
+	config   FetchConfig
+	client   *http.Client
+	mutex    sync.Mutex // serializes fetches
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewFetchService(config FetchConfig) *FetchService {
+	if config.ChecksumURL == "" {
+		config.ChecksumURL = config.URL + ".sha256"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultFetchTimeout
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &FetchService{
+		config: config,
+		client: client,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Fetch downloads the data file if it changed since the last fetch and
+// reports whether the local copy was replaced. On any error the local
+// copy is left untouched.
+func (s *FetchService) Fetch(ctx context.Context) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	previous := s.readState()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to download data file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to download data file: status %d", resp.StatusCode)
+	}
+
+	tmp, sum, err := s.download(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+
+	expected, err := s.fetchChecksum(ctx)
+	if err != nil {
+		return false, err
+	}
+	if sum != expected {
+		return false, fmt.Errorf("checksum mismatch: downloaded %s, expected %s", sum, expected)
+	}
+
+	current := fetchState{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       sum,
+	}
+	if sum == previous.SHA256 {
+		// The server didn't honour the validators but nothing changed
+		s.writeState(current)
+		return false, nil
+	}
+
+	if s.config.Validate != nil {
+		if err := s.config.Validate(ctx, tmp); err != nil {
+			return false, fmt.Errorf("downloaded data file is invalid: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, s.config.FilePath); err != nil {
+		return false, fmt.Errorf("failed to replace data file: %w", err)
+	}
+	s.writeState(current)
+	return true, nil
+}
+
+// download streams body into a temporary file next to FilePath, returning
+// its path and SHA-256
+func (s *FetchService) download(body io.Reader) (string, string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.FilePath), filepath.Base(s.config.FilePath)+".download-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create download file: %w", err)
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	if err == nil {
+		// CreateTemp is private to the owner; the data file is not
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", "", fmt.Errorf("failed to download data file: %w", err)
+	}
+	return tmp.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fetchChecksum reads the SHA-256 sidecar
+func (s *FetchService) fetchChecksum(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.ChecksumURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download checksum: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download checksum: status %d", resp.StatusCode)
+	}
+
+	line, err := bufio.NewReader(io.LimitReader(resp.Body, 4096)).ReadString('\n')
+	if err != nil && !stderrors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to download checksum: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("invalid checksum file: empty")
+	}
+	sum := strings.ToLower(fields[0])
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum file: %q is not a SHA-256", fields[0])
+	}
+	return sum, nil
+}
+
+func (s *FetchService) statePath() string {
+	return s.config.FilePath + ".fetch.json"
+}
+
+// readState returns the validators of the local copy; none if there is
+// no local copy to fall back on
+func (s *FetchService) readState() fetchState {
+	var state fetchState
+	if _, err := os.Stat(s.config.FilePath); err != nil {
+		return state
+	}
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		return state
+	}
+	_ = json.Unmarshal(data, &state)
+	return state
+}
+
+// writeState records validators; failing to only costs a full download
+// next time
+func (s *FetchService) writeState(state fetchState) {
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(s.statePath(), data, 0o644); err != nil {
+		log.Printf("Failed to record fetch state: %v", err)
+	}
+}
+
+// Start fetches every interval and calls reload after each new download,
+// typically ReloadService.Reload. It returns immediately; call Stop to end
+// fetching.
+func (s *FetchService) Start(interval time.Duration, reload func(context.Context) error) {
+	utils.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+
+			changed, err := s.Fetch(context.Background())
+			if err != nil {
+				log.Printf("Data file fetch failed, keeping current data: %v", err)
+				continue
+			}
+			if changed {
+				_ = reload(context.Background())
+			}
+		}
+	})
+}
+
+// Stop ends fetching started by Start
+func (s *FetchService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
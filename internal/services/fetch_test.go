@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fetchOrigin serves a data file with an ETag and its SHA-256 sidecar
+type fetchOrigin struct {
+	mutex     sync.Mutex
+	data      string
+	checksum  string // overrides the sidecar when set
+	down      bool
+	downloads int
+}
+
+// publish replaces the data file; change, if set, then alters the origin
+func (o *fetchOrigin) publish(data string, change func(o *fetchOrigin)) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.data, o.checksum, o.down = data, "", false
+	if change != nil {
+		change(o)
+	}
+}
+
+func (o *fetchOrigin) downloaded() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.downloads
+}
+
+func (o *fetchOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	sum := sha256.Sum256([]byte(o.data))
+	digest := hex.EncodeToString(sum[:])
+
+	switch r.URL.Path {
+	case "/data.csv":
+		etag := `"` + digest[:16] + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		o.downloads++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(o.data))
+	case "/data.csv.sha256":
+		if o.checksum != "" {
+			digest = o.checksum
+		}
+		_, _ = w.Write([]byte(digest + "  data.csv\n"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setupFetchService(t *testing.T, origin *fetchOrigin, validate func(ctx context.Context, path string) error) (*FetchService, string) {
+	t.Helper()
+
+	server := httptest.NewServer(origin)
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "data.csv")
+	fetches := NewFetchService(FetchConfig{URL: server.URL + "/data.csv", FilePath: path, Validate: validate})
+	t.Cleanup(fetches.Stop)
+	return fetches, path
+}
+
+func expectFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("expected data file %q, got %q", expected, data)
+	}
+}
+
+func TestFetchService_Fetch(t *testing.T) {
+	origin := &fetchOrigin{data: "8.8.8.8,Mountain View,United States\n"}
+	fetches, path := setupFetchService(t, origin, nil)
+
+	changed, err := fetches.Fetch(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("expected a new download, got %v, %v", changed, err)
+	}
+	expectFileContent(t, path, "8.8.8.8,Mountain View,United States\n")
+
+	// Unchanged: the conditional request is answered with 304
+	changed, err = fetches.Fetch(context.Background())
+	if err != nil || changed {
+		t.Errorf("expected no change, got %v, %v", changed, err)
+	}
+	if origin.downloaded() != 1 {
+		t.Errorf("expected 1 full download, got %d", origin.downloaded())
+	}
+
+	origin.publish("1.1.1.1,Sydney,Australia\n", nil)
+	changed, err = fetches.Fetch(context.Background())
+	if err != nil || !changed {
+		t.Fatalf("expected the new version, got %v, %v", changed, err)
+	}
+	expectFileContent(t, path, "1.1.1.1,Sydney,Australia\n")
+
+	// Validators survive a restart
+	restarted := NewFetchService(fetches.config)
+	if changed, err := restarted.Fetch(context.Background()); err != nil || changed {
+		t.Errorf("expected no change after a restart, got %v, %v", changed, err)
+	}
+	if origin.downloaded() != 2 {
+		t.Errorf("expected 2 full downloads, got %d", origin.downloaded())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".download-") {
+			t.Errorf("expected temporary downloads to be removed, found %s", entry.Name())
+		}
+	}
+}
+
+func TestFetchService_Fetch_KeepsLastGoodCopy(t *testing.T) {
+	origin := &fetchOrigin{data: "8.8.8.8,Mountain View,United States\n"}
+	validate := func(ctx context.Context, path string) error {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "garbage") {
+			return errors.New("unparseable")
+		}
+		return nil
+	}
+	fetches, path := setupFetchService(t, origin, validate)
+	good := "8.8.8.8,Mountain View,United States\n"
+	if _, err := fetches.Fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		data   string
+		change func(o *fetchOrigin)
+	}{
+		"checksum mismatch": {"1.1.1.1,Sydney,Australia\n", func(o *fetchOrigin) { o.checksum = strings.Repeat("0", 64) }},
+		"invalid checksum":  {"1.1.1.1,Sydney,Australia\n", func(o *fetchOrigin) { o.checksum = "not-a-checksum" }},
+		"failed validation": {"garbage\n", nil},
+		"source down":       {"1.1.1.1,Sydney,Australia\n", func(o *fetchOrigin) { o.down = true }},
+	}
+	for name, tc := range testCases {
+		origin.publish(tc.data, tc.change)
+		if changed, err := fetches.Fetch(context.Background()); err == nil || changed {
+			t.Errorf("%s: expected the fetch to fail, got %v, %v", name, changed, err)
+		}
+		expectFileContent(t, path, good)
+	}
+}
+
+func TestFetchService_Start(t *testing.T) {
+	origin := &fetchOrigin{data: "8.8.8.8,Mountain View,United States\n"}
+	fetches, path := setupFetchService(t, origin, nil)
+	if _, err := fetches.Fetch(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var reloads atomic.Int32
+	fetches.Start(10*time.Millisecond, func(ctx context.Context) error {
+		reloads.Add(1)
+		return nil
+	})
+
+	// Nothing changed: no reloads
+	time.Sleep(50 * time.Millisecond)
+	if reloads.Load() != 0 {
+		t.Fatalf("expected no reload while the file is unchanged, got %d", reloads.Load())
+	}
+
+	origin.publish("1.1.1.1,Sydney,Australia\n", nil)
+	deadline := time.Now().Add(time.Second)
+	for reloads.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if reloads.Load() != 1 {
+		t.Errorf("expected 1 reload after a new version, got %d", reloads.Load())
+	}
+	expectFileContent(t, path, "1.1.1.1,Sydney,Australia\n")
+}
@@ -2,35 +2,120 @@ package services
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
+
 	"ip_country_project/internal/datastores"
 	"ip_country_project/internal/errors"
 	"ip_country_project/internal/models"
 	"ip_country_project/internal/utils"
 )
 
+// SpecialAddressPolicy decides whether special-purpose addresses such as
+// private or loopback ranges reach the datastore
+type SpecialAddressPolicy string
+
+const (
+	// SpecialAddressesReject answers special-purpose addresses without a lookup
+	SpecialAddressesReject SpecialAddressPolicy = "reject"
+	// SpecialAddressesLookup looks them up first, for datasets that map
+	// internal ranges, and only classifies them when there is no entry
+	SpecialAddressesLookup SpecialAddressPolicy = "lookup"
+)
+
+// NonPublicAddressError reports a query for a special-purpose address. It
+// matches errors.ErrNonPublicIP.
+type NonPublicAddressError struct {
+	utils.SpecialPurpose
+}
+
+func (e *NonPublicAddressError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", errors.ErrNonPublicIP, e.Name, e.Network)
+}
+
+func (e *NonPublicAddressError) Unwrap() error {
+	return errors.ErrNonPublicIP
+}
+
 // LocationService provides business logic for IP location lookups
 type LocationService struct {
-	datastore datastores.DataStore
+	datastore        datastores.DataStore
+	specialAddresses SpecialAddressPolicy
+	cache            *lookupCache // nil when caching is disabled
+}
+
+// LocationOption configures a LocationService
+type LocationOption func(*LocationService)
+
+// WithSpecialAddresses sets how special-purpose addresses are handled;
+// the default is SpecialAddressesLookup, so datasets that map internal
+// ranges keep answering for them
+func WithSpecialAddresses(policy SpecialAddressPolicy) LocationOption {
+	return func(s *LocationService) {
+		s.specialAddresses = policy
+	}
 }
 
-func NewLocationService(datastore datastores.DataStore) *LocationService {
-	return &LocationService{
-		datastore: datastore,
+// WithCache answers repeated lookups from a bounded in-process cache. A
+// Size of zero leaves caching disabled. Call InvalidateCache whenever the
+// datastore reloads.
+func WithCache(config CacheConfig) LocationOption {
+	return func(s *LocationService) {
+		if config.Size > 0 {
+			s.cache = newLookupCache(config)
+		}
 	}
 }
 
+func NewLocationService(datastore datastores.DataStore, opts ...LocationOption) *LocationService {
+	service := &LocationService{
+		datastore:        datastore,
+		specialAddresses: SpecialAddressesLookup,
+	}
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
+}
+
 func (s *LocationService) FindCountry(ctx context.Context, ip string) (*models.Location, error) {
 	// Normalize and validate IP format
-	if !utils.IsValidIP(ip) {
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
 		return nil, errors.ErrInvalidIP
 	}
-	normalizedIP := utils.NormalizeIP(ip)
+	normalizedIP := addr.String()
+
+	special, isSpecial := utils.ClassifyAddr(addr)
+	if isSpecial && s.specialAddresses != SpecialAddressesLookup {
+		return nil, &NonPublicAddressError{special}
+	}
 
 	// Delegate to datastore with context
-	location, err := s.datastore.FindLocation(ctx, normalizedIP)
+	location, err := s.findLocation(ctx, normalizedIP)
+	if isSpecial && stderrors.Is(err, errors.ErrIPNotFound) {
+		return nil, &NonPublicAddressError{special}
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return location, nil
 }
+
+func (s *LocationService) findLocation(ctx context.Context, ip string) (*models.Location, error) {
+	if s.cache == nil {
+		return s.datastore.FindLocation(ctx, ip)
+	}
+	return s.cache.find(ctx, ip, func(ctx context.Context) (*models.Location, error) {
+		return s.datastore.FindLocation(ctx, ip)
+	})
+}
+
+// InvalidateCache drops every cached answer so that lookups see freshly
+// loaded data
+func (s *LocationService) InvalidateCache() {
+	if s.cache != nil {
+		s.cache.purge()
+	}
+}
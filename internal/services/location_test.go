@@ -158,6 +158,91 @@ func TestLocationService_FindCountry_IPNormalization(t *testing.T) {
 	if receivedIP != "8.8.8.8" {
 		t.Errorf("expected normalized IP '8.8.8.8', but datastore received '%s'", receivedIP)
 	}
+
+	// IPv6 is canonicalized and IPv4-mapped addresses are unwrapped
+	testCases := map[string]string{
+		"2606:4700:4700::1111":                 "2606:4700:4700::1111",
+		"2606:4700:4700:0000:0000:0000:0:1111": "2606:4700:4700::1111",
+		"::ffff:8.8.8.8":                       "8.8.8.8",
+		"::FFFF:0808:0808":                     "8.8.8.8",
+	}
+	for input, expected := range testCases {
+		if _, err := service.FindCountry(context.Background(), input); err != nil {
+			t.Fatalf("unexpected error for '%s': %v", input, err)
+		}
+		if receivedIP != expected {
+			t.Errorf("expected '%s' for '%s', but datastore received '%s'", expected, input, receivedIP)
+		}
+	}
+}
+
+func TestLocationService_FindCountry_SpecialAddresses(t *testing.T) {
+	lookups := 0
+	mockDS := &mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			lookups++
+			return nil, appErrors.ErrIPNotFound
+		},
+	}
+	service := NewLocationService(mockDS, WithSpecialAddresses(SpecialAddressesReject))
+
+	testCases := map[string]string{
+		"10.0.0.1":           "private",
+		"127.0.0.1":          "loopback",
+		"169.254.1.1":        "link-local",
+		"100.64.0.1":         "cgnat",
+		"224.0.0.1":          "multicast",
+		"198.51.100.1":       "documentation",
+		"240.0.0.1":          "reserved",
+		"::1":                "loopback",
+		"fe80::1":            "link-local",
+		"::ffff:192.168.0.1": "private",
+	}
+
+	for ip, expected := range testCases {
+		_, err := service.FindCountry(context.Background(), ip)
+		if !errors.Is(err, appErrors.ErrNonPublicIP) {
+			t.Errorf("expected ErrNonPublicIP for %s, got %v", ip, err)
+			continue
+		}
+		var nonPublic *NonPublicAddressError
+		if !errors.As(err, &nonPublic) || string(nonPublic.Class) != expected {
+			t.Errorf("expected class %s for %s, got %v", expected, ip, err)
+		}
+	}
+	if lookups != 0 {
+		t.Errorf("expected special addresses not to reach the datastore, got %d lookups", lookups)
+	}
+
+	// Public addresses still get a plain not-found
+	if _, err := service.FindCountry(context.Background(), "8.8.8.8"); !errors.Is(err, appErrors.ErrIPNotFound) {
+		t.Errorf("expected ErrIPNotFound for a public address, got %v", err)
+	}
+}
+
+func TestLocationService_FindCountry_SpecialAddressLookup(t *testing.T) {
+	mockDS := &mockDataStore{
+		findLocationFunc: func(ctx context.Context, ip string) (*models.Location, error) {
+			if ip == "10.0.0.1" {
+				return &models.Location{IP: ip, Country: "Office"}, nil
+			}
+			return nil, appErrors.ErrIPNotFound
+		},
+	}
+	service := NewLocationService(mockDS, WithSpecialAddresses(SpecialAddressesLookup))
+
+	location, err := service.FindCountry(context.Background(), "10.0.0.1")
+	if err != nil {
+		t.Fatalf("expected mapped private address to be found, got %v", err)
+	}
+	if location.Country != "Office" {
+		t.Errorf("expected country 'Office', got '%s'", location.Country)
+	}
+
+	// Without an entry the address is still classified
+	if _, err := service.FindCountry(context.Background(), "10.0.0.2"); !errors.Is(err, appErrors.ErrNonPublicIP) {
+		t.Errorf("expected ErrNonPublicIP for unmapped private address, got %v", err)
+	}
 }
 
 func TestNewLocationService(t *testing.T) {
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"net/netip"
+
+	"ip_country_project/internal/datastores"
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/models"
+	"ip_country_project/internal/utils"
+)
+
+// FindNetwork returns the dataset record ip matched. Special-purpose
+// addresses are handled as by FindCountry; answers are never cached.
+func (s *LocationService) FindNetwork(ctx context.Context, ip string) (*models.NetworkRecord, error) {
+	finder, ok := s.datastore.(datastores.NetworkFinder)
+	if !ok {
+		return nil, errors.ErrNetworksUnsupported
+	}
+
+	addr, ok := utils.ParseAddr(ip)
+	if !ok {
+		return nil, errors.ErrInvalidIP
+	}
+
+	special, isSpecial := utils.ClassifyAddr(addr)
+	if isSpecial && s.specialAddresses != SpecialAddressesLookup {
+		return nil, &NonPublicAddressError{special}
+	}
+
+	record, err := finder.FindNetwork(ctx, addr.String())
+	if isSpecial && stderrors.Is(err, errors.ErrIPNotFound) {
+		return nil, &NonPublicAddressError{special}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ListNetworks returns up to limit dataset records answering for
+// addresses in cidr, a network or a single address
+func (s *LocationService) ListNetworks(ctx context.Context, cidr string, limit int) (*models.NetworkList, error) {
+	finder, ok := s.datastore.(datastores.NetworkFinder)
+	if !ok {
+		return nil, errors.ErrNetworksUnsupported
+	}
+
+	network, err := utils.ParseNetwork(cidr)
+	if err != nil {
+		return nil, errors.ErrInvalidNetwork
+	}
+
+	records, truncated, err := finder.ListNetworks(ctx, network, limit)
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		records = []models.NetworkRecord{}
+	}
+	return &models.NetworkList{Network: network.String(), Records: records, Truncated: truncated}, nil
+}
+
+// CountryNetworks returns up to limit of the networks covering the
+// addresses located in country, and city unless it is empty, aggregated
+// into the fewest CIDR blocks. cursor is the Next of the previous page.
+// A country or city without addresses is not found.
+func (s *LocationService) CountryNetworks(ctx context.Context, country, city, cursor string, limit int) (*models.CountryNetworks, error) {
+	finder, ok := s.datastore.(datastores.CountryRangeFinder)
+	if !ok {
+		return nil, errors.ErrNetworksUnsupported
+	}
+	// An empty country would list every address
+	if country == "" {
+		return nil, errors.ErrCountryNotFound
+	}
+
+	var from netip.Addr
+	if cursor != "" {
+		if from, ok = utils.ParseAddr(cursor); !ok {
+			return nil, errors.ErrInvalidCursor
+		}
+	}
+
+	page := &models.CountryNetworks{Country: country, City: city, Networks: []string{}}
+	found, err := finder.CountryRanges(ctx, country, city, from, func(r datastores.AddrRange) bool {
+		for start := r.Start; ; {
+			if len(page.Networks) == limit {
+				page.Next = start.String()
+				return false
+			}
+			prefix := utils.FirstPrefix(start, r.End)
+			page.Networks = append(page.Networks, prefix.String())
+			last := utils.LastAddr(prefix)
+			if last == r.End {
+				return true
+			}
+			start = last.Next()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found && city != "" {
+		return nil, errors.ErrCityNotFound
+	}
+	if !found {
+		return nil, errors.ErrCountryNotFound
+	}
+	return page, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"ip_country_project/internal/datastores"
+	appErrors "ip_country_project/internal/errors"
+)
+
+// mockCountryDataStore locates the given ranges in a single country and
+// city
+type mockCountryDataStore struct {
+	mockDataStore
+	country string
+	city    string
+	ranges  []datastores.AddrRange
+}
+
+func (m *mockCountryDataStore) CountryRanges(ctx context.Context, country, city string, from netip.Addr, yield func(datastores.AddrRange) bool) (bool, error) {
+	if !strings.EqualFold(country, m.country) || (city != "" && !strings.EqualFold(city, m.city)) {
+		return false, nil
+	}
+	for _, r := range m.ranges {
+		if r.End.Less(from) {
+			continue
+		}
+		if r.Start.Less(from) {
+			r.Start = from
+		}
+		if !yield(r) {
+			break
+		}
+	}
+	return true, nil
+}
+
+func TestLocationService_CountryNetworks(t *testing.T) {
+	service := NewLocationService(&mockCountryDataStore{
+		country: "Germany",
+		city:    "Berlin",
+		ranges: []datastores.AddrRange{
+			{Start: netip.MustParseAddr("8.8.8.1"), End: netip.MustParseAddr("8.8.8.6")},
+			{Start: netip.MustParseAddr("9.0.0.0"), End: netip.MustParseAddr("9.0.0.255")},
+		},
+	})
+
+	// Pages end in the middle of a range and resume where they ended
+	var networks []string
+	cursor := ""
+	for pages := 0; pages == 0 || cursor != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("expected 2 pages, got more: %v", networks)
+		}
+		page, err := service.CountryNetworks(context.Background(), "germany", "", cursor, 3)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if page.Country != "germany" || len(page.Networks) > 3 {
+			t.Errorf("unexpected page: %+v", page)
+		}
+		networks = append(networks, page.Networks...)
+		cursor = page.Next
+	}
+	expected := "8.8.8.1/32 8.8.8.2/31 8.8.8.4/31 8.8.8.6/32 9.0.0.0/24"
+	if result := strings.Join(networks, " "); result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+
+	// A page ending with the last network has no next page
+	page, err := service.CountryNetworks(context.Background(), "Germany", "", "", 5)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(page.Networks) != 5 || page.Next != "" {
+		t.Errorf("expected all 5 networks on the last page, got %+v", page)
+	}
+
+	if _, err := service.CountryNetworks(context.Background(), "France", "", "", 5); !errors.Is(err, appErrors.ErrCountryNotFound) {
+		t.Errorf("expected ErrCountryNotFound, got: %v", err)
+	}
+	if _, err := service.CountryNetworks(context.Background(), "", "", "", 5); !errors.Is(err, appErrors.ErrCountryNotFound) {
+		t.Errorf("expected ErrCountryNotFound for an empty country, got: %v", err)
+	}
+	if _, err := service.CountryNetworks(context.Background(), "Germany", "Munich", "", 5); !errors.Is(err, appErrors.ErrCityNotFound) {
+		t.Errorf("expected ErrCityNotFound, got: %v", err)
+	}
+	if _, err := service.CountryNetworks(context.Background(), "Germany", "", "bogus", 5); !errors.Is(err, appErrors.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got: %v", err)
+	}
+	if _, err := NewLocationService(&mockDataStore{}).CountryNetworks(context.Background(), "Germany", "", "", 5); !errors.Is(err, appErrors.ErrNetworksUnsupported) {
+		t.Errorf("expected ErrNetworksUnsupported, got: %v", err)
+	}
+}
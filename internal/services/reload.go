@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ip_country_project/internal/datastores"
+	"ip_country_project/internal/errors"
+	"ip_country_project/internal/utils"
+)
+
+// ReloadService reloads the datastore on demand or when one of its files
+// changes.
+// Datastores build the new index off to the side and swap it in, so
+// lookups keep being served from the previous data while a reload runs.
+type ReloadService struct {
+	datastore datastores.DataStore
+	filePaths []string
+	onReload  []func()
+	mutex     sync.Mutex // serializes reloads
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewReloadService reloads datastore, watching filePaths if Watch is
+// called. Composite datastores pass the file of every layer.
+func NewReloadService(datastore datastores.DataStore, filePaths ...string) *ReloadService {
+	return &ReloadService{
+		datastore: datastore,
+		filePaths: filePaths,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Reload loads the datastore again. Concurrent calls run one at a time.
+func (s *ReloadService) Reload(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	start := time.Now()
+	err := s.datastore.Load(ctx)
+	switch {
+	case stderrors.Is(err, errors.ErrPartialLoad):
+		// Some composite layers published new data, so callbacks still run
+		log.Printf("Datastore partially reloaded, failed layers keep their previous data: %v", err)
+	case err != nil:
+		log.Printf("Datastore reload failed, keeping previous data: %v", err)
+		return err
+	default:
+		log.Printf("Datastore reloaded from %s in %s", strings.Join(s.filePaths, ", "), time.Since(start))
+	}
+
+	for _, fn := range s.onReload {
+		fn()
+	}
+	return err
+}
+
+// OnReload registers fn to run after every reload that published new
+// data, including a partial one, e.g. to drop cached lookups. Register callbacks before reloads can start.
+func (s *ReloadService) OnReload(fn func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onReload = append(s.onReload, fn)
+}
+
+// Watch polls the data files' modification times and sizes and reloads
+// when any of them changes. It returns immediately; call Stop to end
+// polling.
+func (s *ReloadService) Watch(interval time.Duration) {
+	last := make([]os.FileInfo, len(s.filePaths))
+	for i, path := range s.filePaths {
+		last[i], _ = os.Stat(path)
+	}
+
+	utils.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+
+			changed := false
+			for i, path := range s.filePaths {
+				current, err := os.Stat(path)
+				if err != nil {
+					// The file may be mid-replace; try again on the next tick
+					continue
+				}
+				if last[i] != nil && current.ModTime().Equal(last[i].ModTime()) && current.Size() == last[i].Size() {
+					continue
+				}
+				last[i] = current
+				changed = true
+			}
+
+			if changed {
+				_ = s.Reload(context.Background())
+			}
+		}
+	})
+}
+
+// Stop ends file watching started by Watch
+func (s *ReloadService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
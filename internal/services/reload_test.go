@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ip_country_project/internal/datastores"
+)
+
+func TestReloadService_Reload(t *testing.T) {
+	var loads atomic.Int32
+	mockDS := &mockDataStore{
+		loadFunc: func(ctx context.Context) error {
+			loads.Add(1)
+			return nil
+		},
+	}
+
+	reloads := NewReloadService(mockDS, "unused.csv")
+	if err := reloads.Reload(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loads.Load() != 1 {
+		t.Errorf("expected 1 load, got %d", loads.Load())
+	}
+}
+
+func TestReloadService_Reload_Error(t *testing.T) {
+	loadErr := errors.New("bad file")
+	mockDS := &mockDataStore{
+		loadFunc: func(ctx context.Context) error {
+			return loadErr
+		},
+	}
+
+	var invalidations int
+	reloads := NewReloadService(mockDS, "unused.csv")
+	reloads.OnReload(func() { invalidations++ })
+	if err := reloads.Reload(context.Background()); !errors.Is(err, loadErr) {
+		t.Errorf("expected load error, got: %v", err)
+	}
+	if invalidations != 0 {
+		t.Errorf("expected no callbacks after a failed reload, ran %d times", invalidations)
+	}
+}
+
+func TestReloadService_Reload_PartialComposite(t *testing.T) {
+	loadErr := errors.New("bad file")
+	good := &mockDataStore{}
+	failing := &mockDataStore{
+		loadFunc: func(ctx context.Context) error {
+			return loadErr
+		},
+	}
+	composite := datastores.NewCompositeDataStore(
+		datastores.Layer{Name: "overrides", Store: failing},
+		datastores.Layer{Name: "vendor", Store: good},
+	)
+
+	var invalidations int
+	reloads := NewReloadService(composite, "overrides.csv", "vendor.csv")
+	reloads.OnReload(func() { invalidations++ })
+
+	// The vendor layer published new data, so cached lookups must go
+	if err := reloads.Reload(context.Background()); !errors.Is(err, loadErr) {
+		t.Errorf("expected load error, got: %v", err)
+	}
+	if invalidations != 1 {
+		t.Errorf("expected callbacks to run after a partial reload, ran %d times", invalidations)
+	}
+}
+
+func TestReloadService_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte("8.8.8.8,Mountain View,United States\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	reloaded := make(chan struct{}, 1)
+	mockDS := &mockDataStore{
+		loadFunc: func(ctx context.Context) error {
+			select {
+			case reloaded <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+	}
+
+	reloads := NewReloadService(mockDS, path)
+	reloads.Watch(10 * time.Millisecond)
+	t.Cleanup(reloads.Stop)
+
+	// No change yet: nothing should reload
+	select {
+	case <-reloaded:
+		t.Fatal("reload triggered without a file change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("1.1.1.1,San Francisco,United States\n8.8.8.8,Mountain View,United States\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite file: %v", err)
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("expected reload after file change")
+	}
+}
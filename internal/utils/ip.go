@@ -1,21 +1,95 @@
 package utils
 
 import (
-	"net"
+	"fmt"
+	"net/netip"
 	"strings"
 )
 
-// NormalizeIP cleans and validates IP address input
+// NormalizeIP cleans and validates IP address input, returning the
+// canonical form of the address: lowercase, zero-compressed IPv6 and
+// IPv4-mapped addresses as plain IPv4
 func NormalizeIP(ip string) string {
-	trimmed := strings.TrimSpace(ip)
-	parsed := net.ParseIP(trimmed)
-	if parsed == nil {
+	addr, ok := ParseAddr(ip)
+	if !ok {
 		return ""
 	}
-	return parsed.String()
+	return addr.String()
 }
 
 // IsValidIP checks if the IP address is valid
 func IsValidIP(ip string) bool {
 	return NormalizeIP(ip) != ""
-}
\ No newline at end of file
+}
+
+// ParseAddr parses a single IP address, rejecting IPv6 zones. IPv4-mapped
+// IPv6 addresses such as ::ffff:8.8.8.8 are unwrapped to IPv4, so every
+// address has exactly one representation.
+func ParseAddr(ip string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ParseNetwork parses either a CIDR prefix or a single IP address.
+// Single addresses become host prefixes (/32 or /128) and host bits
+// in a CIDR are masked off. Networks inside ::ffff:0:0/96 are unwrapped
+// to the IPv4 network they map, e.g. ::ffff:8.8.8.0/120 is 8.8.8.0/24.
+func ParseNetwork(value string) (netip.Prefix, error) {
+	trimmed := strings.TrimSpace(value)
+	if strings.Contains(trimmed, "/") {
+		prefix, err := netip.ParsePrefix(trimmed)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid network %q: %w", value, err)
+		}
+		return unmapPrefix(prefix.Masked()), nil
+	}
+
+	addr, ok := ParseAddr(trimmed)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q", value)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// unmapPrefix converts an IPv4-mapped IPv6 network to IPv4. Networks
+// wider than /96 cover more than the mapped space and stay IPv6.
+func unmapPrefix(prefix netip.Prefix) netip.Prefix {
+	if !prefix.Addr().Is4In6() || prefix.Bits() < 96 {
+		return prefix
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+}
+
+// LastAddr returns the highest address covered by the prefix
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr()
+	if addr.Is4() {
+		b := addr.As4()
+		setHostBits(b[:], prefix.Bits())
+		return netip.AddrFrom4(b)
+	}
+	b := addr.As16()
+	setHostBits(b[:], prefix.Bits())
+	return netip.AddrFrom16(b)
+}
+
+func setHostBits(b []byte, bits int) {
+	for i := bits; i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+}
+
+// FirstPrefix returns the widest network starting at start that ends at or
+// before end: the first of the fewest networks covering start-end
+func FirstPrefix(start, end netip.Addr) netip.Prefix {
+	for bits := 0; bits < start.BitLen(); bits++ {
+		prefix := netip.PrefixFrom(start, bits)
+		if prefix.Masked().Addr() == start && !end.Less(LastAddr(prefix)) {
+			return prefix
+		}
+	}
+	return netip.PrefixFrom(start, start.BitLen())
+}
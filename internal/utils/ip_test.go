@@ -1,6 +1,10 @@
 package utils
 
-import "testing"
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
 
 func TestNormalizeIP(t *testing.T) {
 	// Valid cases
@@ -13,8 +17,23 @@ func TestNormalizeIP(t *testing.T) {
 		t.Errorf("expected '192.168.1.1', got '%s'", result)
 	}
 	
+	// IPv6 is lowercased and zero-compressed, IPv4-mapped addresses unwrapped
+	canonical := map[string]string{
+		"2001:DB8::1":               "2001:db8::1",
+		"2001:0db8:0000:0000::0001": "2001:db8::1",
+		"::ffff:8.8.8.8":            "8.8.8.8",
+		"::FFFF:0808:0808":          "8.8.8.8",
+		"::8.8.8.8":                 "::808:808",
+		"0:0:0:0:0:0:0:1":           "::1",
+	}
+	for input, expected := range canonical {
+		if result := NormalizeIP(input); result != expected {
+			t.Errorf("expected '%s' for '%s', got '%s'", expected, input, result)
+		}
+	}
+
 	// Invalid cases should return empty (including leading zeros which Go considers invalid)
-	invalid := []string{"", "invalid", "256.256.256.256", "192.168.1", "008.008.008.008"}
+	invalid := []string{"", "invalid", "256.256.256.256", "192.168.1", "008.008.008.008", "fe80::1%eth0"}
 	for _, ip := range invalid {
 		if result := NormalizeIP(ip); result != "" {
 			t.Errorf("expected empty for invalid IP '%s', got '%s'", ip, result)
@@ -38,4 +57,78 @@ func TestIsValidIP(t *testing.T) {
 			t.Errorf("expected '%s' to be invalid", ip)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestParseNetwork(t *testing.T) {
+	valid := map[string]string{
+		"8.8.8.8":            "8.8.8.8/32",
+		" 8.8.8.0/24 ":       "8.8.8.0/24",
+		"8.8.8.8/24":         "8.8.8.0/24",
+		"2001:db8::1":        "2001:db8::1/128",
+		"2001:db8::/32":      "2001:db8::/32",
+		"2001:DB8::/32":      "2001:db8::/32",
+		"::ffff:8.8.8.8":     "8.8.8.8/32",
+		"::ffff:8.8.8.0/120": "8.8.8.0/24",
+		"::ffff:0:0/96":      "0.0.0.0/0",
+		"::ffff:0:0/95":      "::fffe:0:0/95",
+		"::8.8.8.0/120":      "::808:800/120",
+	}
+	for input, expected := range valid {
+		prefix, err := ParseNetwork(input)
+		if err != nil {
+			t.Errorf("unexpected error for '%s': %v", input, err)
+			continue
+		}
+		if prefix.String() != expected {
+			t.Errorf("expected '%s' for '%s', got '%s'", expected, input, prefix)
+		}
+	}
+
+	invalid := []string{"", "invalid", "8.8.8.0/33", "8.8.8/24", "fe80::1%eth0"}
+	for _, input := range invalid {
+		if _, err := ParseNetwork(input); err == nil {
+			t.Errorf("expected error for '%s'", input)
+		}
+	}
+}
+
+func TestLastAddr(t *testing.T) {
+	testCases := map[string]string{
+		"8.8.8.0/24":    "8.8.8.255",
+		"10.0.0.0/8":    "10.255.255.255",
+		"1.1.1.1/32":    "1.1.1.1",
+		"0.0.0.0/0":     "255.255.255.255",
+		"2001:db8::/32": "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff",
+	}
+	for input, expected := range testCases {
+		if result := LastAddr(netip.MustParsePrefix(input)); result.String() != expected {
+			t.Errorf("expected '%s' for '%s', got '%s'", expected, input, result)
+		}
+	}
+}
+
+func TestFirstPrefix(t *testing.T) {
+	testCases := map[[2]string][]string{
+		{"8.8.8.0", "8.8.8.255"}:       {"8.8.8.0/24"},
+		{"8.8.8.0", "8.8.9.255"}:       {"8.8.8.0/23"},
+		{"8.8.8.1", "8.8.8.6"}:         {"8.8.8.1/32", "8.8.8.2/31", "8.8.8.4/31", "8.8.8.6/32"},
+		{"8.8.8.255", "8.8.9.0"}:       {"8.8.8.255/32", "8.8.9.0/32"},
+		{"0.0.0.0", "255.255.255.255"}: {"0.0.0.0/0"},
+		{"2001:db8::", "2001:db8::1"}:  {"2001:db8::/127"},
+	}
+	for input, expected := range testCases {
+		start, end := netip.MustParseAddr(input[0]), netip.MustParseAddr(input[1])
+		var result []string
+		for len(result) <= len(expected) {
+			prefix := FirstPrefix(start, end)
+			result = append(result, prefix.String())
+			if LastAddr(prefix) == end {
+				break
+			}
+			start = LastAddr(prefix).Next()
+		}
+		if strings.Join(result, " ") != strings.Join(expected, " ") {
+			t.Errorf("expected %v for %s-%s, got %v", expected, input[0], input[1], result)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import "net/netip"
+
+// AddressClass groups special-purpose addresses by why they can't be
+// located: they aren't routed on the public internet
+type AddressClass string
+
+const (
+	ClassPrivate       AddressClass = "private"
+	ClassLoopback      AddressClass = "loopback"
+	ClassLinkLocal     AddressClass = "link-local"
+	ClassCGNAT         AddressClass = "cgnat"
+	ClassMulticast     AddressClass = "multicast"
+	ClassDocumentation AddressClass = "documentation"
+	ClassReserved      AddressClass = "reserved"
+)
+
+// SpecialPurpose describes a registry entry an address falls in
+type SpecialPurpose struct {
+	Network netip.Prefix
+	Class   AddressClass
+	// Name is the entry's name in the IANA registry
+	Name string
+}
+
+// globallyReachable marks registry entries whose addresses are routed
+// on the public internet, such as anycast services carved out of a
+// reserved block. ClassifyAddr treats them as public.
+const globallyReachable AddressClass = ""
+
+// specialPurposeNetworks lists the IANA IPv4 and IPv6 special-purpose
+// address registries, plus the multicast ranges. Blocks nested in a wider
+// entry come first. Entries the registry marks globally reachable are
+// globallyReachable, as are the 6to4 and Teredo prefixes, which it leaves
+// "N/A" but whose addresses belong to hosts on the public internet.
+// IPv4-mapped IPv6 is absent: ParseAddr unwraps it to IPv4.
+var specialPurposeNetworks = []SpecialPurpose{
+	{netip.MustParsePrefix("0.0.0.0/32"), ClassReserved, "This host on this network"},
+	{netip.MustParsePrefix("0.0.0.0/8"), ClassReserved, "This network"},
+	{netip.MustParsePrefix("10.0.0.0/8"), ClassPrivate, "Private-Use"},
+	{netip.MustParsePrefix("100.64.0.0/10"), ClassCGNAT, "Shared Address Space"},
+	{netip.MustParsePrefix("127.0.0.0/8"), ClassLoopback, "Loopback"},
+	{netip.MustParsePrefix("169.254.0.0/16"), ClassLinkLocal, "Link Local"},
+	{netip.MustParsePrefix("172.16.0.0/12"), ClassPrivate, "Private-Use"},
+	{netip.MustParsePrefix("192.0.0.0/29"), ClassReserved, "IPv4 Service Continuity Prefix"},
+	{netip.MustParsePrefix("192.0.0.8/32"), ClassReserved, "IPv4 dummy address"},
+	{netip.MustParsePrefix("192.0.0.9/32"), globallyReachable, "Port Control Protocol Anycast"},
+	{netip.MustParsePrefix("192.0.0.10/32"), globallyReachable, "Traversal Using Relays around NAT Anycast"},
+	{netip.MustParsePrefix("192.0.0.170/31"), ClassReserved, "NAT64/DNS64 Discovery"},
+	{netip.MustParsePrefix("192.0.0.0/24"), ClassReserved, "IETF Protocol Assignments"},
+	{netip.MustParsePrefix("192.0.2.0/24"), ClassDocumentation, "Documentation (TEST-NET-1)"},
+	{netip.MustParsePrefix("192.31.196.0/24"), globallyReachable, "AS112-v4"},
+	{netip.MustParsePrefix("192.52.193.0/24"), globallyReachable, "AMT"},
+	{netip.MustParsePrefix("192.88.99.0/24"), ClassReserved, "Deprecated (6to4 Relay Anycast)"},
+	{netip.MustParsePrefix("192.168.0.0/16"), ClassPrivate, "Private-Use"},
+	{netip.MustParsePrefix("192.175.48.0/24"), globallyReachable, "Direct Delegation AS112 Service"},
+	{netip.MustParsePrefix("198.18.0.0/15"), ClassReserved, "Benchmarking"},
+	{netip.MustParsePrefix("198.51.100.0/24"), ClassDocumentation, "Documentation (TEST-NET-2)"},
+	{netip.MustParsePrefix("203.0.113.0/24"), ClassDocumentation, "Documentation (TEST-NET-3)"},
+	{netip.MustParsePrefix("224.0.0.0/4"), ClassMulticast, "Multicast"},
+	{netip.MustParsePrefix("255.255.255.255/32"), ClassReserved, "Limited Broadcast"},
+	{netip.MustParsePrefix("240.0.0.0/4"), ClassReserved, "Reserved"},
+
+	{netip.MustParsePrefix("::/128"), ClassReserved, "Unspecified Address"},
+	{netip.MustParsePrefix("::1/128"), ClassLoopback, "Loopback Address"},
+	{netip.MustParsePrefix("64:ff9b::/96"), globallyReachable, "IPv4-IPv6 Translat."},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), ClassReserved, "IPv4-IPv6 Translation (local use)"},
+	{netip.MustParsePrefix("100::/64"), ClassReserved, "Discard-Only Address Block"},
+	{netip.MustParsePrefix("100:0:0:1::/64"), ClassReserved, "Dummy IPv6 Prefix"},
+	{netip.MustParsePrefix("2001::/32"), globallyReachable, "TEREDO"},
+	{netip.MustParsePrefix("2001:1::1/128"), globallyReachable, "Port Control Protocol Anycast"},
+	{netip.MustParsePrefix("2001:1::2/128"), globallyReachable, "Traversal Using Relays around NAT Anycast"},
+	{netip.MustParsePrefix("2001:1::3/128"), globallyReachable, "DNS-SD Service Registration Protocol Anycast"},
+	{netip.MustParsePrefix("2001:2::/48"), ClassReserved, "Benchmarking"},
+	{netip.MustParsePrefix("2001:3::/32"), globallyReachable, "AMT"},
+	{netip.MustParsePrefix("2001:4:112::/48"), globallyReachable, "AS112-v6"},
+	{netip.MustParsePrefix("2001:10::/28"), ClassReserved, "Deprecated (previously ORCHID)"},
+	{netip.MustParsePrefix("2001:20::/28"), globallyReachable, "ORCHIDv2"},
+	{netip.MustParsePrefix("2001:30::/28"), globallyReachable, "Drone Remote ID Protocol Entity Tags (DETs) Prefix"},
+	{netip.MustParsePrefix("2001::/23"), ClassReserved, "IETF Protocol Assignments"},
+	{netip.MustParsePrefix("2001:db8::/32"), ClassDocumentation, "Documentation"},
+	{netip.MustParsePrefix("2002::/16"), globallyReachable, "6to4"},
+	{netip.MustParsePrefix("2620:4f:8000::/48"), globallyReachable, "Direct Delegation AS112 Service"},
+	{netip.MustParsePrefix("3fff::/20"), ClassDocumentation, "Documentation"},
+	{netip.MustParsePrefix("5f00::/16"), ClassReserved, "Segment Routing (SRv6) SIDs"},
+	{netip.MustParsePrefix("fc00::/7"), ClassPrivate, "Unique-Local"},
+	{netip.MustParsePrefix("fe80::/10"), ClassLinkLocal, "Link-Local Unicast"},
+	{netip.MustParsePrefix("ff00::/8"), ClassMulticast, "Multicast"},
+}
+
+// ClassifyAddr reports the special-purpose block addr belongs to, if any.
+// Addresses outside every block are public.
+func ClassifyAddr(addr netip.Addr) (SpecialPurpose, bool) {
+	addr = addr.Unmap()
+	for _, entry := range specialPurposeNetworks {
+		if !entry.Network.Contains(addr) {
+			continue
+		}
+		if entry.Class == globallyReachable {
+			break
+		}
+		return entry, true
+	}
+	return SpecialPurpose{}, false
+}
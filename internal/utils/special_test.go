@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	testCases := map[string]AddressClass{
+		"10.0.0.1":          ClassPrivate,
+		"172.31.255.255":    ClassPrivate,
+		"192.168.1.1":       ClassPrivate,
+		"127.0.0.1":         ClassLoopback,
+		"127.255.0.1":       ClassLoopback,
+		"169.254.10.20":     ClassLinkLocal,
+		"100.64.0.1":        ClassCGNAT,
+		"100.127.255.255":   ClassCGNAT,
+		"224.0.0.251":       ClassMulticast,
+		"239.255.255.250":   ClassMulticast,
+		"192.0.2.1":         ClassDocumentation,
+		"198.51.100.7":      ClassDocumentation,
+		"203.0.113.200":     ClassDocumentation,
+		"0.0.0.0":           ClassReserved,
+		"198.19.0.1":        ClassReserved,
+		"240.0.0.1":         ClassReserved,
+		"::":                ClassReserved,
+		"::1":               ClassLoopback,
+		"fd12:3456::1":      ClassPrivate,
+		"fe80::1":           ClassLinkLocal,
+		"ff02::1":           ClassMulticast,
+		"2001:db8::1":       ClassDocumentation,
+		"3fff:fff::1":       ClassDocumentation,
+		"::ffff:10.1.2.3":   ClassPrivate,
+		"::ffff:127.0.0.1":  ClassLoopback,
+		"64:ff9b:1::a00:1":  ClassReserved,
+		"2001:2::1":         ClassReserved,
+		"100::1":            ClassReserved,
+		"5f00::1":           ClassReserved,
+		"192.0.0.170":       ClassReserved,
+		"192.88.99.1":       ClassReserved,
+		"100:0:0:1::1":      ClassReserved,
+		"2001:5::1":         ClassReserved,
+		"2001:10::1":        ClassReserved,
+		"fec0::1":           "",
+		"192.0.0.9":         "",
+		"192.175.48.1":      "",
+		"2001:0:4136::1":    "",
+		"2001:1::1":         "",
+		"2001:3::1":         "",
+		"2001:4:112::1":     "",
+		"2001:20::1":        "",
+		"8.8.8.8":           "",
+		"1.1.1.1":           "",
+		"100.128.0.1":       "",
+		"172.32.0.1":        "",
+		"2001:4860::8888":   "",
+		"2606:4700::1111":   "",
+		"64:ff9b::808:808":  "",
+		"2002:c000:0204::1": "",
+	}
+
+	for ip, expected := range testCases {
+		entry, ok := ClassifyAddr(netip.MustParseAddr(ip))
+		if ok != (expected != "") || entry.Class != expected {
+			t.Errorf("expected class %q for %s, got %q (%s)", expected, ip, entry.Class, entry.Network)
+		}
+	}
+
+	// The most specific block names the address
+	entry, _ := ClassifyAddr(netip.MustParseAddr("255.255.255.255"))
+	if entry.Name != "Limited Broadcast" || entry.Network != netip.MustParsePrefix("255.255.255.255/32") {
+		t.Errorf("expected limited broadcast, got %+v", entry)
+	}
+}
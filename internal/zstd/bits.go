@@ -0,0 +1,91 @@
+package zstd
+
+import "math/bits"
+
+// forwardBitReader reads bits least-significant first from the start of a
+// buffer, as used by FSE table descriptions
+type forwardBitReader struct {
+	data   []byte
+	offset int // bit offset from the start of data
+}
+
+func (r *forwardBitReader) readBits(n int) (uint64, error) {
+	if r.offset+n > len(r.data)*8 {
+		return 0, errCorrupt("table description truncated")
+	}
+	v := readBitsLE(r.data, n, r.offset)
+	r.offset += n
+	return v, nil
+}
+
+func (r *forwardBitReader) rewind(n int) {
+	r.offset -= n
+}
+
+// bytesConsumed returns the number of whole bytes used so far
+func (r *forwardBitReader) bytesConsumed() int {
+	return (r.offset + 7) / 8
+}
+
+// reverseBitReader reads a zstd backward bitstream: bits are consumed from
+// the end of the buffer towards the start, beginning just below the
+// highest set bit of the final byte. Reading past the start yields zeros,
+// which overflowed() reports.
+type reverseBitReader struct {
+	data   []byte
+	offset int // bits remaining before the start of data
+}
+
+func newReverseBitReader(data []byte) (*reverseBitReader, error) {
+	if len(data) == 0 {
+		return nil, errCorrupt("empty bitstream")
+	}
+	last := data[len(data)-1]
+	if last == 0 {
+		return nil, errCorrupt("bitstream missing end marker")
+	}
+	padding := 8 - (bits.Len8(last) - 1)
+	return &reverseBitReader{data: data, offset: len(data)*8 - padding}, nil
+}
+
+func (r *reverseBitReader) readBits(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	r.offset -= n
+	if r.offset >= 0 {
+		return readBitsLE(r.data, n, r.offset)
+	}
+	// Partially before the start: the missing low bits are zero
+	available := n + r.offset
+	if available <= 0 {
+		return 0
+	}
+	return readBitsLE(r.data, available, 0) << uint(-r.offset)
+}
+
+// overflowed reports whether more bits were read than the stream holds
+func (r *reverseBitReader) overflowed() bool {
+	return r.offset < 0
+}
+
+// finished reports whether every bit was consumed exactly
+func (r *reverseBitReader) finished() bool {
+	return r.offset == 0
+}
+
+// readBitsLE reads n (<= 64) bits starting at bit offset, where bit i of
+// the buffer is bit i%8 of byte i/8
+func readBitsLE(data []byte, n, offset int) uint64 {
+	var v uint64
+	shift := 0
+	for n > 0 {
+		b := uint64(data[offset/8]) >> uint(offset%8)
+		take := min(8-offset%8, n)
+		v |= (b & (1<<uint(take) - 1)) << uint(shift)
+		shift += take
+		offset += take
+		n -= take
+	}
+	return v
+}
@@ -0,0 +1,161 @@
+package zstd
+
+import "math/bits"
+
+// fseTable is a finite state entropy decoding table
+type fseTable struct {
+	accuracyLog int
+	symbols     []uint8
+	numBits     []uint8
+	baseline    []uint16
+}
+
+// fseState walks an fseTable while reading a backward bitstream
+type fseState struct {
+	table *fseTable
+	state uint64
+}
+
+func (s *fseState) init(table *fseTable, r *reverseBitReader) {
+	s.table = table
+	s.state = r.readBits(table.accuracyLog)
+}
+
+func (s *fseState) symbol() uint8 {
+	return s.table.symbols[s.state]
+}
+
+func (s *fseState) update(r *reverseBitReader) {
+	n := s.table.numBits[s.state]
+	s.state = uint64(s.table.baseline[s.state]) + r.readBits(int(n))
+}
+
+// readFSETable decodes an FSE table description and returns the table and
+// the number of bytes it occupied
+func readFSETable(data []byte, maxAccuracyLog, maxSymbol int) (*fseTable, int, error) {
+	r := &forwardBitReader{data: data}
+
+	low, err := r.readBits(4)
+	if err != nil {
+		return nil, 0, err
+	}
+	accuracyLog := int(low) + 5
+	if accuracyLog > maxAccuracyLog {
+		return nil, 0, errCorrupt("FSE accuracy log too large")
+	}
+
+	var frequencies []int16
+	remaining := 1 << accuracyLog
+	for remaining > 0 && len(frequencies) <= maxSymbol {
+		n := bits.Len(uint(remaining + 1))
+		v, err := r.readBits(n)
+		if err != nil {
+			return nil, 0, err
+		}
+		lowerMask := uint64(1)<<(n-1) - 1
+		threshold := uint64(1)<<n - 1 - uint64(remaining+1)
+		if v&lowerMask < threshold {
+			r.rewind(1)
+			v &= lowerMask
+		} else if v > lowerMask {
+			v -= threshold
+		}
+
+		probability := int16(v) - 1
+		if probability < 0 {
+			remaining += int(probability)
+		} else {
+			remaining -= int(probability)
+		}
+		frequencies = append(frequencies, probability)
+
+		if probability == 0 {
+			for {
+				repeat, err := r.readBits(2)
+				if err != nil {
+					return nil, 0, err
+				}
+				for i := uint64(0); i < repeat && len(frequencies) <= maxSymbol; i++ {
+					frequencies = append(frequencies, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+	}
+	if remaining != 0 || len(frequencies) > maxSymbol+1 {
+		return nil, 0, errCorrupt("invalid FSE table description")
+	}
+
+	table, err := buildFSETable(frequencies, accuracyLog)
+	if err != nil {
+		return nil, 0, err
+	}
+	return table, r.bytesConsumed(), nil
+}
+
+// buildFSETable spreads symbols over the table per the zstd specification.
+// A frequency of -1 marks a "less than one" probability symbol.
+func buildFSETable(frequencies []int16, accuracyLog int) (*fseTable, error) {
+	size := 1 << accuracyLog
+	table := &fseTable{
+		accuracyLog: accuracyLog,
+		symbols:     make([]uint8, size),
+		numBits:     make([]uint8, size),
+		baseline:    make([]uint16, size),
+	}
+
+	next := make([]uint16, len(frequencies))
+	highThreshold := size
+	for s, f := range frequencies {
+		if f == -1 {
+			highThreshold--
+			table.symbols[highThreshold] = uint8(s)
+			next[s] = 1
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, f := range frequencies {
+		if f <= 0 {
+			continue
+		}
+		next[s] = uint16(f)
+		for i := 0; i < int(f); i++ {
+			table.symbols[pos] = uint8(s)
+			for {
+				pos = (pos + step) & mask
+				if pos < highThreshold {
+					break
+				}
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, errCorrupt("FSE table spread failed")
+	}
+
+	for i := 0; i < size; i++ {
+		s := table.symbols[i]
+		state := next[s]
+		next[s]++
+		n := accuracyLog - (bits.Len16(state) - 1)
+		table.numBits[i] = uint8(n)
+		table.baseline[i] = uint16(int(state)<<n - size)
+	}
+
+	return table, nil
+}
+
+// rleFSETable always decodes to the same symbol without reading bits
+func rleFSETable(symbol uint8) *fseTable {
+	return &fseTable{
+		accuracyLog: 0,
+		symbols:     []uint8{symbol},
+		numBits:     []uint8{0},
+		baseline:    []uint16{0},
+	}
+}
@@ -0,0 +1,202 @@
+package zstd
+
+import "math/bits"
+
+const (
+	huffmanMaxBits            = 11
+	huffmanMaxSymbols         = 256
+	huffmanWeightsAccuracyLog = 6
+	huffmanMaxWeight          = 12
+)
+
+// huffmanTable decodes literals by indexing with the next maxBits bits
+type huffmanTable struct {
+	maxBits int
+	symbols []uint8
+	numBits []uint8
+}
+
+// readHuffmanTable decodes a Huffman tree description and returns the table
+// and the number of bytes it occupied
+func readHuffmanTable(data []byte) (*huffmanTable, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errCorrupt("missing Huffman tree description")
+	}
+
+	header := int(data[0])
+	var weights []uint8
+	var used int
+
+	if header < 128 {
+		// FSE compressed weights
+		size := header
+		if 1+size > len(data) {
+			return nil, 0, errCorrupt("Huffman weights truncated")
+		}
+		var err error
+		weights, err = decodeHuffmanWeights(data[1 : 1+size])
+		if err != nil {
+			return nil, 0, err
+		}
+		used = 1 + size
+	} else {
+		// Direct representation: 4 bits per weight
+		count := header - 127
+		size := (count + 1) / 2
+		if 1+size > len(data) {
+			return nil, 0, errCorrupt("Huffman weights truncated")
+		}
+		weights = make([]uint8, count)
+		for i := 0; i < count; i++ {
+			b := data[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 0x0F
+			}
+		}
+		used = 1 + size
+	}
+
+	table, err := buildHuffmanTable(weights)
+	if err != nil {
+		return nil, 0, err
+	}
+	return table, used, nil
+}
+
+// decodeHuffmanWeights decodes FSE-compressed weights using two
+// interleaved states
+func decodeHuffmanWeights(data []byte) ([]uint8, error) {
+	table, headerSize, err := readFSETable(data, huffmanWeightsAccuracyLog, huffmanMaxWeight)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newReverseBitReader(data[headerSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	var s1, s2 fseState
+	s1.init(table, r)
+	s2.init(table, r)
+
+	weights := make([]uint8, 0, huffmanMaxSymbols)
+	for len(weights) < huffmanMaxSymbols-1 {
+		weights = append(weights, s1.symbol())
+		s1.update(r)
+		if r.overflowed() {
+			weights = append(weights, s2.symbol())
+			break
+		}
+
+		weights = append(weights, s2.symbol())
+		s2.update(r)
+		if r.overflowed() {
+			weights = append(weights, s1.symbol())
+			break
+		}
+	}
+	if len(weights) > huffmanMaxSymbols-1 {
+		return nil, errCorrupt("too many Huffman weights")
+	}
+
+	return weights, nil
+}
+
+// buildHuffmanTable completes the weights with the implied last symbol and
+// builds a direct lookup table
+func buildHuffmanTable(weights []uint8) (*huffmanTable, error) {
+	if len(weights)+1 > huffmanMaxSymbols {
+		return nil, errCorrupt("too many Huffman symbols")
+	}
+
+	var weightSum uint32
+	for _, w := range weights {
+		if w > huffmanMaxBits {
+			return nil, errCorrupt("Huffman weight too large")
+		}
+		if w > 0 {
+			weightSum += 1 << (w - 1)
+		}
+	}
+	if weightSum == 0 {
+		return nil, errCorrupt("empty Huffman weights")
+	}
+
+	maxBits := bits.Len32(weightSum)
+	remainder := uint32(1)<<maxBits - weightSum
+	if remainder&(remainder-1) != 0 {
+		return nil, errCorrupt("Huffman weights don't sum to a power of two")
+	}
+	lastWeight := uint8(bits.Len32(remainder))
+	if maxBits > huffmanMaxBits {
+		return nil, errCorrupt("Huffman code too long")
+	}
+
+	all := append(append([]uint8(nil), weights...), lastWeight)
+	numBitsFor := make([]int, len(all))
+	var rankCount [huffmanMaxBits + 2]int
+	for s, w := range all {
+		if w > 0 {
+			numBitsFor[s] = maxBits + 1 - int(w)
+			rankCount[numBitsFor[s]]++
+		}
+	}
+
+	size := 1 << maxBits
+	table := &huffmanTable{
+		maxBits: maxBits,
+		symbols: make([]uint8, size),
+		numBits: make([]uint8, size),
+	}
+
+	// Longer codes occupy the low end of the table
+	var rankIndex [huffmanMaxBits + 2]int
+	for n := maxBits; n >= 1; n-- {
+		rankIndex[n-1] = rankIndex[n] + rankCount[n]*(1<<(maxBits-n))
+		for i := rankIndex[n]; i < rankIndex[n-1]; i++ {
+			table.numBits[i] = uint8(n)
+		}
+	}
+	if rankIndex[0] != size {
+		return nil, errCorrupt("invalid Huffman code lengths")
+	}
+
+	for s, n := range numBitsFor {
+		if n == 0 {
+			continue
+		}
+		code := rankIndex[n]
+		length := 1 << (maxBits - n)
+		for i := code; i < code+length; i++ {
+			table.symbols[i] = uint8(s)
+		}
+		rankIndex[n] += length
+	}
+
+	return table, nil
+}
+
+// decodeStream decodes exactly len(out) symbols from one Huffman bitstream
+func (t *huffmanTable) decodeStream(data []byte, out []byte) error {
+	r, err := newReverseBitReader(data)
+	if err != nil {
+		return err
+	}
+
+	mask := uint64(1)<<t.maxBits - 1
+	state := r.readBits(t.maxBits)
+	for i := range out {
+		out[i] = t.symbols[state]
+		n := int(t.numBits[state])
+		state = (state<<uint(n) + r.readBits(n)) & mask
+	}
+
+	// The final state holds maxBits of lookahead that were never needed
+	if r.offset != -t.maxBits {
+		return errCorrupt("Huffman stream size mismatch")
+	}
+	return nil
+}
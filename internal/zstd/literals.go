@@ -0,0 +1,149 @@
+package zstd
+
+// Literals_Block_Type values
+const (
+	literalsRaw        = 0
+	literalsRLE        = 1
+	literalsCompressed = 2
+	literalsTreeless   = 3
+)
+
+// decodeLiterals decodes a block's literals section and returns the
+// literals and the number of bytes the section occupied
+func (d *decoder) decodeLiterals(block []byte) ([]byte, int, error) {
+	if len(block) == 0 {
+		return nil, 0, errCorrupt("missing literals section")
+	}
+
+	blockType := block[0] & 0x3
+	sizeFormat := (block[0] >> 2) & 0x3
+
+	if blockType == literalsRaw || blockType == literalsRLE {
+		var size, headerSize int
+		switch sizeFormat {
+		case 0, 2:
+			size, headerSize = int(block[0]>>3), 1
+		case 1:
+			if len(block) < 2 {
+				return nil, 0, errCorrupt("literals header truncated")
+			}
+			size, headerSize = int(block[0]>>4)+int(block[1])<<4, 2
+		case 3:
+			if len(block) < 3 {
+				return nil, 0, errCorrupt("literals header truncated")
+			}
+			size, headerSize = int(block[0]>>4)+int(block[1])<<4+int(block[2])<<12, 3
+		}
+		if size > maxBlockSize {
+			return nil, 0, errCorrupt("literals too large")
+		}
+
+		if blockType == literalsRaw {
+			if headerSize+size > len(block) {
+				return nil, 0, errCorrupt("raw literals truncated")
+			}
+			return block[headerSize : headerSize+size], headerSize + size, nil
+		}
+
+		if headerSize >= len(block) {
+			return nil, 0, errCorrupt("RLE literals truncated")
+		}
+		literals := d.literalsBuffer(size)
+		for i := range literals {
+			literals[i] = block[headerSize]
+		}
+		return literals, headerSize + 1, nil
+	}
+
+	// Compressed or treeless literals
+	var headerSize, sizeBits int
+	streams := 4
+	switch sizeFormat {
+	case 0:
+		headerSize, sizeBits, streams = 3, 10, 1
+	case 1:
+		headerSize, sizeBits = 3, 10
+	case 2:
+		headerSize, sizeBits = 4, 14
+	case 3:
+		headerSize, sizeBits = 5, 18
+	}
+	if len(block) < headerSize {
+		return nil, 0, errCorrupt("literals header truncated")
+	}
+
+	var header uint64
+	for i := headerSize - 1; i >= 0; i-- {
+		header = header<<8 | uint64(block[i])
+	}
+	mask := uint64(1)<<sizeBits - 1
+	regenerated := int((header >> 4) & mask)
+	compressed := int((header >> (4 + sizeBits)) & mask)
+
+	if regenerated > maxBlockSize {
+		return nil, 0, errCorrupt("literals too large")
+	}
+	if headerSize+compressed > len(block) {
+		return nil, 0, errCorrupt("compressed literals truncated")
+	}
+	data := block[headerSize : headerSize+compressed]
+
+	if blockType == literalsCompressed {
+		table, used, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		d.huffman = table
+		data = data[used:]
+	} else if d.huffman == nil {
+		return nil, 0, errCorrupt("treeless literals without a previous Huffman table")
+	}
+
+	literals := d.literalsBuffer(regenerated)
+	if streams == 1 {
+		if err := d.huffman.decodeStream(data, literals); err != nil {
+			return nil, 0, err
+		}
+		return literals, headerSize + compressed, nil
+	}
+
+	if len(data) < 6 {
+		return nil, 0, errCorrupt("literals jump table truncated")
+	}
+	sizes := [4]int{
+		int(data[0]) | int(data[1])<<8,
+		int(data[2]) | int(data[3])<<8,
+		int(data[4]) | int(data[5])<<8,
+	}
+	data = data[6:]
+	sizes[3] = len(data) - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 1 {
+		return nil, 0, errCorrupt("invalid literals jump table")
+	}
+
+	segment := (regenerated + 3) / 4
+	out := literals
+	for i := 0; i < 4; i++ {
+		n := segment
+		if i == 3 {
+			n = len(out)
+		}
+		if n > len(out) {
+			return nil, 0, errCorrupt("literals stream sizes exceed regenerated size")
+		}
+		if err := d.huffman.decodeStream(data[:sizes[i]], out[:n]); err != nil {
+			return nil, 0, err
+		}
+		data = data[sizes[i]:]
+		out = out[n:]
+	}
+
+	return literals, headerSize + compressed, nil
+}
+
+func (d *decoder) literalsBuffer(size int) []byte {
+	if cap(d.literals) < size {
+		d.literals = make([]byte, size)
+	}
+	return d.literals[:size]
+}
@@ -0,0 +1,251 @@
+package zstd
+
+// Symbol compression modes for sequence tables
+const (
+	modePredefined = 0
+	modeRLE        = 1
+	modeCompressed = 2
+	modeRepeat     = 3
+)
+
+const (
+	maxLiteralsLengthCode = 35
+	maxMatchLengthCode    = 52
+	maxOffsetCode         = 31
+
+	maxLiteralsLengthLog = 9
+	maxMatchLengthLog    = 9
+	maxOffsetLog         = 8
+)
+
+var (
+	literalsLengthDefault = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	matchLengthDefault = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	offsetDefault = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+
+	literalsLengthBaseline = [maxLiteralsLengthCode + 1]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	literalsLengthBits = [maxLiteralsLengthCode + 1]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	matchLengthBaseline = [maxMatchLengthCode + 1]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	matchLengthBits = [maxMatchLengthCode + 1]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+
+	predefinedLiteralsLength = mustBuildFSETable(literalsLengthDefault, 6)
+	predefinedMatchLength    = mustBuildFSETable(matchLengthDefault, 6)
+	predefinedOffset         = mustBuildFSETable(offsetDefault, 5)
+)
+
+func mustBuildFSETable(frequencies []int16, accuracyLog int) *fseTable {
+	table, err := buildFSETable(frequencies, accuracyLog)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// decodeSequences decodes a block's sequences section and executes it
+// against the literals, appending the regenerated bytes to the window
+func (d *decoder) decodeSequences(data []byte, literals []byte) error {
+	if len(data) == 0 {
+		return errCorrupt("missing sequences section")
+	}
+
+	start := len(d.window)
+	count := int(data[0])
+	switch {
+	case count == 0:
+		d.window = append(d.window, literals...)
+		return nil
+	case count < 128:
+		data = data[1:]
+	case count < 255:
+		if len(data) < 2 {
+			return errCorrupt("sequence count truncated")
+		}
+		count = (count-128)<<8 + int(data[1])
+		data = data[2:]
+	default:
+		if len(data) < 3 {
+			return errCorrupt("sequence count truncated")
+		}
+		count = int(data[1]) + int(data[2])<<8 + 0x7F00
+		data = data[3:]
+	}
+
+	if len(data) == 0 {
+		return errCorrupt("missing symbol compression modes")
+	}
+	modes := data[0]
+	data = data[1:]
+	if modes&0x3 != 0 {
+		return errCorrupt("reserved bits set in symbol compression modes")
+	}
+
+	var err error
+	var used int
+	if d.literalsLengthTable, used, err = selectTable(data, modes>>6, d.literalsLengthTable,
+		predefinedLiteralsLength, maxLiteralsLengthLog, maxLiteralsLengthCode); err != nil {
+		return err
+	}
+	data = data[used:]
+	if d.offsetTable, used, err = selectTable(data, (modes>>4)&0x3, d.offsetTable,
+		predefinedOffset, maxOffsetLog, maxOffsetCode); err != nil {
+		return err
+	}
+	data = data[used:]
+	if d.matchLengthTable, used, err = selectTable(data, (modes>>2)&0x3, d.matchLengthTable,
+		predefinedMatchLength, maxMatchLengthLog, maxMatchLengthCode); err != nil {
+		return err
+	}
+	data = data[used:]
+
+	r, err := newReverseBitReader(data)
+	if err != nil {
+		return err
+	}
+
+	var literalsLength, offset, matchLength fseState
+	literalsLength.init(d.literalsLengthTable, r)
+	offset.init(d.offsetTable, r)
+	matchLength.init(d.matchLengthTable, r)
+
+	for i := 0; i < count; i++ {
+		offsetCode := offset.symbol()
+		matchCode := matchLength.symbol()
+		literalsCode := literalsLength.symbol()
+		if offsetCode > maxOffsetCode || matchCode > maxMatchLengthCode || literalsCode > maxLiteralsLengthCode {
+			return errCorrupt("sequence code out of range")
+		}
+
+		offsetValue := uint64(1)<<offsetCode + r.readBits(int(offsetCode))
+		ml := matchLengthBaseline[matchCode] + uint32(r.readBits(int(matchLengthBits[matchCode])))
+		ll := literalsLengthBaseline[literalsCode] + uint32(r.readBits(int(literalsLengthBits[literalsCode])))
+
+		if i < count-1 {
+			literalsLength.update(r)
+			matchLength.update(r)
+			offset.update(r)
+		}
+		if r.overflowed() {
+			return errCorrupt("sequences bitstream overread")
+		}
+
+		if int(ll) > len(literals) {
+			return errCorrupt("literals length exceeds literals")
+		}
+		// Checked per sequence so a short block can't regenerate gigabytes
+		// before the block size check in nextBlock sees it
+		if len(d.window)-start+int(ll)+int(ml) > maxBlockSize {
+			return errCorrupt("block output too large")
+		}
+		d.window = append(d.window, literals[:ll]...)
+		literals = literals[ll:]
+
+		distance := d.resolveOffset(offsetValue, ll)
+		if err := d.copyMatch(distance, int(ml)); err != nil {
+			return err
+		}
+	}
+
+	if !r.finished() {
+		return errCorrupt("sequences bitstream not fully consumed")
+	}
+
+	d.window = append(d.window, literals...)
+	return nil
+}
+
+// selectTable returns the FSE table for a compression mode and the number
+// of bytes read from data
+func selectTable(data []byte, mode byte, previous, predefined *fseTable, maxLog, maxSymbol int) (*fseTable, int, error) {
+	switch mode {
+	case modePredefined:
+		return predefined, 0, nil
+	case modeRLE:
+		if len(data) == 0 {
+			return nil, 0, errCorrupt("RLE table truncated")
+		}
+		if int(data[0]) > maxSymbol {
+			return nil, 0, errCorrupt("RLE symbol out of range")
+		}
+		return rleFSETable(data[0]), 1, nil
+	case modeCompressed:
+		return readFSETable(data, maxLog, maxSymbol)
+	default:
+		if previous == nil {
+			return nil, 0, errCorrupt("repeat table mode without a previous table")
+		}
+		return previous, 0, nil
+	}
+}
+
+// resolveOffset applies the repeat offset rules to an Offset_Value
+func (d *decoder) resolveOffset(offsetValue uint64, literalsLength uint32) uint64 {
+	if offsetValue > 3 {
+		offset := offsetValue - 3
+		d.repeats[2], d.repeats[1], d.repeats[0] = d.repeats[1], d.repeats[0], offset
+		return offset
+	}
+
+	index := offsetValue - 1
+	if literalsLength == 0 {
+		index++
+	}
+	if index == 0 {
+		return d.repeats[0]
+	}
+
+	var offset uint64
+	if index < 3 {
+		offset = d.repeats[index]
+	} else {
+		offset = d.repeats[0] - 1
+	}
+	if index > 1 {
+		d.repeats[2] = d.repeats[1]
+	}
+	d.repeats[1] = d.repeats[0]
+	d.repeats[0] = offset
+	return offset
+}
+
+// copyMatch appends length bytes copied from distance bytes back. The
+// source may overlap the bytes being written.
+func (d *decoder) copyMatch(distance uint64, length int) error {
+	if distance == 0 || distance > uint64(len(d.window)) || distance > d.windowSize {
+		return errCorrupt("match offset outside window")
+	}
+	start := len(d.window) - int(distance)
+	for i := 0; i < length; i++ {
+		d.window = append(d.window, d.window[start+i])
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime64v1 uint64 = 11400714785074694791
+	prime64v2 uint64 = 14029467366897019727
+	prime64v3 uint64 = 1609587929392839161
+	prime64v4 uint64 = 9650029242287828579
+	prime64v5 uint64 = 2870177450012600261
+)
+
+// xxhash64 is a streaming XXH64 digest with a zero seed, used for frame
+// content checksums
+type xxhash64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int
+}
+
+func (h *xxhash64) reset() {
+	// Seed arithmetic wraps, so it has to happen on variables rather
+	// than untyped constants
+	p1, p2 := prime64v1, prime64v2
+	*h = xxhash64{
+		v1: p1 + p2,
+		v2: p2,
+		v3: 0,
+		v4: -p1,
+	}
+}
+
+func (h *xxhash64) Write(p []byte) {
+	h.total += uint64(len(p))
+
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], p)
+		h.n += c
+		p = p[c:]
+		if h.n < len(h.buf) {
+			return
+		}
+		h.consume(h.buf[:])
+		h.n = 0
+	}
+
+	for len(p) >= 32 {
+		h.consume(p[:32])
+		p = p[32:]
+	}
+	h.n = copy(h.buf[:], p)
+}
+
+func (h *xxhash64) consume(b []byte) {
+	h.v1 = xxhashRound(h.v1, binary.LittleEndian.Uint64(b[0:]))
+	h.v2 = xxhashRound(h.v2, binary.LittleEndian.Uint64(b[8:]))
+	h.v3 = xxhashRound(h.v3, binary.LittleEndian.Uint64(b[16:]))
+	h.v4 = xxhashRound(h.v4, binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (h *xxhash64) Sum64() uint64 {
+	var sum uint64
+	if h.total >= 32 {
+		sum = bits.RotateLeft64(h.v1, 1) + bits.RotateLeft64(h.v2, 7) +
+			bits.RotateLeft64(h.v3, 12) + bits.RotateLeft64(h.v4, 18)
+		sum = xxhashMerge(sum, h.v1)
+		sum = xxhashMerge(sum, h.v2)
+		sum = xxhashMerge(sum, h.v3)
+		sum = xxhashMerge(sum, h.v4)
+	} else {
+		sum = h.v3 + prime64v5
+	}
+	sum += h.total
+
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		sum ^= xxhashRound(0, binary.LittleEndian.Uint64(b))
+		sum = bits.RotateLeft64(sum, 27)*prime64v1 + prime64v4
+	}
+	if len(b) >= 4 {
+		sum ^= uint64(binary.LittleEndian.Uint32(b)) * prime64v1
+		sum = bits.RotateLeft64(sum, 23)*prime64v2 + prime64v3
+		b = b[4:]
+	}
+	for _, c := range b {
+		sum ^= uint64(c) * prime64v5
+		sum = bits.RotateLeft64(sum, 11) * prime64v1
+	}
+
+	sum ^= sum >> 33
+	sum *= prime64v2
+	sum ^= sum >> 29
+	sum *= prime64v3
+	sum ^= sum >> 32
+	return sum
+}
+
+func xxhashRound(acc, input uint64) uint64 {
+	acc += input * prime64v2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime64v1
+}
+
+func xxhashMerge(acc, val uint64) uint64 {
+	acc ^= xxhashRound(0, val)
+	return acc*prime64v1 + prime64v4
+}
@@ -0,0 +1,338 @@
+// Package zstd implements a decompressor for the Zstandard format
+// (RFC 8878). Only decoding is supported, and frames that require a
+// dictionary are rejected.
+package zstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	frameMagic         = 0xFD2FB528
+	skippableMagicMask = 0xFFFFFFF0
+	skippableMagic     = 0x184D2A50
+
+	maxBlockSize = 128 << 10
+
+	// maxWindowSize bounds the history kept in memory, matching the
+	// reference decoder's default limit
+	maxWindowSize = 1 << 27
+)
+
+// Block_Type values
+const (
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+)
+
+// ErrCorrupt is wrapped by every error caused by malformed input
+var ErrCorrupt = errors.New("zstd: corrupt input")
+
+// ErrUnsupported is wrapped by errors for valid frames this decoder
+// refuses: frames needing a dictionary or a window over maxWindowSize
+var ErrUnsupported = errors.New("zstd: unsupported frame")
+
+func errCorrupt(msg string) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, msg)
+}
+
+// decoder holds the state shared by the blocks of one frame
+type decoder struct {
+	window     []byte
+	windowSize uint64
+	repeats    [3]uint64
+	literals   []byte
+
+	huffman             *huffmanTable
+	literalsLengthTable *fseTable
+	offsetTable         *fseTable
+	matchLengthTable    *fseTable
+}
+
+func (d *decoder) reset(windowSize uint64) {
+	*d = decoder{
+		window:     d.window[:0],
+		windowSize: windowSize,
+		repeats:    [3]uint64{1, 4, 8},
+		literals:   d.literals,
+	}
+}
+
+// Reader decompresses a stream of concatenated zstd frames
+type Reader struct {
+	r   *bufio.Reader
+	d   decoder
+	err error
+
+	pending []byte // decoded bytes not yet returned by Read
+	inFrame bool
+	last    bool // the current frame's last block was decoded
+	frames  int
+
+	checksum    bool
+	contentSize int64 // -1 when the frame header omits it
+	produced    int64
+	hash        xxhash64
+}
+
+// NewReader returns a Reader that decompresses r. The first frame header
+// is read immediately so that input which isn't zstd fails early.
+func NewReader(r io.Reader) (*Reader, error) {
+	z := &Reader{r: bufio.NewReader(r)}
+	if err := z.nextFrame(); err != nil {
+		// Input made only of skippable frames decodes to nothing
+		if err == io.EOF {
+			z.err = err
+			return z, nil
+		}
+		return nil, err
+	}
+	return z, nil
+}
+
+// Read implements io.Reader
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.pending) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.advance()
+	}
+
+	n := copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return n, nil
+}
+
+// advance decodes the next block, finishing and starting frames as needed
+func (z *Reader) advance() error {
+	if !z.inFrame {
+		return z.nextFrame()
+	}
+	if z.last {
+		return z.finishFrame()
+	}
+	return z.nextBlock()
+}
+
+// nextFrame reads frame headers, skipping skippable frames. It returns
+// io.EOF once the input ends cleanly between frames.
+func (z *Reader) nextFrame() error {
+	for {
+		var magicBytes [4]byte
+		if _, err := io.ReadFull(z.r, magicBytes[:]); err != nil {
+			if err == io.EOF && z.frames > 0 {
+				return io.EOF
+			}
+			return unexpected(err)
+		}
+		magic := binary.LittleEndian.Uint32(magicBytes[:])
+
+		if magic&skippableMagicMask == skippableMagic {
+			var sizeBytes [4]byte
+			if _, err := io.ReadFull(z.r, sizeBytes[:]); err != nil {
+				return unexpected(err)
+			}
+			size := int64(binary.LittleEndian.Uint32(sizeBytes[:]))
+			if _, err := io.CopyN(io.Discard, z.r, size); err != nil {
+				return unexpected(err)
+			}
+			z.frames++
+			continue
+		}
+		if magic != frameMagic {
+			return errCorrupt("invalid magic number")
+		}
+
+		if err := z.readFrameHeader(); err != nil {
+			return err
+		}
+		z.frames++
+		return nil
+	}
+}
+
+func (z *Reader) readFrameHeader() error {
+	descriptor, err := z.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	if descriptor&0x08 != 0 {
+		return errCorrupt("reserved bit set in frame header")
+	}
+
+	contentSizeFlag := descriptor >> 6
+	singleSegment := descriptor&0x20 != 0
+	z.checksum = descriptor&0x04 != 0
+	dictionaryIDSize := [4]int{0, 1, 2, 4}[descriptor&0x3]
+
+	var windowSize uint64
+	if !singleSegment {
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		windowLog := 10 + uint(b>>3)
+		base := uint64(1) << windowLog
+		windowSize = base + (base/8)*uint64(b&0x7)
+	}
+
+	if dictionaryIDSize > 0 {
+		id, err := z.readLittleEndian(dictionaryIDSize)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			return fmt.Errorf("%w: dictionary %d required but dictionaries are not supported", ErrUnsupported, id)
+		}
+	}
+
+	contentSizeBytes := [4]int{0, 2, 4, 8}[contentSizeFlag]
+	if contentSizeFlag == 0 && singleSegment {
+		contentSizeBytes = 1
+	}
+	z.contentSize = -1
+	if contentSizeBytes > 0 {
+		size, err := z.readLittleEndian(contentSizeBytes)
+		if err != nil {
+			return err
+		}
+		if contentSizeBytes == 2 {
+			size += 256
+		}
+		z.contentSize = int64(size)
+	}
+
+	if singleSegment {
+		windowSize = uint64(z.contentSize)
+	}
+	if windowSize > maxWindowSize {
+		return fmt.Errorf("%w: window size %d exceeds the supported maximum of %d", ErrUnsupported, windowSize, maxWindowSize)
+	}
+
+	z.d.reset(windowSize)
+	z.hash.reset()
+	z.produced = 0
+	z.inFrame = true
+	z.last = false
+	return nil
+}
+
+// nextBlock decodes one block and queues its output
+func (z *Reader) nextBlock() error {
+	header, err := z.readLittleEndian(3)
+	if err != nil {
+		return err
+	}
+	z.last = header&0x1 != 0
+	blockType := (header >> 1) & 0x3
+	size := int(header >> 3)
+
+	if size > maxBlockSize || (blockType != blockRLE && uint64(size) > z.d.windowSize && z.d.windowSize < maxBlockSize) {
+		return errCorrupt("block too large")
+	}
+
+	z.trimWindow()
+	start := len(z.d.window)
+
+	switch blockType {
+	case blockRaw:
+		z.d.window = append(z.d.window, make([]byte, size)...)
+		if _, err := io.ReadFull(z.r, z.d.window[start:]); err != nil {
+			return unexpected(err)
+		}
+	case blockRLE:
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		for i := 0; i < size; i++ {
+			z.d.window = append(z.d.window, b)
+		}
+	case blockCompressed:
+		block := make([]byte, size)
+		if _, err := io.ReadFull(z.r, block); err != nil {
+			return unexpected(err)
+		}
+		if err := z.d.decodeBlock(block); err != nil {
+			return err
+		}
+	default:
+		return errCorrupt("reserved block type")
+	}
+
+	output := z.d.window[start:]
+	if len(output) > maxBlockSize {
+		return errCorrupt("block output too large")
+	}
+	z.produced += int64(len(output))
+	if z.contentSize >= 0 && z.produced > z.contentSize {
+		return errCorrupt("frame larger than its declared content size")
+	}
+	if z.checksum {
+		z.hash.Write(output)
+	}
+	z.pending = output
+	return nil
+}
+
+// finishFrame checks the declared size and checksum of a completed frame
+func (z *Reader) finishFrame() error {
+	z.inFrame = false
+	if z.contentSize >= 0 && z.produced != z.contentSize {
+		return errCorrupt("frame smaller than its declared content size")
+	}
+	if z.checksum {
+		var sum [4]byte
+		if _, err := io.ReadFull(z.r, sum[:]); err != nil {
+			return unexpected(err)
+		}
+		if binary.LittleEndian.Uint32(sum[:]) != uint32(z.hash.Sum64()) {
+			return errCorrupt("checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// trimWindow drops history the next block can no longer reference. It
+// only compacts once the buffer is twice the window, keeping copies rare.
+func (z *Reader) trimWindow() {
+	keep := int(z.d.windowSize)
+	if len(z.d.window) < 2*keep+maxBlockSize {
+		return
+	}
+	n := copy(z.d.window, z.d.window[len(z.d.window)-keep:])
+	z.d.window = z.d.window[:n]
+}
+
+func (z *Reader) readLittleEndian(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(z.r, buf[:size]); err != nil {
+		return 0, unexpected(err)
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// decodeBlock decodes a compressed block, appending its output to the
+// window
+func (d *decoder) decodeBlock(block []byte) error {
+	literals, used, err := d.decodeLiterals(block)
+	if err != nil {
+		return err
+	}
+	return d.decodeSequences(block[used:], literals)
+}
+
+// unexpected converts a clean EOF in the middle of a frame into
+// io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
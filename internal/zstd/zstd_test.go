@@ -0,0 +1,270 @@
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testCities = []string{"Tel Aviv", "Haifa", "New York", "London", "Paris", "Berlin", "Tokyo", "Sydney"}
+var testCountries = []string{"Israel", "United States", "United Kingdom", "France", "Germany", "Japan", "Australia"}
+
+// testCSV regenerates the input the *.csv.zst fixtures were compressed
+// from, so the uncompressed copy doesn't need to live in testdata
+func testCSV() []byte {
+	var b bytes.Buffer
+	seed := uint32(1)
+	next := func(n int) int {
+		seed = seed*1664525 + 1013904223
+		return int(seed>>8) % n
+	}
+	for b.Len() < 160<<10 {
+		fmt.Fprintf(&b, "%d.%d.%d.0/24,%s,%s\n", next(223)+1, next(256), next(256),
+			testCities[next(len(testCities))], testCountries[next(len(testCountries))])
+	}
+	return b.Bytes()
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return data
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestReader_Fixtures(t *testing.T) {
+	csv := testCSV()
+	fixtures := map[string][]byte{
+		// Compressed sequences, multiple blocks, content checksum
+		"level3.csv.zst": csv,
+		// 1KB window: matches must stay within trimmed history
+		"level19-window1k.csv.zst": csv,
+		// Piped input: no content size, no checksum
+		"stream.csv.zst": csv,
+		"repeat.txt.zst": bytes.Repeat([]byte("abc\n"), 75000),
+		"short.txt.zst":  []byte("hello, world\n"),
+		"empty.zst":      {},
+	}
+
+	for name, expected := range fixtures {
+		got, err := decompress(readFixture(t, name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, expected) {
+			t.Errorf("%s: decompressed %d bytes that don't match the expected %d", name, len(got), len(expected))
+		}
+	}
+}
+
+func TestReader_MultipleAndSkippableFrames(t *testing.T) {
+	skippable := []byte{0x5A, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 'x', 'y', 'z'}
+
+	var input []byte
+	input = append(input, skippable...)
+	input = append(input, readFixture(t, "short.txt.zst")...)
+	input = append(input, skippable...)
+	input = append(input, readFixture(t, "repeat.txt.zst")...)
+
+	got, err := decompress(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := append([]byte("hello, world\n"), bytes.Repeat([]byte("abc\n"), 75000)...)
+	if !bytes.Equal(got, expected) {
+		t.Errorf("expected %d bytes across frames, got %d", len(expected), len(got))
+	}
+
+	got, err = decompress(skippable)
+	if err != nil || len(got) != 0 {
+		t.Errorf("expected no output and no error for only a skippable frame, got %d bytes and %v", len(got), err)
+	}
+}
+
+func TestReader_SmallReads(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(readFixture(t, "level3.csv.zst")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got bytes.Buffer
+	buf := make([]byte, 7)
+	for {
+		n, err := r.Read(buf)
+		got.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if !bytes.Equal(got.Bytes(), testCSV()) {
+		t.Error("expected output to match when read in small chunks")
+	}
+}
+
+func TestReader_NotZstd(t *testing.T) {
+	for _, input := range [][]byte{[]byte("1.2.3.4,City,Country\n"), {0x1f, 0x8b, 0x08, 0x00}} {
+		if _, err := NewReader(bytes.NewReader(input)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("expected ErrCorrupt for %q, got %v", input, err)
+		}
+	}
+
+	if _, err := NewReader(bytes.NewReader(nil)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for empty input, got %v", err)
+	}
+}
+
+func TestReader_ChecksumMismatch(t *testing.T) {
+	data := readFixture(t, "short.txt.zst")
+	// The frame is a single raw block, so this flips a content byte
+	data[bytes.Index(data, []byte("hello"))] = 'j'
+
+	if _, err := decompress(data); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestReader_Truncated(t *testing.T) {
+	data := readFixture(t, "level3.csv.zst")
+
+	for _, size := range []int{5, 100, len(data) / 2, len(data) - 1} {
+		_, err := decompress(data[:size])
+		if err == nil {
+			t.Errorf("expected error for input truncated to %d bytes", size)
+		}
+	}
+}
+
+func TestReader_Unsupported(t *testing.T) {
+	inputs := map[string][]byte{
+		// Window_Descriptor with a 2 GiB window
+		"window": {0x28, 0xB5, 0x2F, 0xFD, 0x00, 0xA8},
+		// Single segment frame declaring 4 GiB of content
+		"content size": {0x28, 0xB5, 0x2F, 0xFD, 0xE0, 0, 0, 0, 0, 1, 0, 0, 0},
+		"dictionary":   {0x28, 0xB5, 0x2F, 0xFD, 0x01, 0x00, 0x05},
+	}
+	for name, input := range inputs {
+		if _, err := NewReader(bytes.NewReader(input)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, got %v", name, err)
+		}
+	}
+}
+
+// fuzzMaxOutput bounds the output read per fuzz input; a few bytes of RLE
+// blocks legitimately expand to far more than is worth checking
+const fuzzMaxOutput = 1 << 20
+
+func FuzzReader(f *testing.F) {
+	// The 40KB CSV fixtures stall the coverage-guided mutator, so only the
+	// small ones seed it; TestReader_Fixtures covers the large ones
+	for _, name := range []string{"repeat.txt.zst", "short.txt.zst", "empty.zst"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			f.Fatalf("failed to read fixture: %v", err)
+		}
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+		flipped := bytes.Clone(data)
+		flipped[len(flipped)/3] ^= 0x55
+		f.Add(flipped)
+	}
+	f.Add([]byte{0x28, 0xB5, 0x2F, 0xFD, 0x00, 0xA8})
+	f.Add([]byte{0x28, 0xB5, 0x2F, 0xFD, 0x01, 0x00, 0x05})
+	// Skippable frame claiming more bytes than follow
+	f.Add([]byte{0x5A, 0x2A, 0x4D, 0x18, 0xFF, 0xFF, 0xFF, 0xFF, 'x'})
+	// RLE block of the maximum size
+	f.Add([]byte{0x28, 0xB5, 0x2F, 0xFD, 0x00, 0x00, 0x03, 0x00, 0x10, 'a'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			checkFuzzError(t, err)
+			return
+		}
+
+		buf := make([]byte, 32<<10)
+		total := 0
+		for total < fuzzMaxOutput {
+			n, err := r.Read(buf)
+			total += n
+			if n < 0 || n > len(buf) {
+				t.Fatalf("Read returned %d for a %d byte buffer", n, len(buf))
+			}
+			// History stays within the window the frame declared
+			if r.d.windowSize > maxWindowSize || len(r.d.window) > 2*int(r.d.windowSize)+2*maxBlockSize {
+				t.Fatalf("window holds %d bytes for a window size of %d", len(r.d.window), r.d.windowSize)
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				checkFuzzError(t, err)
+				// Errors are sticky
+				if _, again := r.Read(buf); again != err {
+					t.Fatalf("expected the error %v again, got %v", err, again)
+				}
+				return
+			}
+			if n == 0 {
+				t.Fatal("Read returned neither data nor an error")
+			}
+		}
+	})
+}
+
+// checkFuzzError fails unless err is one the decoder documents for bad
+// input
+func checkFuzzError(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrUnsupported) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error type: %v", err)
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	known := map[string]uint64{
+		"":    0xEF46DB3751D8E999,
+		"abc": 0x44BC2CF5AD770999,
+	}
+	for input, expected := range known {
+		var h xxhash64
+		h.reset()
+		h.Write([]byte(input))
+		if sum := h.Sum64(); sum != expected {
+			t.Errorf("expected %#x for %q, got %#x", expected, input, sum)
+		}
+	}
+
+	// Streaming in uneven pieces must match a single write
+	data := testCSV()
+	var whole, pieces xxhash64
+	whole.reset()
+	pieces.reset()
+	whole.Write(data)
+	for i := 0; i < len(data); i += 13 {
+		pieces.Write(data[i:min(i+13, len(data))])
+	}
+	if whole.Sum64() != pieces.Sum64() {
+		t.Error("expected streamed digest to match single write")
+	}
+}
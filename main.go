@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -23,9 +25,29 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "compile":
+			runCompile(cfg, os.Args[2:])
+			return
+		case "redis-import":
+			runRedisImport(cfg, os.Args[2:])
+			return
+		}
+	}
+
 	fmt.Printf("IP Country Service starting on %s:%s\n", cfg.Host, cfg.Port)
 	fmt.Printf("Rate limit: %.1f RPS\n", cfg.RateLimitRPS)
-	fmt.Printf("Datastore: %s (%s)\n", cfg.DatastoreType, cfg.DatastoreFile)
+	switch cfg.DatastoreType {
+	case "composite":
+		for i, layer := range cfg.DatastoreLayers {
+			fmt.Printf("Datastore layer %d: %s = %s (%s)\n", i+1, layer.Name, layer.Type, dataLocation(layer.Type, layer.File))
+		}
+	case "http", "redis":
+		fmt.Printf("Datastore: %s (%s)\n", cfg.DatastoreType, dataLocation(cfg.DatastoreType, cfg.DatastoreURL))
+	default:
+		fmt.Printf("Datastore: %s (%s)\n", cfg.DatastoreType, cfg.DatastoreFile)
+	}
 
 	// Initialize application
 	application, err := app.New(cfg)
@@ -45,6 +67,9 @@ func main() {
 	fmt.Println("Endpoints available:")
 	fmt.Println("  GET /v1/find-country?ip=8.8.8.8")
 	fmt.Println("  GET /health")
+	if cfg.AdminToken != "" {
+		fmt.Println("  POST /admin/reload")
+	}
 
 	// Start server in safe goroutine
 	safe.Go(func() {
@@ -53,6 +78,16 @@ func main() {
 		}
 	})
 
+	// Reload the datastore on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	safe.Go(func() {
+		for range hup {
+			log.Println("Received SIGHUP, reloading datastore...")
+			_ = application.Reloads.Reload(context.Background())
+		}
+	})
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
@@ -67,5 +102,84 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if err := application.Close(); err != nil {
+		log.Printf("Failed to close application: %v", err)
+	}
+
 	log.Println("Server exited gracefully")
 }
+
+// dataLocation describes where a datastore's data comes from. Upstream
+// URLs are reduced to their host since they often carry API keys or
+// passwords.
+func dataLocation(datastoreType, location string) string {
+	if datastoreType != "http" && datastoreType != "redis" {
+		return location
+	}
+	if parsed, err := url.Parse(location); err == nil {
+		return parsed.Host
+	}
+	return "upstream"
+}
+
+// runCompile implements the "compile" subcommand: it loads a dataset the
+// same way the server would and writes it as a compiled index
+func runCompile(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	flags.StringVar(&cfg.DatastoreType, "type", cfg.DatastoreType, "source format: csv, json, range or mmdb")
+	flags.StringVar(&cfg.DatastoreFile, "in", cfg.DatastoreFile, "source data file")
+	out := flags.String("out", "", "compiled index to write (required)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compile [-type csv] [-in file] -out file.idx\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Source parsing honours the same environment variables as the server.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *out == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	start := time.Now()
+	entries, err := app.Compile(context.Background(), cfg, *out)
+	if err != nil {
+		log.Fatalf("Failed to compile %s: %v", cfg.DatastoreFile, err)
+	}
+	fmt.Printf("Compiled %d entries from %s to %s in %s\n", entries, cfg.DatastoreFile, *out, time.Since(start).Round(time.Millisecond))
+}
+
+// runRedisImport implements the "redis-import" subcommand: it loads a
+// dataset the same way the server would and imports it into Redis for the
+// redis datastore to serve
+func runRedisImport(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("redis-import", flag.ExitOnError)
+	flags.StringVar(&cfg.DatastoreType, "type", "csv", "source format: csv, json, range or mmdb")
+	flags.StringVar(&cfg.DatastoreFile, "in", cfg.DatastoreFile, "source data file")
+	flags.StringVar(&cfg.RedisPrefix, "prefix", cfg.RedisPrefix, "key prefix")
+	redisURL := flags.String("url", cfg.DatastoreURL, "redis://[:password@]host[:port][/db] to import into (required)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s redis-import [-type csv] [-in file] [-prefix ipcountry:] -url redis://host:6379\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Source parsing honours the same environment variables as the server.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *redisURL == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	start := time.Now()
+	entries, err := app.ImportRedis(context.Background(), cfg, *redisURL)
+	if err != nil {
+		log.Fatalf("Failed to import %s: %v", cfg.DatastoreFile, err)
+	}
+	fmt.Printf("Imported %d entries from %s to %s in %s\n", entries, cfg.DatastoreFile, dataLocation("redis", *redisURL), time.Since(start).Round(time.Millisecond))
+}